@@ -3,43 +3,44 @@ package actions
 import "github.com/actfuns/gamekit/behavior_tree/core"
 
 // PopFromQueue 动作节点 - 从队列中弹出元素
+// "queue" 指向黑板中的切片，弹出的第一个元素写入 "output_key"，队列为空时返回失败
 type PopFromQueue struct {
 	core.ActionNodeBase
-	queueKey  string
-	outputKey string
 }
 
 // NewPopFromQueue 创建新的PopFromQueue实例
 func NewPopFromQueue(name string, config core.NodeConfig) *PopFromQueue {
-	// 从Manifest的Ports中获取端口信息
-	queueKey := ""
-	outputKey := ""
-
-	if ports := config.Manifest.Ports; ports != nil {
-		if portInfo, exists := ports["queue"]; exists {
-			queueKey = portInfo.TypeName
-		}
-		if portInfo, exists := ports["output_key"]; exists {
-			outputKey = portInfo.TypeName
-		}
-	}
-
 	node := &PopFromQueue{
 		ActionNodeBase: core.NewActionNodeBase(name, config),
-		queueKey:       queueKey,
-		outputKey:      outputKey,
 	}
 	return node
 }
 
+// ProvidedPorts 返回PopFromQueue提供的端口
+func (p *PopFromQueue) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"queue":      core.InOutPort("", "queue to pop from"),
+		"output_key": core.OutputPort("", "popped element"),
+	}
+}
+
 // Tick 执行动作节点逻辑
 func (p *PopFromQueue) Tick() core.NodeStatus {
-	blackboard := p.Config().Blackboard
-	if blackboard == nil {
+	queue, err := core.GetInput[interface{}](p, "queue")
+	if err != nil {
 		return core.NodeStatusFailure
 	}
 
-	// TODO: 实现从队列弹出值的逻辑
-	// 目前返回SUCCESS作为占位实现
+	front, rest, ok := core.PopFront(queue)
+	if !ok {
+		return core.NodeStatusFailure
+	}
+
+	if err := core.SetOutput(p, "queue", rest); err != nil {
+		return core.NodeStatusFailure
+	}
+	if err := core.SetOutput(p, "output_key", front); err != nil {
+		return core.NodeStatusFailure
+	}
 	return core.NodeStatusSuccess
 }
@@ -1,33 +1,43 @@
 package actions
 
-import "github.com/actfuns/gamekit/behavior_tree/core"
+import (
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
 
 // ScriptCondition 动作节点 - 脚本条件
 type ScriptCondition struct {
 	core.ActionNodeBase
-	script string
+	script *scripting.Script
 }
 
 // NewScriptCondition 创建新的ScriptCondition实例
 func NewScriptCondition(name string, config core.NodeConfig) *ScriptCondition {
-	script := ""
-
-	if ports := config.Manifest.Ports; ports != nil {
-		if portInfo, exists := ports["script"]; exists {
-			script = portInfo.TypeName
-		}
-	}
-
 	node := &ScriptCondition{
 		ActionNodeBase: core.NewActionNodeBase(name, config),
-		script:         script,
+		script:         parseScriptPort(name, config, "code"),
 	}
 	return node
 }
 
-// Tick 执行动作节点逻辑
+// Type 返回节点类型，该节点是条件节点
+func (sc *ScriptCondition) Type() core.NodeType {
+	return core.NodeTypeCondition
+}
+
+// ProvidedPorts 返回ScriptCondition提供的端口
+func (sc *ScriptCondition) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"code": core.InputPort("string", "piece of code that can be parsed, must return a boolean").AsRequired(),
+	}
+}
+
+// Tick 脚本结果为真时返回成功，否则返回失败
 func (sc *ScriptCondition) Tick() core.NodeStatus {
-	// TODO: 实现脚本执行逻辑
-	// 暂时返回成功
+	config := sc.Config()
+	result, err := sc.script.EvalBool(config.Blackboard, config.Enums)
+	if err != nil || !result {
+		return core.NodeStatusFailure
+	}
 	return core.NodeStatusSuccess
 }
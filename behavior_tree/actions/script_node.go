@@ -1,33 +1,55 @@
 package actions
 
-import "github.com/actfuns/gamekit/behavior_tree/core"
+import (
+	"fmt"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
 
 // ScriptNode 动作节点 - 执行脚本
 type ScriptNode struct {
 	core.ActionNodeBase
-	script string
+	script *scripting.Script
 }
 
 // NewScriptNode 创建新的ScriptNode实例
 func NewScriptNode(name string, config core.NodeConfig) *ScriptNode {
-	script := ""
-
-	if ports := config.Manifest.Ports; ports != nil {
-		if portInfo, exists := ports["script"]; exists {
-			script = portInfo.TypeName
-		}
-	}
-
 	node := &ScriptNode{
 		ActionNodeBase: core.NewActionNodeBase(name, config),
-		script:         script,
+		script:         parseScriptPort(name, config, "code"),
 	}
 	return node
 }
 
-// Tick 执行动作节点逻辑
+// ProvidedPorts 返回ScriptNode提供的端口
+func (sn *ScriptNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"code": core.InputPort("string", "piece of code that can be parsed").AsRequired(),
+	}
+}
+
+// Tick 执行脚本，脚本出错时返回失败
 func (sn *ScriptNode) Tick() core.NodeStatus {
-	// TODO: 实现脚本执行逻辑
-	// 暂时返回成功
+	config := sn.Config()
+	if err := sn.script.Run(config.Blackboard, config.Enums); err != nil {
+		return core.NodeStatusFailure
+	}
 	return core.NodeStatusSuccess
 }
+
+// parseScriptPort 在节点创建时解析脚本端口，同一模板的实例共享解析结果
+func parseScriptPort(name string, config core.NodeConfig, port string) *scripting.Script {
+	code, exists := config.InputPorts[port]
+	if !exists || code == "" {
+		panic(fmt.Sprintf("Missing port '%s' in %s", port, name))
+	}
+
+	return core.SharedValue(config, "script:"+port, func() *scripting.Script {
+		script, err := scripting.Parse(code)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid script in %s: %v", name, err))
+		}
+		return script
+	})
+}
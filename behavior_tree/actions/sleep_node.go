@@ -1,55 +1,51 @@
 package actions
 
 import (
-	"strconv"
 	"time"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
 
-// SleepNode sleeps for a specified duration (in milliseconds)
+// SleepNode sleeps for a specified duration (in milliseconds), measured on
+// the clock of the node
 type SleepNode struct {
 	core.StatefulActionNode
-	duration   time.Duration
-	startTime  time.Time
+	deadline   time.Time
 	isSleeping bool
 }
 
 // NewSleepNode creates a new sleep node
 func NewSleepNode(name string, config core.NodeConfig) *SleepNode {
 	node := &SleepNode{}
-	statefulNode := core.NewStatefulActionNode(name, config,
+	node.StatefulActionNode = core.NewStatefulActionNode(name, config,
 		node.onStart,
 		node.onRunning,
 		node.onHalted)
-	node.StatefulActionNode = *statefulNode
 	return node
 }
 
+// ProvidedPorts returns the ports provided by SleepNode
+func (sn *SleepNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"msec": core.InputPort("uint", "sleep duration in milliseconds").AsRequired(),
+	}
+}
+
 // onStart is called when the node starts
 func (sn *SleepNode) onStart() core.NodeStatus {
 	// Get duration from input port "msec"
-	msecStr, ok := sn.Config().InputPorts["msec"]
-	if !ok {
-		// Try to get from other attributes if not in input ports
-		msecStr, ok = sn.Config().OtherAttributes["msec"]
-		if !ok {
-			return core.NodeStatusFailure
-		}
-	}
-
-	msec, err := strconv.Atoi(msecStr)
+	msec, err := core.GetInput[uint](sn, "msec")
 	if err != nil {
 		return core.NodeStatusFailure
 	}
 
-	if msec <= 0 {
+	if msec == 0 {
 		return core.NodeStatusSuccess
 	}
 
-	sn.duration = time.Duration(msec) * time.Millisecond
-	sn.startTime = time.Now()
+	sn.deadline = sn.Clock().Now().Add(time.Duration(msec) * time.Millisecond)
 	sn.isSleeping = true
+	sn.RequestWakeUpAt(sn.deadline)
 
 	return core.NodeStatusRunning
 }
@@ -60,12 +56,12 @@ func (sn *SleepNode) onRunning() core.NodeStatus {
 		return core.NodeStatusSuccess
 	}
 
-	elapsed := time.Since(sn.startTime)
-	if elapsed >= sn.duration {
+	if !sn.Clock().Now().Before(sn.deadline) {
 		sn.isSleeping = false
 		return core.NodeStatusSuccess
 	}
 
+	sn.RequestWakeUpAt(sn.deadline)
 	return core.NodeStatusRunning
 }
 
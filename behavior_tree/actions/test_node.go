@@ -1,33 +1,38 @@
 package actions
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
 )
 
-// TestNodeConfig 配置TestNode的行为
+// TestNodeConfig 配置TestNode的行为，可以被多个TestNode共享，创建后不应再修改
 type TestNodeConfig struct {
 	// 节点完成时返回的状态
 	ReturnStatus core.NodeStatus
-	// 成功时执行的脚本（暂不实现）
+	// 返回SUCCESS时在黑板上执行的脚本
 	SuccessScript string
-	// 失败时执行的脚本（暂不实现）
+	// 返回FAILURE时在黑板上执行的脚本
 	FailureScript string
-	// 完成后执行的脚本（暂不实现）
+	// 完成后执行的脚本，在SuccessScript或FailureScript之后执行
 	PostScript string
-	// 异步延迟时间，如果大于0则变为异步动作
+	// 异步延迟时间，如果大于0则变为异步动作，按节点的时钟计时
 	AsyncDelay time.Duration
-	// 完成时调用的函数（暂不实现）
+	// 完成时调用的函数，其返回值代替ReturnStatus。多棵树并发执行时需自行同步
 	CompleteFunc func() core.NodeStatus
 }
 
-// TestNode 是一个可配置的测试节点
+// TestNode 是一个可配置的测试节点，可以代替真实的同步或异步动作。
+// 节点的状态只在执行树的协程中访问，不启动其他协程
 type TestNode struct {
 	core.StatefulActionNode
-	config    *TestNodeConfig
-	completed bool
-	timer     *time.Timer
+	config        *TestNodeConfig
+	successScript *scripting.Script
+	failureScript *scripting.Script
+	postScript    *scripting.Script
+	deadline      time.Time
 }
 
 // NewTestNode 创建新的TestNode
@@ -37,16 +42,17 @@ func NewTestNode(name string, config core.NodeConfig, testConfig *TestNodeConfig
 	}
 
 	node := &TestNode{
-		config:    testConfig,
-		completed: false,
+		config:        testConfig,
+		successScript: parseTestScript(name, config, "SuccessScript", testConfig.SuccessScript),
+		failureScript: parseTestScript(name, config, "FailureScript", testConfig.FailureScript),
+		postScript:    parseTestScript(name, config, "PostScript", testConfig.PostScript),
 	}
 
 	// 初始化StatefulActionNode
-	statefulNode := core.NewStatefulActionNode(name, config,
+	node.StatefulActionNode = core.NewStatefulActionNode(name, config,
 		node.OnStart,
 		node.OnRunning,
 		node.OnHalted)
-	node.StatefulActionNode = *statefulNode
 
 	return node
 }
@@ -57,34 +63,28 @@ func (node *TestNode) OnStart() core.NodeStatus {
 		return node.onCompleted()
 	}
 
-	// 异步操作，启动定时器
-	node.completed = false
-	node.timer = time.AfterFunc(node.config.AsyncDelay, func() {
-		node.completed = true
-		// 在实际实现中需要唤醒信号，这里简化处理
-	})
+	// 异步操作，按节点时钟计算完成时间，并请求树在该时间唤醒
+	node.deadline = node.Clock().Now().Add(node.config.AsyncDelay)
+	node.RequestWakeUpAt(node.deadline)
 
 	return core.NodeStatusRunning
 }
 
 // OnRunning 持续执行
 func (node *TestNode) OnRunning() core.NodeStatus {
-	if node.completed {
+	if !node.Clock().Now().Before(node.deadline) {
 		return node.onCompleted()
 	}
+	node.RequestWakeUpAt(node.deadline)
 	return core.NodeStatusRunning
 }
 
 // OnHalted 被中断时调用
 func (node *TestNode) OnHalted() {
-	if node.timer != nil {
-		node.timer.Stop()
-		node.timer = nil
-	}
-	node.completed = false
+	node.deadline = time.Time{}
 }
 
-// onCompleted 完成时的处理
+// onCompleted 完成时的处理，执行对应的脚本，脚本出错时返回失败
 func (node *TestNode) onCompleted() core.NodeStatus {
 	status := node.config.ReturnStatus
 
@@ -93,7 +93,36 @@ func (node *TestNode) onCompleted() core.NodeStatus {
 		status = node.config.CompleteFunc()
 	}
 
-	// TODO: 执行脚本逻辑（简化版暂不实现）
+	scripts := []*scripting.Script{node.postScript}
+	switch status {
+	case core.NodeStatusSuccess:
+		scripts = []*scripting.Script{node.successScript, node.postScript}
+	case core.NodeStatusFailure:
+		scripts = []*scripting.Script{node.failureScript, node.postScript}
+	}
 
+	config := node.Config()
+	for _, script := range scripts {
+		if script == nil {
+			continue
+		}
+		if err := script.Run(config.Blackboard, config.Enums); err != nil {
+			return core.NodeStatusFailure
+		}
+	}
 	return status
 }
+
+// parseTestScript 在节点创建时解析脚本，空脚本返回nil
+func parseTestScript(name string, config core.NodeConfig, field, code string) *scripting.Script {
+	if code == "" {
+		return nil
+	}
+	return core.SharedValue(config, "test:"+field, func() *scripting.Script {
+		script, err := scripting.Parse(code)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid %s in %s: %v", field, name, err))
+		}
+		return script
+	})
+}
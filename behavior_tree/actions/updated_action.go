@@ -16,17 +16,15 @@ type EntryUpdatedAction struct {
 // NewEntryUpdatedAction 创建新的EntryUpdatedAction
 func NewEntryUpdatedAction(name string, config core.NodeConfig) *EntryUpdatedAction {
 	// 检查必需的输入端口 "entry"
-	entryPort, exists := config.Manifest.Ports["entry"]
-	if !exists {
+	entryPort, exists := config.InputPorts["entry"]
+	if !exists || entryPort == "" {
 		panic(fmt.Sprintf("Missing port 'entry' in %s", name))
 	}
 
 	// 处理黑板指针
-	var entryKey string
-	if isBlackboardPointer(entryPort.TypeName) {
-		entryKey = stripBlackboardPointer(entryPort.TypeName)
-	} else {
-		entryKey = entryPort.TypeName
+	entryKey := entryPort
+	if key, isPointer := core.StripBlackboardPointer(entryPort); isPointer {
+		entryKey = key
 	}
 
 	node := &EntryUpdatedAction{
@@ -37,6 +35,18 @@ func NewEntryUpdatedAction(name string, config core.NodeConfig) *EntryUpdatedAct
 	return node
 }
 
+// Type 返回节点类型，该节点是条件节点
+func (node *EntryUpdatedAction) Type() core.NodeType {
+	return core.NodeTypeCondition
+}
+
+// ProvidedPorts 返回EntryUpdatedAction提供的端口
+func (node *EntryUpdatedAction) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"entry": core.InputPort("string", "entry to check").AsRequired(),
+	}
+}
+
 // Tick 执行节点逻辑
 func (node *EntryUpdatedAction) Tick() core.NodeStatus {
 	blackboard := node.Config().Blackboard
@@ -60,16 +70,3 @@ func (node *EntryUpdatedAction) Tick() core.NodeStatus {
 	}
 	return core.NodeStatusFailure
 }
-
-// isBlackboardPointer 检查是否为黑板指针（以{开头，以}结尾）
-func isBlackboardPointer(value string) bool {
-	return len(value) > 2 && value[0] == '{' && value[len(value)-1] == '}'
-}
-
-// stripBlackboardPointer 去除黑板指针的花括号
-func stripBlackboardPointer(value string) string {
-	if len(value) > 2 && value[0] == '{' && value[len(value)-1] == '}' {
-		return value[1 : len(value)-1]
-	}
-	return value
-}
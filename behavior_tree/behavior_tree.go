@@ -1,25 +1,81 @@
 package behavior_tree
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
 
-// BehaviorTree represents a complete behavior tree
+// BehaviorTree represents a complete behavior tree.
+//
+// A tree is owned by the goroutine ticking it: Tick, TickCtx, TickOnce,
+// TickWhileRunning, Halt and SetClock must not be called by two goroutines
+// at once, they panic if they are. Ticking a tree from several goroutines in
+// turn, such as the workers of a Scheduler, is fine. The nodes take no lock
+// during a tick; other goroutines may still read their status, subscribe to
+// their changes, use the blackboard, wake up or pause the tree.
 type BehaviorTree struct {
+	id         string
 	rootNode   core.Node
 	blackboard *core.Blackboard
-	mutex      sync.RWMutex
+	wakeUp     *core.WakeUpSignal
+	clock      core.Clock
+	// owned is set while a goroutine uses the tree, see acquire
+	owned atomic.Bool
+	debug debugState
+	// instance is set for the trees a TreeTemplate can take back
+	instance *treeInstance
+}
+
+// wakeUpReceiver is implemented by nodes embedding core.TreeNode
+type wakeUpReceiver interface {
+	SetWakeUpSignal(signal *core.WakeUpSignal)
+}
+
+// clockReceiver is implemented by nodes embedding core.TreeNode
+type clockReceiver interface {
+	SetClock(clock core.Clock)
 }
 
 // NewBehaviorTree creates a new behavior tree
+// Every node of the tree is given the wake up signal of the tree, and its
+// clock: the clock of the root node config, or the system clock. The clock
+// of the root node config also stamps the writes to the blackboard.
 func NewBehaviorTree(rootNode core.Node, blackboard *core.Blackboard) *BehaviorTree {
-	return &BehaviorTree{
+	bt := &BehaviorTree{
 		rootNode:   rootNode,
 		blackboard: blackboard,
+		wakeUp:     core.NewWakeUpSignal(),
+		clock:      core.SystemClock,
+	}
+	if rootNode != nil {
+		rootNode.SetSelf(rootNode)
+		if clock := rootNode.Config().Clock; clock != nil {
+			bt.clock = clock
+			if blackboard != nil {
+				blackboard.SetClock(clock)
+			}
+		}
+		ApplyRecursiveVisitor(rootNode, func(node core.Node) {
+			if receiver, ok := node.(wakeUpReceiver); ok {
+				receiver.SetWakeUpSignal(bt.wakeUp)
+			}
+			if receiver, ok := node.(clockReceiver); ok {
+				receiver.SetClock(bt.clock)
+			}
+		})
 	}
+	return bt
+}
+
+// ID returns the ID of the tree definition the tree was instantiated from,
+// empty for trees built in code
+func (bt *BehaviorTree) ID() string {
+	return bt.id
 }
 
 // RootNode returns the root node of the tree
@@ -32,24 +88,261 @@ func (bt *BehaviorTree) Blackboard() *core.Blackboard {
 	return bt.blackboard
 }
 
-// Tick executes one tick of the behavior tree
+// WakeUpSignal returns the signal nodes emit to wake up the tree
+func (bt *BehaviorTree) WakeUpSignal() *core.WakeUpSignal {
+	return bt.wakeUp
+}
+
+// Clock returns the clock of the tree
+func (bt *BehaviorTree) Clock() core.Clock {
+	return bt.clock
+}
+
+// SetClock sets the clock of the tree, of all its nodes and of its
+// blackboard, which stamps the writes with it. It must not be called while
+// the tree is ticked.
+func (bt *BehaviorTree) SetClock(clock core.Clock) {
+	if clock == nil {
+		clock = core.SystemClock
+	}
+	bt.acquire()
+	defer bt.release()
+	bt.clock = clock
+	if bt.blackboard != nil {
+		bt.blackboard.SetClock(clock)
+	}
+	bt.ApplyVisitor(func(node core.Node) {
+		if receiver, ok := node.(clockReceiver); ok {
+			receiver.SetClock(clock)
+		}
+	})
+}
+
+// Sleep waits until a node or a watched blackboard entry wakes up the tree,
+// the deadline requested by a node is reached, or timeout elapses on the
+// clock of the tree. It reports whether the tree was woken up.
+func (bt *BehaviorTree) Sleep(timeout time.Duration) bool {
+	woken, _ := bt.wait(context.Background(), timeout)
+	return woken
+}
+
+// WakeUpOn wakes up the tree every time one of the blackboard keys changes.
+// Cancel the returned subscription to stop watching.
+func (bt *BehaviorTree) WakeUpOn(keys ...string) *core.Subscription {
+	subscription := &core.Subscription{}
+	if bt.blackboard == nil {
+		return subscription
+	}
+	for _, key := range keys {
+		watch := bt.blackboard.Subscribe(key, func(core.BlackboardEvent) {
+			bt.wakeUp.Emit()
+		})
+		subscription.Add(watch.Cancel)
+	}
+	return subscription
+}
+
+// SubscribeToStatusChange calls callback every time a node of the tree
+// changes status. Cancel the returned subscription to stop.
+func (bt *BehaviorTree) SubscribeToStatusChange(callback core.StatusChangeCallback) *core.Subscription {
+	subscription := &core.Subscription{}
+	bt.ApplyVisitor(func(node core.Node) {
+		subscription.Add(node.SubscribeToStatusChange(callback).Cancel)
+	})
+	return subscription
+}
+
+// Tick executes one tick of the behavior tree. A paused tree is not ticked
+// and the current status of the root is returned.
 func (bt *BehaviorTree) Tick() core.NodeStatus {
 	if bt.rootNode == nil {
 		return core.NodeStatusFailure
 	}
 
-	bt.mutex.Lock()
-	defer bt.mutex.Unlock()
+	bt.acquire()
+	defer bt.release()
+	return bt.tickRoot(context.Background())
+}
+
+// TickCtx executes one tick of the behavior tree with ctx, given to every
+// node ticked: stateful actions see its deadline and cancellation. If ctx is
+// done before the tick, or during a tick that leaves the tree RUNNING, the
+// tree is halted as by Halt and ctx's error is returned, joined with the
+// errors of the nodes that failed to clean up.
+func (bt *BehaviorTree) TickCtx(ctx context.Context) (core.NodeStatus, error) {
+	if bt.rootNode == nil {
+		return core.NodeStatusFailure, nil
+	}
+
+	bt.acquire()
+	defer bt.release()
+	return bt.tickCtx(ctx)
+}
+
+// tickCtx ticks the root once with ctx, halting the tree if ctx is done, see
+// TickCtx. The caller must own the tree.
+func (bt *BehaviorTree) tickCtx(ctx context.Context) (core.NodeStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return bt.rootNode.Status(), bt.cancel(err)
+	}
+	status := bt.tickRoot(ctx)
+	if status == core.NodeStatusRunning {
+		if err := ctx.Err(); err != nil {
+			return status, bt.cancel(err)
+		}
+	}
+	return status, nil
+}
 
-	status := bt.rootNode.ExecuteTick()
+// acquire makes the calling goroutine the owner of the tree until release.
+// It panics if another goroutine owns it.
+func (bt *BehaviorTree) acquire() {
+	if !bt.owned.CompareAndSwap(false, true) {
+		panic("behavior tree used by several goroutines at once")
+	}
+}
+
+// release ends the ownership taken by acquire
+func (bt *BehaviorTree) release() {
+	bt.owned.Store(false)
+}
+
+// tickRoot ticks the root once. The caller must own the tree.
+func (bt *BehaviorTree) tickRoot(ctx context.Context) core.NodeStatus {
+	if !bt.beginTick() {
+		return bt.rootNode.Status()
+	}
+	bt.wakeUp.ClearDeadline()
+	status := bt.rootNode.ExecuteTick(ctx)
+	bt.endTick()
 	return status
 }
 
-// Halt halts the entire behavior tree
-func (bt *BehaviorTree) Halt() {
-	if bt.rootNode != nil {
-		bt.rootNode.HaltAndReset()
+// TickExactlyOnce ticks the tree once, even if a node emitted a wake up
+// signal during the tick. If ctx is done the tree is halted as by TickCtx.
+func (bt *BehaviorTree) TickExactlyOnce(ctx context.Context) (core.NodeStatus, error) {
+	if bt.rootNode == nil {
+		return core.NodeStatusFailure, nil
+	}
+
+	bt.acquire()
+	defer bt.release()
+	return bt.tickCtx(ctx)
+}
+
+// TickOnce ticks the tree once, then again as long as the tree is RUNNING
+// and nodes emitted a wake up signal during the previous tick. If ctx is
+// done the tree is halted as by TickCtx.
+func (bt *BehaviorTree) TickOnce(ctx context.Context) (core.NodeStatus, error) {
+	if bt.rootNode == nil {
+		return core.NodeStatusFailure, nil
+	}
+
+	bt.acquire()
+	defer bt.release()
+	return bt.tickPending(ctx)
+}
+
+// tickPending ticks the root, then again while wake ups are pending.
+// The caller must own the tree.
+func (bt *BehaviorTree) tickPending(ctx context.Context) (core.NodeStatus, error) {
+	status, err := bt.tickCtx(ctx)
+	for err == nil && status == core.NodeStatusRunning && bt.wakeUp.WaitFor(0) {
+		status, err = bt.tickCtx(ctx)
+	}
+	return status, err
+}
+
+// TickWhileRunning ticks the tree until it returns SUCCESS or FAILURE.
+// Between two ticks it sleeps up to sleep on the clock of the tree, less if
+// a node emits a wake up signal or requested an earlier deadline. If ctx is
+// cancelled the tree is halted as by TickCtx.
+func (bt *BehaviorTree) TickWhileRunning(ctx context.Context, sleep time.Duration) (core.NodeStatus, error) {
+	if bt.rootNode == nil {
+		return core.NodeStatusFailure, nil
+	}
+
+	bt.acquire()
+	defer bt.release()
+
+	status := core.NodeStatusIdle
+	for status == core.NodeStatusIdle || status == core.NodeStatusRunning {
+		var err error
+		if status, err = bt.tickPending(ctx); err != nil {
+			return status, err
+		}
+		if status != core.NodeStatusRunning && status != core.NodeStatusIdle {
+			break
+		}
+		if _, err := bt.wait(ctx, sleep); err != nil {
+			return status, bt.cancel(err)
+		}
+	}
+	return status, nil
+}
+
+// wait waits up to timeout on the clock of the tree, returning early on a
+// wake up signal, at the deadline requested by a node or when ctx is
+// cancelled. It reports whether the tree was woken up.
+func (bt *BehaviorTree) wait(ctx context.Context, timeout time.Duration) (bool, error) {
+	atDeadline := false
+	if deadline, ok := bt.wakeUp.Deadline(); ok {
+		remaining := deadline.Sub(bt.clock.Now())
+		if remaining <= 0 {
+			return true, ctx.Err()
+		}
+		if remaining < timeout {
+			timeout = remaining
+			atDeadline = true
+		}
+	}
+
+	if timeout <= 0 {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		return bt.wakeUp.WaitFor(0), nil
+	}
+
+	timer, stop := core.StartTimer(bt.clock, timeout)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-bt.wakeUp.C():
+		return true, nil
+	case <-timer:
+		return atDeadline, nil
+	}
+}
+
+// Halt halts the entire behavior tree. The RUNNING nodes get Halt deepest
+// first, see core.HaltRunning, so that an action is cleaned up before the
+// nodes depending on it; then every node is reset. It returns the errors of
+// the nodes that failed to clean up, e.g. to release a reservation.
+func (bt *BehaviorTree) Halt() error {
+	if bt.rootNode == nil {
+		return nil
+	}
+	bt.acquire()
+	defer bt.release()
+	return bt.halt()
+}
+
+// halt halts the tree. The caller must own the tree.
+func (bt *BehaviorTree) halt() error {
+	err := core.HaltRunning(bt.rootNode)
+	bt.rootNode.HaltAndReset()
+	return err
+}
+
+// cancel halts the tree after its context was done with err, and returns
+// err with the cleanup errors. The caller must own the tree.
+func (bt *BehaviorTree) cancel(err error) error {
+	if haltErr := bt.halt(); haltErr != nil {
+		return errors.Join(err, haltErr)
 	}
+	return err
 }
 
 // PrintTree prints the tree structure
@@ -0,0 +1,513 @@
+package behavior_tree
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+func TestBehaviorTree_WakeUp(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	tree, err := parser.LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Delay delay_msec="10"><AlwaysSuccess/></Delay>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := core.NewManualClock(time.Unix(0, 0))
+	tree.SetClock(clock)
+
+	if status := tree.Tick(); status != core.NodeStatusRunning {
+		t.Fatalf("expected RUNNING, got %s", status)
+	}
+	if tree.Sleep(0) {
+		t.Fatalf("woken up before the end of the delay")
+	}
+	clock.Advance(10 * time.Millisecond)
+	if !tree.Sleep(time.Second) {
+		t.Fatalf("the delay did not wake up the tree")
+	}
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+
+	subscription := tree.WakeUpOn("enemy")
+	tree.Blackboard().Set("enemy", "orc")
+	if !tree.Sleep(0) {
+		t.Fatalf("the blackboard write did not wake up the tree")
+	}
+	subscription.Cancel()
+	tree.Blackboard().Set("enemy", "troll")
+	if tree.Sleep(0) {
+		t.Fatalf("woken up after Cancel")
+	}
+
+	// Waits ended by a wake up do not leave timers in the clock
+	for i := 0; i < 10; i++ {
+		tree.WakeUpSignal().Emit()
+		if !tree.Sleep(time.Minute) {
+			t.Fatalf("the wake up did not end the sleep")
+		}
+	}
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Fatalf("expected no waiter left in the clock, got %d", waiters)
+	}
+}
+
+func TestBehaviorTree_TickModes(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	err := parser.RegisterFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Repeat">
+    <Repeat num_cycles="3"><Script code="count += 1" /></Repeat>
+  </BehaviorTree>
+  <BehaviorTree ID="Delay">
+    <Delay delay_msec="20"><AlwaysSuccess/></Delay>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTree := func(id string) *BehaviorTree {
+		tree, err := parser.InstantiateTree(id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Blackboard().Set("count", 0)
+		return tree
+	}
+	ctx := context.Background()
+
+	// Repeat yields after each cycle and wakes up the tree
+	tree := newTree("Repeat")
+	if status, _ := tree.TickExactlyOnce(ctx); status != core.NodeStatusRunning {
+		t.Fatalf("expected RUNNING after exactly one tick, got %s", status)
+	}
+	if status, _ := tree.TickOnce(ctx); status != core.NodeStatusSuccess {
+		t.Fatalf("TickOnce must process the pending wake ups, got %s", status)
+	}
+	if v, _ := tree.Blackboard().Get("count"); v != 3 {
+		t.Fatalf("expected 3 cycles, got %v", v)
+	}
+
+	// The delay wakes up the tree long before the sleep time
+	tree = newTree("Delay")
+	start := time.Unix(0, 0)
+	clock := core.NewSimulatedClock(start)
+	tree.SetClock(clock)
+	status, err := tree.TickWhileRunning(ctx, 10*time.Second)
+	if err != nil || status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s, %v", status, err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 20*time.Millisecond {
+		t.Fatalf("the deadline of the delay did not shorten the sleep, slept %s", elapsed)
+	}
+
+	// Cancelling halts the tree
+	tree = newTree("Delay")
+	tree.SetClock(core.NewManualClock(start))
+	if status, _ := tree.TickOnce(ctx); status != core.NodeStatusRunning {
+		t.Fatalf("expected RUNNING, got %s", status)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	status, err = tree.TickWhileRunning(cancelled, time.Millisecond)
+	if err != context.Canceled || status != core.NodeStatusRunning {
+		t.Fatalf("expected a cancelled RUNNING tree, got %s, %v", status, err)
+	}
+	if tree.RootNode().Status() != core.NodeStatusIdle {
+		t.Fatalf("cancelled tree not halted")
+	}
+	if _, err := tree.TickOnce(cancelled); err == nil {
+		t.Fatalf("expected an error ticking with a cancelled context")
+	}
+}
+
+// dealTree is a tree reserving an item and opening a trade in parallel,
+// recording the cleanups of the actions and the halt order
+type dealTree struct {
+	tree             *BehaviorTree
+	starts, cleanups int
+	sawDeadline      bool
+	halted           []string
+}
+
+// dealHaltOrder is the order the running nodes of a dealTree are halted
+var dealHaltOrder = []string{"Reserve", "Trade", "Invert", "Deal", "Root"}
+
+func newDealTree(t *testing.T) *dealTree {
+	deal := &dealTree{}
+	factory := NewBehaviorTreeFactory()
+	register := func(id string, cleanupErr error) {
+		err := factory.RegisterBuilder(id, core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: id},
+			func(name string, config core.NodeConfig) (core.Node, error) {
+				node := core.NewStatefulActionNodeWithContext(name, config,
+					func(ctx context.Context) core.NodeStatus {
+						deal.starts++
+						_, deal.sawDeadline = ctx.Deadline()
+						return core.NodeStatusRunning
+					},
+					func(ctx context.Context) core.NodeStatus {
+						return core.NodeStatusRunning
+					},
+					func(ctx context.Context) error {
+						if ctx.Err() != nil {
+							t.Errorf("%s cleaned up with a done context", name)
+						}
+						deal.cleanups++
+						return cleanupErr
+					})
+				return &node, nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	register("ReserveItem", nil)
+	register("OpenTrade", errors.New("trade not rolled back"))
+
+	tree, err := NewXMLParser(factory).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence name="Root">
+      <ParallelAll name="Deal">
+        <ReserveItem name="Reserve" />
+        <Inverter name="Invert"><OpenTrade name="Trade" /></Inverter>
+      </ParallelAll>
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.SubscribeToStatusChange(func(change core.StatusChange) {
+		if change.Previous == core.NodeStatusRunning && change.Status == core.NodeStatusIdle {
+			deal.halted = append(deal.halted, change.Node.Name())
+		}
+	})
+	deal.tree = tree
+	return deal
+}
+
+// checkCancelled checks that the tree was halted after its context was
+// cancelled
+func (deal *dealTree) checkCancelled(t *testing.T, status core.NodeStatus, err error) {
+	t.Helper()
+	if status != core.NodeStatusRunning || !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "trade not rolled back") {
+		t.Fatalf("expected a cancelled tree with the cleanup error, got %s, %v", status, err)
+	}
+	if !reflect.DeepEqual(deal.halted, dealHaltOrder) {
+		t.Fatalf("expected halt order %v, got %v", dealHaltOrder, deal.halted)
+	}
+	if deal.cleanups != 2 || deal.tree.RootNode().Status() != core.NodeStatusIdle {
+		t.Fatalf("expected 2 cleanups of a halted tree, got %d, root %s", deal.cleanups, deal.tree.RootNode().Status())
+	}
+}
+
+func TestBehaviorTree_TickCtx(t *testing.T) {
+	deal := newDealTree(t)
+	tree := deal.tree
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	if status, err := tree.TickCtx(ctx); status != core.NodeStatusRunning || err != nil {
+		t.Fatalf("expected RUNNING, got %s, %v", status, err)
+	}
+	if !deal.sawDeadline {
+		t.Fatalf("the actions did not see the deadline of the tick")
+	}
+
+	// Cancelling halts the running nodes deepest first, each once
+	cancel()
+	status, err := tree.TickCtx(ctx)
+	deal.checkCancelled(t, status, err)
+
+	// A done context does not start the actions
+	if _, err := tree.TickCtx(ctx); err != context.Canceled || deal.starts != 2 {
+		t.Fatalf("expected context.Canceled without starting, got %v, %d starts", err, deal.starts)
+	}
+
+	// Halt returns the cleanup errors too
+	tree.Tick()
+	if err := tree.Halt(); err == nil || !strings.Contains(err.Error(), "Trade") {
+		t.Fatalf("expected the cleanup error of Trade, got %v", err)
+	}
+	if err := tree.Halt(); err != nil || deal.cleanups != 4 {
+		t.Fatalf("expected a single cleanup per halt, got %v, %d cleanups", err, deal.cleanups)
+	}
+}
+
+func TestBehaviorTree_CancelHalts(t *testing.T) {
+	for name, tick := range map[string]func(*BehaviorTree, context.Context) (core.NodeStatus, error){
+		"TickOnce":        (*BehaviorTree).TickOnce,
+		"TickExactlyOnce": (*BehaviorTree).TickExactlyOnce,
+	} {
+		t.Run(name, func(t *testing.T) {
+			deal := newDealTree(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			if status, err := tick(deal.tree, ctx); status != core.NodeStatusRunning || err != nil {
+				t.Fatalf("expected RUNNING, got %s, %v", status, err)
+			}
+			cancel()
+			status, err := tick(deal.tree, ctx)
+			deal.checkCancelled(t, status, err)
+		})
+	}
+}
+
+func TestBehaviorTree_ThreadedAction(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	release := make(chan string)
+	err := factory.RegisterThreadedAction("LoadProfile", func(ctx context.Context, node core.Node) (core.NodeStatus, error) {
+		path, err := core.GetInput[string](node, "path")
+		if err != nil {
+			return core.NodeStatusFailure, err
+		}
+		switch <-release {
+		case "panic":
+			panic("corrupted " + path)
+		case "wait":
+			<-ctx.Done()
+			return core.NodeStatusFailure, errors.New("file left locked")
+		}
+		return core.NodeStatusSuccess, nil
+	}, core.PortsList{"path": core.InputPort("string", "profile file")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewXMLParser(factory).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <LoadProfile path="npc.json" />
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := tree.RootNode().(*core.ThreadedActionNode)
+
+	// The work runs while the tree returns RUNNING, then wakes it up
+	for _, order := range []string{"done", "panic"} {
+		if status := tree.Tick(); status != core.NodeStatusRunning {
+			t.Fatalf("expected RUNNING, got %s", status)
+		}
+		if status := tree.Tick(); status != core.NodeStatusRunning {
+			t.Fatalf("expected RUNNING while the work runs, got %s", status)
+		}
+		release <- order
+		if !tree.Sleep(time.Minute) {
+			t.Fatalf("the completed work did not wake up the tree")
+		}
+		status := tree.Tick()
+		switch order {
+		case "done":
+			if status != core.NodeStatusSuccess || action.Err() != nil {
+				t.Fatalf("expected SUCCESS, got %s, %v", status, action.Err())
+			}
+		case "panic":
+			if status != core.NodeStatusFailure || action.Err() == nil || !strings.Contains(action.Err().Error(), "corrupted npc.json") {
+				t.Fatalf("expected FAILURE with the panic, got %s, %v", status, action.Err())
+			}
+		}
+	}
+
+	// Halt waits for the work to honor the cancellation
+	tree.Tick()
+	release <- "wait"
+	if err := tree.Halt(); err == nil || !strings.Contains(err.Error(), "file left locked") {
+		t.Fatalf("expected the error of the halted work, got %v", err)
+	}
+	if action.Status() != core.NodeStatusIdle {
+		t.Fatalf("expected a halted action, got %s", action.Status())
+	}
+}
+
+func TestBehaviorTree_Clock(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	err := parser.RegisterFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Timeout">
+    <Timeout msec="50"><Sleep msec="100" /></Timeout>
+  </BehaviorTree>
+  <BehaviorTree ID="Sleep">
+    <Sequence>
+      <Sleep msec="30" />
+      <Sleep msec="30" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 0)
+
+	tree, err := parser.InstantiateTree("Timeout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := core.NewManualClock(start)
+	tree.SetClock(clock)
+	if status := tree.Tick(); status != core.NodeStatusRunning {
+		t.Fatalf("expected RUNNING, got %s", status)
+	}
+	tree.Blackboard().Set("spotted", true)
+	if stamp := tree.Blackboard().GetEntry("spotted").Stamp.Time(); !stamp.Equal(start) {
+		t.Fatalf("expected the write to be stamped by the tree clock, got %v", stamp)
+	}
+	if deadline, ok := tree.WakeUpSignal().Deadline(); !ok || !deadline.Equal(start.Add(50*time.Millisecond)) {
+		t.Fatalf("expected a wake up at the timeout, got %v %v", deadline, ok)
+	}
+	clock.Advance(49 * time.Millisecond)
+	if status := tree.Tick(); status != core.NodeStatusRunning {
+		t.Fatalf("expected RUNNING before the timeout, got %s", status)
+	}
+	clock.Advance(time.Millisecond)
+	if status := tree.Tick(); status != core.NodeStatusFailure {
+		t.Fatalf("expected FAILURE at the timeout, got %s", status)
+	}
+	if child := tree.RootNode().Children()[0]; child.Status() != core.NodeStatusIdle {
+		t.Fatalf("the child was not halted, status %s", child.Status())
+	}
+
+	tree, err = parser.InstantiateTree("Sleep", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock = core.NewSimulatedClock(start)
+	tree.SetClock(clock)
+	status, err := tree.TickWhileRunning(context.Background(), time.Hour)
+	if err != nil || status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s, %v", status, err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 60*time.Millisecond {
+		t.Fatalf("expected 60ms of simulated time, got %s", elapsed)
+	}
+}
+
+// tickXML is an NPC tree typical of a game: the tick reads and writes typed
+// ports, evaluates scripts and pre-conditions
+const tickXML = `<root BTCPP_format="4">
+  <BehaviorTree ID="NPC">
+    <ReactiveFallback>
+      <Sequence _skipIf="stunned">
+        <EnemyInRange distance="{distance}" range="10"/>
+        <Attack hits="{hits}"/>
+      </Sequence>
+      <Sequence>
+        <ScriptCondition code="patrol &lt; 1000000000 &amp;&amp; !stunned"/>
+        <Inverter><AlwaysFailure/></Inverter>
+        <Script code="patrol += 1; speed := speed * 1.5"/>
+      </Sequence>
+    </ReactiveFallback>
+  </BehaviorTree>
+</root>`
+
+// newTickTree creates the tree of tickXML with the enemy at distance
+func newTickTree(tb testing.TB, distance float64) *BehaviorTree {
+	factory := NewBehaviorTreeFactory()
+	factory.RegisterSimpleCondition("EnemyInRange", func(node core.Node) core.NodeStatus {
+		distance, err := core.GetInput[float64](node, "distance")
+		if err != nil {
+			return core.NodeStatusFailure
+		}
+		reach, err := core.GetInput[float64](node, "range")
+		if err != nil || distance > reach {
+			return core.NodeStatusFailure
+		}
+		return core.NodeStatusSuccess
+	}, core.PortsList{
+		"distance": core.InputPort("float64", ""),
+		"range":    core.InputPort("float64", ""),
+	})
+	factory.RegisterSimpleAction("Attack", func(node core.Node) core.NodeStatus {
+		hits, err := core.GetInput[int](node, "hits")
+		if err != nil || core.SetOutput(node, "hits", hits+1) != nil {
+			return core.NodeStatusFailure
+		}
+		return core.NodeStatusSuccess
+	}, core.PortsList{"hits": core.InOutPort("int", "")})
+	if err := factory.RegisterBehaviorTreeFromText(tickXML); err != nil {
+		tb.Fatal(err)
+	}
+	tree, err := factory.CreateTree("NPC", nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	bb := tree.Blackboard()
+	bb.Set("distance", distance)
+	bb.Set("stunned", false)
+	bb.Set("hits", 1000)
+	bb.Set("patrol", 1000)
+	bb.Set("speed", 1.0)
+	return tree
+}
+
+func TestBehaviorTree_TickAllocations(t *testing.T) {
+	for _, distance := range []float64{5, 50} {
+		tree := newTickTree(t, distance)
+		if status := tree.Tick(); status != core.NodeStatusSuccess {
+			t.Fatalf("expected SUCCESS, got %s", status)
+		}
+		if allocs := testing.AllocsPerRun(100, func() { tree.Tick() }); allocs != 0 {
+			t.Fatalf("distance %v: expected a tick without allocation, got %v", distance, allocs)
+		}
+	}
+
+	tree := newTickTree(t, 50)
+	tree.Tick()
+	if patrol, _ := core.GetValue[int](tree.Blackboard(), "patrol"); patrol != 1001 {
+		t.Fatalf("expected patrol 1001, got %d", patrol)
+	}
+	if speed, _ := tree.Blackboard().Get("speed"); speed != 1.5 {
+		t.Fatalf("expected speed 1.5, got %v", speed)
+	}
+}
+
+func TestBehaviorTree_Ownership(t *testing.T) {
+	var tree *BehaviorTree
+	action := core.NewActionNode("HaltOwnTree", core.NodeConfig{}, func() core.NodeStatus {
+		// The tree is owned by the tick in progress
+		tree.Halt()
+		return core.NodeStatusSuccess
+	})
+	tree = NewBehaviorTree(&action, core.NewBlackboard())
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a panic using a tree being ticked")
+			}
+		}()
+		tree.Tick()
+	}()
+	// The panic released the tree
+	tree.Halt()
+}
+
+func BenchmarkBehaviorTree_Tick(b *testing.B) {
+	for _, bench := range []struct {
+		name     string
+		distance float64
+	}{{"Combat", 5}, {"Patrol", 50}} {
+		b.Run(bench.name, func(b *testing.B) {
+			tree := newTickTree(b, bench.distance)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tree.Tick()
+			}
+		})
+	}
+
+	// Every goroutine ticks its own tree, sharing nothing but the definitions
+	b.Run("Parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			tree := newTickTree(b, 50)
+			for pb.Next() {
+				tree.Tick()
+			}
+		})
+	})
+}
@@ -1,28 +1,140 @@
 package behavior_tree
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/decorators"
 )
 
 // TreeNodeCreator is a function that creates a tree node
-type TreeNodeCreator func(string, core.NodeConfig) (core.TreeNode, error)
+type TreeNodeCreator func(string, core.NodeConfig) (core.Node, error)
 
-// BehaviorTreeFactory is used to register and create tree nodes
+// BehaviorTreeFactory is used to register and create tree nodes, and to
+// create trees from the tree definitions registered with it
 type BehaviorTreeFactory struct {
 	manifests    map[string]core.TreeNodeManifest
 	constructors map[string]TreeNodeCreator
-	mutex        sync.RWMutex
+	enums        map[string]int
+	trees        *XMLParser
+	// substitutions are the rules applied when instantiating trees
+	substitutions []substitution
+	mutex         sync.RWMutex
 }
 
-// NewBehaviorTreeFactory creates a new behavior tree factory
+// NewBehaviorTreeFactory creates a new behavior tree factory with the
+// builtin nodes of the controls, decorators and actions packages registered
+// under their BehaviorTree.CPP names
 func NewBehaviorTreeFactory() *BehaviorTreeFactory {
-	return &BehaviorTreeFactory{
+	f := &BehaviorTreeFactory{
 		manifests:    make(map[string]core.TreeNodeManifest),
 		constructors: make(map[string]TreeNodeCreator),
+		enums:        make(map[string]int),
 	}
+	f.trees = NewXMLParser(f)
+	for id, builtin := range builtinNodes {
+		f.manifests[id] = builtin.manifest
+		f.constructors[id] = builtin.creator
+	}
+	return f
+}
+
+// PortsProvider is implemented by node types declaring their ports.
+// ProvidedPorts is called on a zero value and must not use the receiver.
+type PortsProvider interface {
+	ProvidedPorts() core.PortsList
+}
+
+// SimpleNodeTickFunc is the tick of a node registered with RegisterSimpleAction
+// or RegisterSimpleCondition. The node gives access to its ports.
+type SimpleNodeTickFunc func(node core.Node) core.NodeStatus
+
+// ThreadedActionFunc is the work of a node registered with
+// RegisterThreadedAction, run in its own goroutine. ctx is done when the node
+// is halted. The node gives access to its ports.
+type ThreadedActionFunc func(ctx context.Context, node core.Node) (core.NodeStatus, error)
+
+// NodeManifest returns the manifest of the node type T: its type is read
+// from the Type method and its ports from ProvidedPorts, if T implements
+// PortsProvider
+func NodeManifest[T core.Node](registrationID string) core.TreeNodeManifest {
+	var node T
+	if t := reflect.TypeOf(node); t != nil && t.Kind() == reflect.Pointer {
+		// Methods promoted from embedded nodes need an allocated value
+		node = reflect.New(t.Elem()).Interface().(T)
+	}
+
+	manifest := core.TreeNodeManifest{RegistrationID: registrationID}
+	if typed, ok := interface{}(node).(interface{ Type() core.NodeType }); ok {
+		manifest.Type = typed.Type()
+	}
+	if provider, ok := interface{}(node).(PortsProvider); ok {
+		manifest.Ports = provider.ProvidedPorts()
+	}
+	return manifest
+}
+
+// RegisterNodeType registers the nodes created by constructor, with the
+// manifest returned by NodeManifest
+func RegisterNodeType[T core.Node](factory *BehaviorTreeFactory, registrationID string, constructor func(name string, config core.NodeConfig) T) error {
+	return factory.RegisterBuilder(registrationID, NodeManifest[T](registrationID),
+		func(name string, config core.NodeConfig) (core.Node, error) {
+			return constructor(name, config), nil
+		})
+}
+
+// RegisterSimpleAction registers an action node calling tick
+func (f *BehaviorTreeFactory) RegisterSimpleAction(registrationID string, tick SimpleNodeTickFunc, ports core.PortsList) error {
+	manifest := core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: registrationID, Ports: ports}
+	return f.RegisterBuilder(registrationID, manifest, func(name string, config core.NodeConfig) (core.Node, error) {
+		var node *core.ActionNode
+		action := core.NewActionNode(name, config, func() core.NodeStatus {
+			return tick(node)
+		})
+		node = &action
+		return node, nil
+	})
+}
+
+// RegisterThreadedAction registers an action node running work in its own
+// goroutine, see core.ThreadedActionNode
+func (f *BehaviorTreeFactory) RegisterThreadedAction(registrationID string, work ThreadedActionFunc, ports core.PortsList) error {
+	manifest := core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: registrationID, Ports: ports}
+	return f.RegisterBuilder(registrationID, manifest, func(name string, config core.NodeConfig) (core.Node, error) {
+		var node *core.ThreadedActionNode
+		action := core.NewThreadedActionNode(name, config, func(ctx context.Context) (core.NodeStatus, error) {
+			return work(ctx, node)
+		})
+		node = &action
+		return node, nil
+	})
+}
+
+// RegisterSimpleCondition registers a condition node calling tick
+func (f *BehaviorTreeFactory) RegisterSimpleCondition(registrationID string, tick SimpleNodeTickFunc, ports core.PortsList) error {
+	manifest := core.TreeNodeManifest{Type: core.NodeTypeCondition, RegistrationID: registrationID, Ports: ports}
+	return f.RegisterBuilder(registrationID, manifest, func(name string, config core.NodeConfig) (core.Node, error) {
+		var node *core.ConditionNode
+		condition := core.NewConditionNode(name, config, func() core.NodeStatus {
+			return tick(node)
+		})
+		node = &condition
+		return node, nil
+	})
+}
+
+// RegisterSimpleDecorator registers a decorator returning the status
+// computed by tick from the status of its child
+func (f *BehaviorTreeFactory) RegisterSimpleDecorator(registrationID string, tick decorators.SimpleDecoratorTickFunc, ports core.PortsList) error {
+	manifest := core.TreeNodeManifest{Type: core.NodeTypeDecorator, RegistrationID: registrationID, Ports: ports}
+	return f.RegisterBuilder(registrationID, manifest, func(name string, config core.NodeConfig) (core.Node, error) {
+		return decorators.NewSimpleDecoratorNode(name, config, tick), nil
+	})
 }
 
 // RegisterBuilder registers a node builder with the factory
@@ -48,19 +160,37 @@ func (f *BehaviorTreeFactory) UnregisterBuilder(registrationID string) {
 	delete(f.constructors, registrationID)
 }
 
-// CreateNode creates a node using the registered constructor
-func (f *BehaviorTreeFactory) CreateNode(registrationID string, name string, config core.NodeConfig) (TreeNode, error) {
+// CreateNode creates a node using the registered constructor. The manifest
+// of the registration is set in config if it has none, so that the node can
+// be written back to XML.
+func (f *BehaviorTreeFactory) CreateNode(registrationID string, name string, config core.NodeConfig) (core.Node, error) {
 	f.mutex.RLock()
 	creator, exists := f.constructors[registrationID]
+	manifest := f.manifests[registrationID]
 	f.mutex.RUnlock()
 
 	if !exists {
 		return nil, fmt.Errorf("registration ID '%s' not found", registrationID)
 	}
 
+	if config.Manifest.RegistrationID == "" {
+		if manifest.RegistrationID == "" {
+			manifest.RegistrationID = registrationID
+		}
+		config.Manifest = manifest
+	}
 	return creator(name, config)
 }
 
+// lookup returns the manifest and constructor of a registration ID
+func (f *BehaviorTreeFactory) lookup(registrationID string) (core.TreeNodeManifest, TreeNodeCreator, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	creator, exists := f.constructors[registrationID]
+	return f.manifests[registrationID], creator, exists
+}
+
 // GetManifest returns the manifest for a registration ID
 func (f *BehaviorTreeFactory) GetManifest(registrationID string) (core.TreeNodeManifest, bool) {
 	f.mutex.RLock()
@@ -70,6 +200,35 @@ func (f *BehaviorTreeFactory) GetManifest(registrationID string) (core.TreeNodeM
 	return manifest, exists
 }
 
+// RegisterScriptingEnum registers a constant usable by name in scripts
+func (f *BehaviorTreeFactory) RegisterScriptingEnum(name string, value int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enums[name] = value
+}
+
+// RegisterEnum registers an enum type for ports and blackboard entries, see
+// core.RegisterEnum, and makes its values usable by name in the scripts of
+// the factory's trees
+func RegisterEnum[T core.Integer](factory *BehaviorTreeFactory, values map[string]T, aliases ...string) {
+	core.RegisterEnum(values, aliases...)
+	for name, value := range values {
+		factory.RegisterScriptingEnum(name, int(value))
+	}
+}
+
+// ScriptingEnums returns a copy of the registered scripting enums
+func (f *BehaviorTreeFactory) ScriptingEnums() map[string]int {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	enums := make(map[string]int, len(f.enums))
+	for name, value := range f.enums {
+		enums[name] = value
+	}
+	return enums
+}
+
 // RegisteredNodes returns all registered node IDs
 func (f *BehaviorTreeFactory) RegisteredNodes() []string {
 	f.mutex.RLock()
@@ -82,11 +241,74 @@ func (f *BehaviorTreeFactory) RegisteredNodes() []string {
 	return ids
 }
 
-// Clear removes all registered builders
+// BuiltinNodes returns the sorted IDs of the nodes every factory registers
+func BuiltinNodes() []string {
+	ids := make([]string, 0, len(builtinNodes))
+	for id := range builtinNodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Clear removes all registered builders, including the builtin nodes
 func (f *BehaviorTreeFactory) Clear() {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
 
 	f.manifests = make(map[string]core.TreeNodeManifest)
 	f.constructors = make(map[string]TreeNodeCreator)
+	f.enums = make(map[string]int)
+}
+
+// RegisterBehaviorTreeFromFile registers the tree definitions of an XML file
+// and of its includes. Trees of every registered file can use each other as
+// subtrees.
+func (f *BehaviorTreeFactory) RegisterBehaviorTreeFromFile(filename string) error {
+	return f.trees.RegisterFromFile(filename)
+}
+
+// RegisterBehaviorTreeFromText registers the tree definitions of an XML string
+func (f *BehaviorTreeFactory) RegisterBehaviorTreeFromText(text string) error {
+	return f.trees.RegisterFromText(text)
+}
+
+// RegisterBehaviorTreeFromFS registers the tree definitions of the files of
+// fsys matching the patterns, e.g. the files embedded with go:embed
+func (f *BehaviorTreeFactory) RegisterBehaviorTreeFromFS(fsys fs.FS, patterns ...string) error {
+	return f.trees.RegisterFromFS(fsys, patterns...)
+}
+
+// RegisteredBehaviorTrees returns the sorted IDs of the registered trees
+func (f *BehaviorTreeFactory) RegisteredBehaviorTrees() []string {
+	return f.trees.RegisteredTrees()
+}
+
+// ClearRegisteredBehaviorTrees removes the registered tree definitions
+func (f *BehaviorTreeFactory) ClearRegisteredBehaviorTrees() {
+	f.trees.Clear()
+}
+
+// ValidateBehaviorTrees checks the registered tree definitions, see
+// XMLParser.Validate
+func (f *BehaviorTreeFactory) ValidateBehaviorTrees(roots ...string) []Diagnostic {
+	return f.trees.Validate(roots...)
+}
+
+// SetValidateOnLoad makes CreateTree fail with a *ValidationError when the
+// tree or one of its subtrees has errors
+func (f *BehaviorTreeFactory) SetValidateOnLoad(enabled bool) {
+	f.trees.SetValidateOnLoad(enabled)
+}
+
+// SetWorldBlackboard shares world between the trees created afterwards, see
+// XMLParser.SetWorldBlackboard
+func (f *BehaviorTreeFactory) SetWorldBlackboard(world *core.Blackboard) {
+	f.trees.SetWorldBlackboard(world)
+}
+
+// CreateTree instantiates the registered tree treeID. A nil blackboard
+// creates a new one, child of the world blackboard if set.
+func (f *BehaviorTreeFactory) CreateTree(treeID string, blackboard *core.Blackboard) (*BehaviorTree, error) {
+	return f.trees.InstantiateTree(treeID, blackboard)
 }
@@ -0,0 +1,306 @@
+package behavior_tree
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/actfuns/gamekit/behavior_tree/actions"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/decorators"
+)
+
+func TestBehaviorTreeFactory_Builtins(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	for _, id := range BuiltinNodes() {
+		if _, ok := factory.GetManifest(id); !ok {
+			t.Fatalf("builtin node '%s' not registered", id)
+		}
+	}
+
+	manifest, _ := factory.GetManifest("Timeout")
+	if manifest.Type != core.NodeTypeDecorator || manifest.Ports["msec"].TypeName != "uint" {
+		t.Fatalf("unexpected Timeout manifest %+v", manifest)
+	}
+	if manifest, _ := factory.GetManifest("ScriptCondition"); manifest.Type != core.NodeTypeCondition {
+		t.Fatalf("ScriptCondition registered as %s", manifest.Type)
+	}
+	if err := factory.RegisterBuilder("Sequence", core.TreeNodeManifest{}, nil); err == nil {
+		t.Fatalf("registering a builtin ID twice must fail")
+	}
+}
+
+func TestBehaviorTreeFactory_ParallelPorts(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	tree, err := NewXMLParser(factory).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Parallel success_count="{needed}" failure_count="{allowed}">
+      <AlwaysSuccess /><AlwaysSuccess /><AlwaysFailure />
+    </Parallel>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Blackboard().Set("needed", 2)
+	tree.Blackboard().Set("allowed", 2)
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS with 2 successes needed, got %s", status)
+	}
+	tree.Blackboard().Set("needed", 3)
+	if status := tree.Tick(); status != core.NodeStatusFailure {
+		t.Fatalf("expected FAILURE with 3 successes needed, got %s", status)
+	}
+
+	// Without ports the defaults of the manifest apply: all must succeed
+	node, err := factory.CreateNode("Parallel", "Both", core.NodeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		child, _ := factory.CreateNode("AlwaysSuccess", "Child", core.NodeConfig{})
+		node.AddChild(child)
+	}
+	if status := NewBehaviorTree(node, core.NewBlackboard()).Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+}
+
+func TestBehaviorTreeFactory_ParallelSkipped(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	if err := factory.RegisterBehaviorTreeFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="All">
+    <Parallel success_count="-1" failure_count="1">
+      <AlwaysSuccess /><AlwaysSuccess _skipIf="true" />
+    </Parallel>
+  </BehaviorTree>
+  <BehaviorTree ID="Two">
+    <Parallel success_count="2" failure_count="1">
+      <AlwaysSuccess /><AlwaysSuccess _skipIf="true" />
+    </Parallel>
+  </BehaviorTree>
+</root>`); err != nil {
+		t.Fatal(err)
+	}
+
+	// The skipped children are not waited for when all must succeed
+	for id, want := range map[string]core.NodeStatus{"All": core.NodeStatusSuccess, "Two": core.NodeStatusFailure} {
+		tree, err := factory.CreateTree(id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := tree.Tick(); status != want {
+			t.Fatalf("%s: expected %s, got %s", id, want, status)
+		}
+	}
+}
+
+func TestBehaviorTreeFactory_RegisterHelpers(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	err := factory.RegisterSimpleAction("Say", func(node core.Node) core.NodeStatus {
+		message, err := core.GetInput[string](node, "message")
+		if err != nil {
+			return core.NodeStatusFailure
+		}
+		if err := node.Blackboard().Set("said", message); err != nil {
+			return core.NodeStatusFailure
+		}
+		return core.NodeStatusSuccess
+	}, core.PortsList{"message": core.InputPort("string", "what to say")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = factory.RegisterSimpleCondition("IsLoud", func(node core.Node) core.NodeStatus {
+		if said, _ := node.Blackboard().GetString("said"); said == "HELLO" {
+			return core.NodeStatusSuccess
+		}
+		return core.NodeStatusFailure
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = factory.RegisterSimpleDecorator("Invert", func(status core.NodeStatus, node core.Node) core.NodeStatus {
+		switch status {
+		case core.NodeStatusSuccess:
+			return core.NodeStatusFailure
+		case core.NodeStatusFailure:
+			return core.NodeStatusSuccess
+		}
+		return status
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterNodeType(factory, "Nap", actions.NewSleepNode); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, _ := factory.GetManifest("Nap"); manifest.Type != core.NodeTypeAction || manifest.Ports["msec"].TypeName != "uint" {
+		t.Fatalf("ports not read from ProvidedPorts: %+v", manifest)
+	}
+	if manifest := NodeManifest[*decorators.SubtreeNode]("SubTree"); manifest.Ports["_autoremap"].DefaultValue != "false" {
+		t.Fatalf("unexpected SubTree manifest %+v", manifest)
+	}
+
+	tree, err := NewXMLParser(factory).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <Say message="HELLO" />
+      <IsLoud />
+      <Invert><AlwaysFailure /></Invert>
+      <Nap msec="0" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+}
+
+// haltCountingAction stays RUNNING and counts its halts
+type haltCountingAction struct {
+	core.ActionNodeBase
+	halts int
+}
+
+func (n *haltCountingAction) Tick() core.NodeStatus { return core.NodeStatusRunning }
+
+func (n *haltCountingAction) Halt() { n.halts++ }
+
+func TestBehaviorTreeFactory_DecoratorsHaltChildOnce(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	var walk *haltCountingAction
+	err := factory.RegisterBuilder("Walk", core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: "Walk"},
+		func(name string, config core.NodeConfig) (core.Node, error) {
+			walk = &haltCountingAction{ActionNodeBase: core.NewActionNodeBase(name, config)}
+			return walk, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = factory.RegisterSimpleDecorator("Pass", func(status core.NodeStatus, node core.Node) core.NodeStatus {
+		return status
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, decorator := range []string{
+		`<Precondition if="true"><Walk /></Precondition>`,
+		`<Delay delay_msec="0"><Walk /></Delay>`,
+		`<Timeout msec="1000"><Walk /></Timeout>`,
+		`<ConsumeQueue queue="{waypoints}" popped_item="{waypoint}"><Walk /></ConsumeQueue>`,
+		`<Pass><Walk /></Pass>`,
+	} {
+		tree, err := NewXMLParser(factory).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">` + decorator + `</BehaviorTree>
+</root>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Blackboard().Set("waypoints", []string{"gate", "well"})
+		if status := tree.Tick(); status != core.NodeStatusRunning {
+			t.Fatalf("%s: expected RUNNING, got %s", decorator, status)
+		}
+		tree.RootNode().Halt()
+		if walk.halts != 1 {
+			t.Fatalf("%s: expected the child to be halted once, got %d halts", decorator, walk.halts)
+		}
+	}
+}
+
+func TestBehaviorTreeFactory_PreconditionElsePointer(t *testing.T) {
+	tree, err := NewXMLParser(NewBehaviorTreeFactory()).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Precondition if="false" else="{otherwise}"><AlwaysFailure /></Precondition>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []core.NodeStatus{core.NodeStatusSuccess, core.NodeStatusSkipped} {
+		tree.Blackboard().Set("otherwise", want)
+		if status := tree.Tick(); status != want {
+			t.Fatalf("expected %s, got %s", want, status)
+		}
+	}
+	tree.Blackboard().Unset("otherwise")
+	tree.Blackboard().Set("otherwise", "RUNNING")
+	if status := tree.Tick(); status != core.NodeStatusRunning {
+		t.Fatalf("expected the string entry to be parsed, got %s", status)
+	}
+}
+
+func TestBehaviorTreeFactory_TreeRegistry(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared/patrol.xml": {Data: []byte(`<root BTCPP_format="4">
+  <include path="walk.xml" />
+  <BehaviorTree ID="Patrol">
+    <SubTree ID="Walk" _autoremap="true" />
+  </BehaviorTree>
+</root>`)},
+		"shared/walk.xml": {Data: []byte(`<root BTCPP_format="4">
+  <BehaviorTree ID="Walk">
+    <Script code="steps += 1" />
+  </BehaviorTree>
+</root>`)},
+		"npc/guard.xml": {Data: []byte(`<root BTCPP_format="4">
+  <BehaviorTree ID="Guard">
+    <Sequence>
+      <SubTree ID="Patrol" _autoremap="true" />
+      <SubTree ID="Patrol" _autoremap="true" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)},
+	}
+
+	factory := NewBehaviorTreeFactory()
+	if err := factory.RegisterBehaviorTreeFromFS(fsys, "npc/*.xml", "shared/patrol.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.RegisterBehaviorTreeFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Merchant"><SubTree ID="Walk" _autoremap="true" /></BehaviorTree>
+</root>`); err != nil {
+		t.Fatal(err)
+	}
+	if ids := factory.RegisteredBehaviorTrees(); strings.Join(ids, ",") != "Guard,Merchant,Patrol,Walk" {
+		t.Fatalf("unexpected trees %v", ids)
+	}
+	if err := factory.RegisterBehaviorTreeFromFS(fsys, "missing/*.xml"); err == nil {
+		t.Fatalf("expected an error for a pattern matching no file")
+	}
+
+	// Trees are created concurrently, each with its own blackboard
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blackboard := core.NewBlackboard()
+			blackboard.Set("steps", 0)
+			tree, err := factory.CreateTree("Guard", blackboard)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if status := tree.Tick(); status != core.NodeStatusSuccess {
+				t.Errorf("expected SUCCESS, got %s", status)
+			}
+			if steps, _ := blackboard.Get("steps"); steps != 2 {
+				t.Errorf("expected 2 steps, got %v", steps)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := factory.CreateTree("Unknown", nil); err == nil {
+		t.Fatalf("expected an error for an unknown tree")
+	}
+	factory.ClearRegisteredBehaviorTrees()
+	if ids := factory.RegisteredBehaviorTrees(); len(ids) != 0 {
+		t.Fatalf("trees not cleared: %v", ids)
+	}
+}
@@ -0,0 +1,82 @@
+package behavior_tree
+
+import (
+	"github.com/actfuns/gamekit/behavior_tree/actions"
+	"github.com/actfuns/gamekit/behavior_tree/controls"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/decorators"
+)
+
+// builtinNode describes a node available under its BehaviorTree.CPP name
+type builtinNode struct {
+	manifest core.TreeNodeManifest
+	creator  TreeNodeCreator
+}
+
+// builtinNodes maps the standard node names to the controls, decorators and
+// actions packages. NewBehaviorTreeFactory registers all of them; their
+// ports are declared by the ProvidedPorts method of each node type.
+var builtinNodes = map[string]builtinNode{}
+
+func init() {
+	// Controls
+	addBuiltin("Sequence", controls.NewSequenceNode)
+	addBuiltin("SequenceWithMemory", controls.NewSequenceWithMemoryNode)
+	addBuiltin("ReactiveSequence", controls.NewReactiveSequence)
+	addBuiltin("Fallback", func(name string, config core.NodeConfig) *controls.FallbackNode {
+		return controls.NewFallbackNode(name, config, false)
+	})
+	addBuiltin("AsyncFallback", func(name string, config core.NodeConfig) *controls.FallbackNode {
+		return controls.NewFallbackNode(name, config, true)
+	})
+	addBuiltin("ReactiveFallback", controls.NewReactiveFallbackNode)
+	addBuiltin("Parallel", controls.NewParallelNodeFromConfig)
+	addBuiltin("ParallelAll", controls.NewParallelAllNode)
+	addBuiltin("IfThenElse", controls.NewIfThenElseNode)
+	addBuiltin("WhileDoElse", controls.NewWhileDoElseNode)
+	addBuiltin("Switch", controls.NewSwitchNode)
+	addBuiltin("ManualSelector", controls.NewManualSelectorNode)
+
+	// Decorators
+	addBuiltin("Inverter", decorators.NewInverterNode)
+	addBuiltin("ForceSuccess", decorators.NewForceSuccessNode)
+	addBuiltin("ForceFailure", decorators.NewForceFailureNode)
+	addBuiltin("KeepRunningUntilFailure", decorators.NewKeepRunningUntilFailureNode)
+	addBuiltin("Repeat", decorators.NewRepeatNode)
+	addBuiltin("RetryUntilSuccessful", func(name string, config core.NodeConfig) *decorators.RetryNode {
+		return decorators.NewRetryNode(name, config)
+	})
+	addBuiltin("Loop", decorators.NewLoopNode)
+	addBuiltin("Delay", decorators.NewDelayNode)
+	addBuiltin("Timeout", decorators.NewTimeoutNode)
+	addBuiltin("RunOnce", decorators.NewRunOnceNode)
+	addBuiltin("Precondition", decorators.NewScriptPrecondition)
+	addBuiltin("SkipUnlessUpdated", func(name string, config core.NodeConfig) *decorators.EntryUpdatedDecorator {
+		return decorators.NewEntryUpdatedDecorator(name, config, core.NodeStatusSkipped)
+	})
+	addBuiltin("WaitValueUpdate", func(name string, config core.NodeConfig) *decorators.EntryUpdatedDecorator {
+		return decorators.NewEntryUpdatedDecorator(name, config, core.NodeStatusRunning)
+	})
+	addBuiltin("ConsumeQueue", decorators.NewConsumeQueue)
+
+	// Actions
+	addBuiltin("AlwaysSuccess", actions.NewAlwaysSuccessNode)
+	addBuiltin("AlwaysFailure", actions.NewAlwaysFailureNode)
+	addBuiltin("Script", actions.NewScriptNode)
+	addBuiltin("ScriptCondition", actions.NewScriptCondition)
+	addBuiltin("SetBlackboard", actions.NewSetBlackboardNode)
+	addBuiltin("UnsetBlackboard", actions.NewUnsetBlackboardNode)
+	addBuiltin("Sleep", actions.NewSleepNode)
+	addBuiltin("PopFromQueue", actions.NewPopFromQueue)
+	addBuiltin("WasEntryUpdated", actions.NewEntryUpdatedAction)
+}
+
+// addBuiltin adds a builtin node with the manifest of its type
+func addBuiltin[T core.Node](registrationID string, constructor func(string, core.NodeConfig) T) {
+	builtinNodes[registrationID] = builtinNode{
+		manifest: NodeManifest[T](registrationID),
+		creator: func(name string, config core.NodeConfig) (core.Node, error) {
+			return constructor(name, config), nil
+		},
+	}
+}
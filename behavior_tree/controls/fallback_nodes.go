@@ -34,7 +34,7 @@ func (fn *FallbackNode) Tick() core.NodeStatus {
 	for fn.currentChildIdx < childrenCount {
 		currentChild := children[fn.currentChildIdx]
 		prevStatus := currentChild.Status()
-		childStatus := currentChild.Tick()
+		childStatus := currentChild.ExecuteTick(fn.Context())
 
 		switch childStatus {
 		case core.NodeStatusRunning:
@@ -48,7 +48,7 @@ func (fn *FallbackNode) Tick() core.NodeStatus {
 			// For async mode, return running to make it interruptible
 			if fn.asynch && fn.RequiresWakeUp() && prevStatus == core.NodeStatusIdle &&
 				fn.currentChildIdx < childrenCount {
-				// In Go implementation, we don't have emitWakeUpSignal, so we just return running
+				fn.EmitWakeUpSignal()
 				return core.NodeStatusRunning
 			}
 		case core.NodeStatusSkipped:
@@ -108,7 +108,7 @@ func (rfn *ReactiveFallbackNode) Tick() core.NodeStatus {
 
 	for index := 0; index < len(children); index++ {
 		currentChild := children[index]
-		childStatus := currentChild.Tick()
+		childStatus := currentChild.ExecuteTick(rfn.Context())
 
 		allSkipped = allSkipped && (childStatus == core.NodeStatusSkipped)
 
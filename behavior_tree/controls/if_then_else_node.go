@@ -28,14 +28,14 @@ func (node *IfThenElseNode) Tick() core.NodeStatus {
 	elseBranch := children[2]
 
 	// Execute condition
-	conditionStatus := condition.ExecuteTick()
-	if conditionStatus == core.NodeStatusRunning {
-		return core.NodeStatusRunning
+	conditionStatus := condition.ExecuteTick(node.Context())
+	if conditionStatus == core.NodeStatusRunning || conditionStatus == core.NodeStatusSkipped {
+		return conditionStatus
 	}
 
 	if conditionStatus == core.NodeStatusSuccess {
 		// Condition succeeded, execute then branch
-		thenStatus := thenBranch.ExecuteTick()
+		thenStatus := thenBranch.ExecuteTick(node.Context())
 		if thenStatus == core.NodeStatusRunning {
 			return core.NodeStatusRunning
 		}
@@ -44,7 +44,7 @@ func (node *IfThenElseNode) Tick() core.NodeStatus {
 		return thenStatus
 	} else {
 		// Condition failed, execute else branch
-		elseStatus := elseBranch.ExecuteTick()
+		elseStatus := elseBranch.ExecuteTick(node.Context())
 		if elseStatus == core.NodeStatusRunning {
 			return core.NodeStatusRunning
 		}
@@ -1,10 +1,6 @@
 package controls
 
-import (
-	"strconv"
-
-	"github.com/actfuns/gamekit/behavior_tree/core"
-)
+import "github.com/actfuns/gamekit/behavior_tree/core"
 
 // ManualSelectorNode allows manual selection of which child to execute
 type ManualSelectorNode struct {
@@ -27,6 +23,14 @@ func NewManualSelectorNode(name string, config core.NodeConfig) *ManualSelectorN
 	return node
 }
 
+// ProvidedPorts returns the ports provided by ManualSelectorNode
+func (node *ManualSelectorNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"REPEAT_LAST_SELECTION": core.InputPort("bool", "repeat the last selected child").WithDefault(false),
+		"SELECTED_CHILD_INDEX":  core.InputPort("int", "index of the child to execute, -1 waits for a selection").WithDefault(-1),
+	}
+}
+
 // Tick executes the manual selection logic
 func (node *ManualSelectorNode) Tick() core.NodeStatus {
 	children := node.Children()
@@ -34,25 +38,13 @@ func (node *ManualSelectorNode) Tick() core.NodeStatus {
 		return node.selectStatus()
 	}
 
-	// Get input for repeat last selection
-	repeatLast := false
-	if value, ok := node.GetInput("REPEAT_LAST_SELECTION"); ok {
-		// 尝试转换为bool值
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			repeatLast = boolValue
-		}
-	}
-	node.repeatLastSelection = repeatLast
+	// Get input for repeat last selection, both ports are optional
+	repeatLast, err := core.GetInput[bool](node, "REPEAT_LAST_SELECTION")
+	node.repeatLastSelection = err == nil && repeatLast
 
 	// Get selected child index from input
-	selectedIndex := -1
-	if value, ok := node.GetInput("SELECTED_CHILD_INDEX"); ok {
-		// 尝试转换为int值
-		if intValue, err := strconv.Atoi(value); err == nil {
-			selectedIndex = intValue
-		}
-	}
-	if selectedIndex >= 0 && selectedIndex < len(children) {
+	selectedIndex, err := core.GetInput[int](node, "SELECTED_CHILD_INDEX")
+	if err == nil && selectedIndex >= 0 && selectedIndex < len(children) {
 		node.selectedChildIndex = selectedIndex
 	}
 
@@ -68,7 +60,7 @@ func (node *ManualSelectorNode) Tick() core.NodeStatus {
 
 	// Execute the selected child
 	selectedChild := children[node.selectedChildIndex]
-	status := selectedChild.ExecuteTick()
+	status := selectedChild.ExecuteTick(node.Context())
 
 	if status == core.NodeStatusRunning {
 		node.runningChildIdx = node.selectedChildIndex
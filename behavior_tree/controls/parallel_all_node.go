@@ -2,7 +2,6 @@ package controls
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
@@ -24,6 +23,13 @@ func NewParallelAllNode(name string, config core.NodeConfig) *ParallelAllNode {
 	return node
 }
 
+// ProvidedPorts returns the ports provided by ParallelAllNode
+func (node *ParallelAllNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"max_failures": core.InputPort("int", "number of failed children that makes the node fail").WithDefault(1),
+	}
+}
+
 // SetFailureThreshold sets the failure threshold
 func (node *ParallelAllNode) SetFailureThreshold(threshold int) {
 	node.failureThreshold = threshold
@@ -37,15 +43,9 @@ func (node *ParallelAllNode) Tick() core.NodeStatus {
 	}
 
 	// Get max_failures parameter
-	maxFailures := 0
-	if value, ok := node.GetInput("max_failures"); ok {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			maxFailures = intValue
-		} else {
-			panic(fmt.Sprintf("Invalid parameter [max_failures] in ParallelAllNode: %v", err))
-		}
-	} else {
-		panic("Missing parameter [max_failures] in ParallelAllNode")
+	maxFailures, err := core.GetInput[int](node, "max_failures")
+	if err != nil {
+		panic(fmt.Sprintf("Invalid parameter [max_failures] in ParallelAllNode: %v", err))
 	}
 	node.SetFailureThreshold(maxFailures)
 
@@ -62,6 +62,7 @@ func (node *ParallelAllNode) Tick() core.NodeStatus {
 	failureCount := 0
 	successCount := 0
 	runningCount := 0
+	skippedCount := 0
 
 	for i, child := range children {
 		if node.completedList[i] {
@@ -72,12 +73,14 @@ func (node *ParallelAllNode) Tick() core.NodeStatus {
 				successCount++
 			case core.NodeStatusFailure:
 				failureCount++
+			case core.NodeStatusSkipped:
+				skippedCount++
 			}
 			continue
 		}
 
 		// Execute child
-		status := child.ExecuteTick()
+		status := child.ExecuteTick(node.Context())
 		switch status {
 		case core.NodeStatusSuccess:
 			node.completedList[i] = true
@@ -87,9 +90,18 @@ func (node *ParallelAllNode) Tick() core.NodeStatus {
 			failureCount++
 		case core.NodeStatusRunning:
 			runningCount++
+		case core.NodeStatusSkipped:
+			node.completedList[i] = true
+			skippedCount++
 		}
 	}
 
+	if skippedCount == len(children) {
+		node.ResetChildren()
+		node.completedList = make(map[int]bool)
+		return core.NodeStatusSkipped
+	}
+
 	// Check termination conditions
 	if failureCount >= node.failureThreshold {
 		// Too many failures, halt all children and return failure
@@ -100,8 +112,9 @@ func (node *ParallelAllNode) Tick() core.NodeStatus {
 		return core.NodeStatusFailure
 	}
 
-	if successCount == len(children) {
-		// All children succeeded
+	if successCount+skippedCount == len(children) {
+		// All children succeeded or were skipped
+		node.ResetChildren()
 		node.completedList = make(map[int]bool) // Reset for next execution
 		return core.NodeStatusSuccess
 	}
@@ -1,6 +1,10 @@
 package controls
 
-import "github.com/actfuns/gamekit/behavior_tree/core"
+import (
+	"fmt"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
 
 // ParallelNode executes all children in parallel until thresholds are reached
 type ParallelNode struct {
@@ -9,9 +13,12 @@ type ParallelNode struct {
 	failureThreshold int
 	activeChildren   []bool
 	completedList    map[int]bool
+	readFromPorts    bool
 }
 
-// NewParallelNode creates a new parallel node with thresholds
+// NewParallelNode creates a new parallel node with thresholds.
+// A negative threshold counts from the number of children that were not
+// skipped: -1 means all of them.
 func NewParallelNode(name string, config core.NodeConfig, successThreshold, failureThreshold int) *ParallelNode {
 	return &ParallelNode{
 		ControlNode:      core.NewControlNode(name, config),
@@ -22,8 +29,36 @@ func NewParallelNode(name string, config core.NodeConfig, successThreshold, fail
 	}
 }
 
+// NewParallelNodeFromConfig creates a new parallel node reading its
+// thresholds from the success_count and failure_count ports on every tick
+func NewParallelNodeFromConfig(name string, config core.NodeConfig) *ParallelNode {
+	node := NewParallelNode(name, config, -1, 1)
+	node.readFromPorts = true
+	return node
+}
+
+// ProvidedPorts returns the ports provided by ParallelNode
+func (node *ParallelNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"success_count": core.InputPort("int", "number of children that must succeed, -1 means all").WithDefault(-1),
+		"failure_count": core.InputPort("int", "number of children that must fail, -1 means all").WithDefault(1),
+	}
+}
+
 // Tick executes the parallel logic
 func (node *ParallelNode) Tick() core.NodeStatus {
+	if node.readFromPorts {
+		successCount, err := core.GetInput[int](node, "success_count")
+		if err != nil {
+			panic(fmt.Sprintf("Invalid parameter [success_count] in ParallelNode: %v", err))
+		}
+		failureCount, err := core.GetInput[int](node, "failure_count")
+		if err != nil {
+			panic(fmt.Sprintf("Invalid parameter [failure_count] in ParallelNode: %v", err))
+		}
+		node.successThreshold, node.failureThreshold = successCount, failureCount
+	}
+
 	children := node.Children()
 	if len(children) == 0 {
 		return core.NodeStatusSuccess
@@ -45,30 +80,43 @@ func (node *ParallelNode) Tick() core.NodeStatus {
 	successCount := 0
 	failureCount := 0
 	runningCount := 0
+	skippedCount := 0
 
-	// Execute all active children
+	// Execute all active children, completed children keep their last status
 	for i, child := range children {
-		if !node.activeChildren[i] {
-			continue
+		status := child.Status()
+		if node.activeChildren[i] {
+			status = child.ExecuteTick(node.Context())
+			if status != core.NodeStatusRunning {
+				node.completedList[i] = true
+				node.activeChildren[i] = false
+			}
 		}
 
-		status := child.ExecuteTick()
 		switch status {
 		case core.NodeStatusSuccess:
-			node.completedList[i] = true
-			node.activeChildren[i] = false
 			successCount++
 		case core.NodeStatusFailure:
-			node.completedList[i] = true
-			node.activeChildren[i] = false
 			failureCount++
 		case core.NodeStatusRunning:
 			runningCount++
+		case core.NodeStatusSkipped:
+			skippedCount++
 		}
 	}
 
-	// Check termination conditions
-	if successCount >= node.successThreshold {
+	if skippedCount == len(children) {
+		node.ResetChildren()
+		node.resetState()
+		return core.NodeStatusSkipped
+	}
+
+	// Check termination conditions, a negative threshold counts the children
+	// that were not skipped
+	successThreshold := resolveThreshold(node.successThreshold, len(children)-skippedCount)
+	failureThreshold := resolveThreshold(node.failureThreshold, len(children)-skippedCount)
+
+	if successCount >= successThreshold {
 		// Success threshold reached
 		for _, child := range children {
 			child.HaltAndReset()
@@ -77,7 +125,7 @@ func (node *ParallelNode) Tick() core.NodeStatus {
 		return core.NodeStatusSuccess
 	}
 
-	if failureCount >= node.failureThreshold {
+	if failureCount >= failureThreshold {
 		// Failure threshold reached
 		for _, child := range children {
 			child.HaltAndReset()
@@ -86,10 +134,30 @@ func (node *ParallelNode) Tick() core.NodeStatus {
 		return core.NodeStatusFailure
 	}
 
+	if len(children)-skippedCount-failureCount < successThreshold {
+		// Skipped or failed children make the success threshold unreachable
+		for _, child := range children {
+			child.HaltAndReset()
+		}
+		node.resetState()
+		return core.NodeStatusFailure
+	}
+
 	// Still running
 	return core.NodeStatusRunning
 }
 
+// resolveThreshold converts a negative threshold to a count of children
+func resolveThreshold(threshold, childrenCount int) int {
+	if threshold < 0 {
+		threshold = childrenCount + threshold + 1
+		if threshold < 0 {
+			threshold = 0
+		}
+	}
+	return threshold
+}
+
 // resetState resets the internal state for next execution
 func (node *ParallelNode) resetState() {
 	node.activeChildren = make([]bool, 0)
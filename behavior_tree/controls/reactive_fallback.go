@@ -3,30 +3,13 @@ package controls
 import "github.com/actfuns/gamekit/behavior_tree/core"
 
 // ReactiveFallback 反应式回退节点
-type ReactiveFallback struct {
-	core.ControlNode
-}
+//
+// Deprecated: 使用 ReactiveFallbackNode，即注册为 "ReactiveFallback" 的节点。
+type ReactiveFallback = ReactiveFallbackNode
 
 // NewReactiveFallback 创建新的ReactiveFallback实例
+//
+// Deprecated: 使用 NewReactiveFallbackNode。
 func NewReactiveFallback(name string, config core.NodeConfig) *ReactiveFallback {
-	node := &ReactiveFallback{}
-	node.ControlNode = core.NewControlNode(name, config)
-	return node
-}
-
-// Tick 执行节点逻辑
-func (rf *ReactiveFallback) Tick() core.NodeStatus {
-	children := rf.Children()
-	if len(children) == 0 {
-		return core.NodeStatusSuccess
-	}
-
-	for _, child := range children {
-		status := child.Tick()
-		if status != core.NodeStatusFailure {
-			return status
-		}
-	}
-
-	return core.NodeStatusFailure
+	return NewReactiveFallbackNode(name, config)
 }
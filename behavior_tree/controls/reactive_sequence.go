@@ -3,6 +3,7 @@ package controls
 import "github.com/actfuns/gamekit/behavior_tree/core"
 
 // ReactiveSequence 反应式序列节点
+// 每次Tick都从第一个子节点重新开始执行；有子节点运行时重置其他子节点
 type ReactiveSequence struct {
 	core.ControlNode
 }
@@ -21,12 +22,33 @@ func (rs *ReactiveSequence) Tick() core.NodeStatus {
 		return core.NodeStatusSuccess
 	}
 
-	for _, child := range children {
-		status := child.Tick()
-		if status != core.NodeStatusSuccess {
-			return status
+	allSkipped := true
+	for index, child := range children {
+		status := child.ExecuteTick(rs.Context())
+		allSkipped = allSkipped && (status == core.NodeStatusSkipped)
+
+		switch status {
+		case core.NodeStatusRunning:
+			// 重置其他子节点，保证下次Tick时它们处于IDLE状态
+			for i, other := range children {
+				if i != index {
+					other.HaltAndReset()
+				}
+			}
+			return core.NodeStatusRunning
+		case core.NodeStatusFailure:
+			rs.ResetChildren()
+			return core.NodeStatusFailure
+		case core.NodeStatusSkipped:
+			child.HaltAndReset()
+		case core.NodeStatusIdle:
+			return core.NodeStatusFailure
 		}
 	}
 
+	rs.ResetChildren()
+	if allSkipped {
+		return core.NodeStatusSkipped
+	}
 	return core.NodeStatusSuccess
 }
@@ -31,7 +31,7 @@ func (sn *SequenceNode) Tick() core.NodeStatus {
 
 	for sn.currentChildIdx < childrenCount {
 		currentChild := children[sn.currentChildIdx]
-		childStatus := currentChild.Tick()
+		childStatus := currentChild.ExecuteTick(sn.Context())
 
 		switch childStatus {
 		case core.NodeStatusRunning:
@@ -6,6 +6,7 @@ import "github.com/actfuns/gamekit/behavior_tree/core"
 type SequenceWithMemoryNode struct {
 	core.ControlNode
 	currentChild int
+	skippedCount int
 }
 
 // NewSequenceWithMemoryNode creates a new sequence with memory node
@@ -24,10 +25,14 @@ func (node *SequenceWithMemoryNode) Tick() core.NodeStatus {
 		return core.NodeStatusSuccess
 	}
 
+	if node.Status() == core.NodeStatusIdle {
+		node.skippedCount = 0
+	}
+
 	// Start from the current child
 	for i := node.currentChild; i < len(children); i++ {
 		child := children[i]
-		status := child.ExecuteTick()
+		status := child.ExecuteTick(node.Context())
 
 		switch status {
 		case core.NodeStatusRunning:
@@ -42,17 +47,26 @@ func (node *SequenceWithMemoryNode) Tick() core.NodeStatus {
 		case core.NodeStatusSuccess:
 			// Continue to next child
 			continue
+		case core.NodeStatusSkipped:
+			node.skippedCount++
 		}
 	}
 
-	// All children succeeded
+	// All children succeeded or were skipped
+	allSkipped := node.skippedCount == len(children)
 	node.currentChild = 0
+	node.skippedCount = 0
+	node.ResetChildren()
+	if allSkipped {
+		return core.NodeStatusSkipped
+	}
 	return core.NodeStatusSuccess
 }
 
 // Halt stops execution and resets the node
 func (node *SequenceWithMemoryNode) Halt() {
 	node.currentChild = 0
+	node.skippedCount = 0
 	node.ResetChildren()
 	node.ControlNode.Halt()
 }
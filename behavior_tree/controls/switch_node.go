@@ -21,6 +21,13 @@ func NewSwitchNode(name string, config core.NodeConfig) *SwitchNode {
 	return node
 }
 
+// ProvidedPorts returns the ports provided by SwitchNode
+func (node *SwitchNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"switch": core.InputPort("string", "name of the child to execute").AsRequired(),
+	}
+}
+
 // Tick executes the switch logic
 func (node *SwitchNode) Tick() core.NodeStatus {
 	children := node.Children()
@@ -29,11 +36,9 @@ func (node *SwitchNode) Tick() core.NodeStatus {
 	}
 
 	// Get the switch value from input
-	switchValue := ""
-	if value, ok := node.GetInput("switch"); ok {
-		switchValue = value
-	} else {
-		panic("Missing required input [switch] in SwitchNode")
+	switchValue, err := core.GetInput[string](node, "switch")
+	if err != nil {
+		panic(fmt.Sprintf("Missing required input [switch] in SwitchNode: %v", err))
 	}
 
 	// Find the child with matching name
@@ -53,7 +58,7 @@ func (node *SwitchNode) Tick() core.NodeStatus {
 	if node.runningChildIdx >= 0 {
 		if node.runningChildIdx == selectedIndex {
 			// Continue executing the same child
-			status := children[selectedIndex].ExecuteTick()
+			status := children[selectedIndex].ExecuteTick(node.Context())
 			if status != core.NodeStatusRunning {
 				node.runningChildIdx = -1
 			}
@@ -66,7 +71,7 @@ func (node *SwitchNode) Tick() core.NodeStatus {
 	}
 
 	// Execute the selected child
-	status := children[selectedIndex].ExecuteTick()
+	status := children[selectedIndex].ExecuteTick(node.Context())
 	if status == core.NodeStatusRunning {
 		node.runningChildIdx = selectedIndex
 	}
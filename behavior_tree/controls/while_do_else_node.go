@@ -26,20 +26,20 @@ func (node *WhileDoElseNode) Tick() core.NodeStatus {
 
 	condition := children[0]
 	thenBranch := children[1]
-	var elseBranch core.TreeNode = nil
+	var elseBranch core.Node
 	if len(children) == 3 {
 		elseBranch = children[2]
 	}
 
 	// Execute condition
-	conditionStatus := condition.ExecuteTick()
-	if conditionStatus == core.NodeStatusRunning {
-		return core.NodeStatusRunning
+	conditionStatus := condition.ExecuteTick(node.Context())
+	if conditionStatus == core.NodeStatusRunning || conditionStatus == core.NodeStatusSkipped {
+		return conditionStatus
 	}
 
 	if conditionStatus == core.NodeStatusSuccess {
 		// Condition succeeded, execute then branch
-		thenStatus := thenBranch.ExecuteTick()
+		thenStatus := thenBranch.ExecuteTick(node.Context())
 		if thenStatus == core.NodeStatusRunning {
 			return core.NodeStatusRunning
 		}
@@ -51,7 +51,7 @@ func (node *WhileDoElseNode) Tick() core.NodeStatus {
 	} else {
 		// Condition failed, execute else branch if it exists
 		if elseBranch != nil {
-			elseStatus := elseBranch.ExecuteTick()
+			elseStatus := elseBranch.ExecuteTick(node.Context())
 			if elseStatus == core.NodeStatusRunning {
 				return core.NodeStatusRunning
 			}
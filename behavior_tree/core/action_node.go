@@ -1,5 +1,11 @@
 package core
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 // ActionNodeBase is the base class for all action nodes
 type ActionNodeBase struct {
 	TreeNode
@@ -39,13 +45,19 @@ func (an *ActionNode) Tick() NodeStatus {
 	return NodeStatusSuccess
 }
 
-// AsyncActionNode is an action node that can run asynchronously
+// AsyncActionNode is an action node calling its tick function synchronously,
+// like ActionNode.
+//
+// Deprecated: despite its name it does not run asynchronously, use
+// ThreadedActionNode to run blocking work in a goroutine.
 type AsyncActionNode struct {
 	ActionNodeBase
 	tickFunc func() NodeStatus
 }
 
 // NewAsyncActionNode creates a new async action node
+//
+// Deprecated: use NewThreadedActionNode.
 func NewAsyncActionNode(name string, config NodeConfig, tickFunc func() NodeStatus) AsyncActionNode {
 	return AsyncActionNode{
 		ActionNodeBase: NewActionNodeBase(name, config),
@@ -61,12 +73,16 @@ func (aan *AsyncActionNode) Tick() NodeStatus {
 	return NodeStatusSuccess
 }
 
-// StatefulActionNode is an action node that maintains state between ticks
+// StatefulActionNode is an action node that maintains state between ticks.
+// The callbacks receive the context of the tick, to see the deadline and the
+// cancellation of the tick, e.g. to bound a request to another service.
 type StatefulActionNode struct {
 	ActionNodeBase
-	onStartFunc   func() NodeStatus
-	onRunningFunc func() NodeStatus
-	onHaltedFunc  func()
+	onStartFunc   func(ctx context.Context) NodeStatus
+	onRunningFunc func(ctx context.Context) NodeStatus
+	onHaltedFunc  func(ctx context.Context) error
+	// haltErr is the error of the last Halt
+	haltErr error
 }
 
 // NewStatefulActionNode creates a new stateful action node
@@ -74,6 +90,31 @@ func NewStatefulActionNode(name string, config NodeConfig,
 	startFunc func() NodeStatus,
 	runningFunc func() NodeStatus,
 	haltedFunc func()) StatefulActionNode {
+	var onStart, onRunning func(context.Context) NodeStatus
+	var onHalted func(context.Context) error
+	if startFunc != nil {
+		onStart = func(context.Context) NodeStatus { return startFunc() }
+	}
+	if runningFunc != nil {
+		onRunning = func(context.Context) NodeStatus { return runningFunc() }
+	}
+	if haltedFunc != nil {
+		onHalted = func(context.Context) error {
+			haltedFunc()
+			return nil
+		}
+	}
+	return NewStatefulActionNodeWithContext(name, config, onStart, onRunning, onHalted)
+}
+
+// NewStatefulActionNodeWithContext creates a new stateful action node whose
+// callbacks receive the context of the tick. haltedFunc cleans up the action
+// when it is halted while RUNNING; it receives the context of the last tick
+// without its cancellation, and its error is reported by HaltError.
+func NewStatefulActionNodeWithContext(name string, config NodeConfig,
+	startFunc func(ctx context.Context) NodeStatus,
+	runningFunc func(ctx context.Context) NodeStatus,
+	haltedFunc func(ctx context.Context) error) StatefulActionNode {
 	return StatefulActionNode{
 		ActionNodeBase: NewActionNodeBase(name, config),
 		onStartFunc:    startFunc,
@@ -82,12 +123,17 @@ func NewStatefulActionNode(name string, config NodeConfig,
 	}
 }
 
-// Tick executes the stateful action
+// Tick executes the stateful action. The action is not started once the
+// context of the tick is done: it fails instead.
 func (san *StatefulActionNode) Tick() NodeStatus {
+	ctx := san.Context()
 	switch san.Status() {
 	case NodeStatusIdle:
+		if ctx.Err() != nil {
+			return NodeStatusFailure
+		}
 		if san.onStartFunc != nil {
-			status := san.onStartFunc()
+			status := san.onStartFunc(ctx)
 			if status == NodeStatusRunning {
 				san.SetStatus(NodeStatusRunning)
 			}
@@ -97,7 +143,7 @@ func (san *StatefulActionNode) Tick() NodeStatus {
 
 	case NodeStatusRunning:
 		if san.onRunningFunc != nil {
-			return san.onRunningFunc()
+			return san.onRunningFunc(ctx)
 		}
 		return NodeStatusSuccess
 
@@ -106,9 +152,133 @@ func (san *StatefulActionNode) Tick() NodeStatus {
 	}
 }
 
-// Halt handles halting the stateful action
+// Halt handles halting the stateful action. The halted callback only runs
+// if the action is RUNNING, so halting it twice cleans up once.
 func (san *StatefulActionNode) Halt() {
-	if san.onHaltedFunc != nil {
-		san.onHaltedFunc()
+	san.haltErr = nil
+	if san.Status() == NodeStatusRunning && san.onHaltedFunc != nil {
+		san.haltErr = san.onHaltedFunc(context.WithoutCancel(san.Context()))
+	}
+}
+
+// HaltError returns the error of the cleanup made by the last Halt
+func (san *StatefulActionNode) HaltError() error {
+	return san.haltErr
+}
+
+// ThreadedActionNode runs its work function in its own goroutine, for
+// blocking calls such as database or file accesses. The node returns RUNNING
+// while the work runs; once it returns, the node wakes up the tree and its
+// next tick returns the result of the work. A panic of the work is recovered
+// and the node fails.
+//
+// The halt is cooperative: Halt cancels the context given to the work and
+// waits until the work returns.
+type ThreadedActionNode struct {
+	ActionNodeBase
+	work func(ctx context.Context) (NodeStatus, error)
+	// cancel and done are set while the work runs
+	cancel context.CancelFunc
+	done   chan struct{}
+	// result and workErr are written by the work goroutine before done is
+	// closed
+	result  NodeStatus
+	workErr error
+	// err is the error of the last completed work
+	err     error
+	haltErr error
+}
+
+// NewThreadedActionNode creates a new threaded action node. work receives a
+// context done when the node is halted, or when the context of the tick that
+// started it is done. It must return SUCCESS or FAILURE; its error is
+// reported by Err.
+func NewThreadedActionNode(name string, config NodeConfig,
+	work func(ctx context.Context) (NodeStatus, error)) ThreadedActionNode {
+	return ThreadedActionNode{
+		ActionNodeBase: NewActionNodeBase(name, config),
+		work:           work,
+	}
+}
+
+// Tick starts the work, or returns its result once it completed
+func (tan *ThreadedActionNode) Tick() NodeStatus {
+	if tan.done == nil {
+		if tan.Context().Err() != nil {
+			return NodeStatusFailure
+		}
+		tan.start()
+		return NodeStatusRunning
+	}
+
+	select {
+	case <-tan.done:
+		tan.finish()
+		tan.err = tan.workErr
+		return tan.result
+	default:
+		return NodeStatusRunning
+	}
+}
+
+// start runs the work in a new goroutine
+func (tan *ThreadedActionNode) start() {
+	ctx, cancel := context.WithCancel(tan.Context())
+	done := make(chan struct{})
+	tan.cancel, tan.done = cancel, done
+	tan.err = nil
+	go func() {
+		// The tree is woken up once the result can be collected
+		defer tan.EmitWakeUpSignal()
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				tan.result = NodeStatusFailure
+				tan.workErr = fmt.Errorf("%s panicked: %v", tan.Name(), r)
+			}
+		}()
+		tan.result, tan.workErr = NodeStatusSuccess, nil
+		if tan.work != nil {
+			tan.result, tan.workErr = tan.work(ctx)
+		}
+		if tan.result != NodeStatusSuccess && tan.result != NodeStatusFailure {
+			if tan.workErr == nil {
+				tan.workErr = fmt.Errorf("%s returned %s, expected SUCCESS or FAILURE", tan.Name(), tan.result)
+			}
+			tan.result = NodeStatusFailure
+		}
+	}()
+}
+
+// finish releases the context of the completed work
+func (tan *ThreadedActionNode) finish() {
+	tan.cancel()
+	tan.cancel, tan.done = nil, nil
+}
+
+// Halt requests the work to stop and waits until it returns. An error of
+// the work other than the cancellation of its context is reported by
+// HaltError.
+func (tan *ThreadedActionNode) Halt() {
+	tan.haltErr = nil
+	if tan.done == nil {
+		return
 	}
+	tan.cancel()
+	<-tan.done
+	tan.finish()
+	if err := tan.workErr; err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		tan.haltErr = tan.workErr
+	}
+}
+
+// Err returns the error of the last completed work: returned by the work,
+// or describing its panic or its invalid status
+func (tan *ThreadedActionNode) Err() error {
+	return tan.err
+}
+
+// HaltError returns the error of the work stopped by the last Halt
+func (tan *ThreadedActionNode) HaltError() error {
+	return tan.haltErr
 }
@@ -1,51 +1,260 @@
 package core
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
 )
 
-// Any represents a type-safe container for any value
+// Any represents a type-safe container for any value. Booleans and numbers
+// of predeclared types are also kept as a scripting.Scalar, so that they
+// can be stored and read without boxing them in an interface{}.
 type Any struct {
-	value interface{}
+	// value is nil for an Any created by AnyOf from a scalar
+	value  interface{}
+	scalar scripting.Scalar
 }
 
 // NewAny creates a new Any from a value
 func NewAny(value interface{}) Any {
-	return Any{value: value}
+	scalar, _ := scripting.ScalarOf(value)
+	return Any{value: value, scalar: scalar}
+}
+
+// AnyOf creates a new Any from a value of type T, without allocating when
+// T is a predeclared boolean or numeric type
+func AnyOf[T any](value T) Any {
+	var scalar scripting.Scalar
+	switch v := any(&value).(type) {
+	case *bool:
+		scalar = scripting.BoolScalar(*v)
+	case *int:
+		scalar = scripting.Scalar{Kind: reflect.Int, Bits: uint64(*v)}
+	case *int8:
+		scalar = scripting.Scalar{Kind: reflect.Int8, Bits: uint64(*v)}
+	case *int16:
+		scalar = scripting.Scalar{Kind: reflect.Int16, Bits: uint64(*v)}
+	case *int32:
+		scalar = scripting.Scalar{Kind: reflect.Int32, Bits: uint64(*v)}
+	case *int64:
+		scalar = scripting.Scalar{Kind: reflect.Int64, Bits: uint64(*v)}
+	case *uint:
+		scalar = scripting.Scalar{Kind: reflect.Uint, Bits: uint64(*v)}
+	case *uint8:
+		scalar = scripting.Scalar{Kind: reflect.Uint8, Bits: uint64(*v)}
+	case *uint16:
+		scalar = scripting.Scalar{Kind: reflect.Uint16, Bits: uint64(*v)}
+	case *uint32:
+		scalar = scripting.Scalar{Kind: reflect.Uint32, Bits: uint64(*v)}
+	case *uint64:
+		scalar = scripting.Scalar{Kind: reflect.Uint64, Bits: *v}
+	case *float32:
+		scalar = scripting.Scalar{Kind: reflect.Float32, Bits: math.Float64bits(float64(*v))}
+	case *float64:
+		scalar = scripting.Scalar{Kind: reflect.Float64, Bits: math.Float64bits(*v)}
+	default:
+		return NewAny(value)
+	}
+	return Any{scalar: scalar}
 }
 
 // Value returns the contained value
 func (a Any) Value() interface{} {
+	if a.value == nil && a.scalar.IsValid() {
+		return a.scalar.Interface()
+	}
 	return a.value
 }
 
 // Type returns the type of the contained value
 func (a Any) Type() reflect.Type {
+	if a.scalar.IsValid() {
+		return a.scalar.Type()
+	}
 	if a.value == nil {
 		return nil
 	}
 	return reflect.TypeOf(a.value)
 }
 
-// Entry represents a blackboard entry with value and type info
+// isNil tells if the Any contains no value
+func (a Any) isNil() bool {
+	return a.value == nil && !a.scalar.IsValid()
+}
+
+// AnyCast converts the contained value to T, parsing strings with the
+// registered converters
+func AnyCast[T any](a Any) (T, error) {
+	if a.scalar.IsValid() {
+		if result, ok := scalarAs[T](a.scalar); ok {
+			return result, nil
+		}
+	}
+	return castValue[T](a.Value())
+}
+
+// scalarAs converts a scalar to T if T is a predeclared boolean or numeric
+// type, with the rules of castValue
+func scalarAs[T any](scalar scripting.Scalar) (T, bool) {
+	var result T
+	var kind reflect.Kind
+	switch any(&result).(type) {
+	case *bool:
+		if scalar.Kind != reflect.Bool {
+			return result, false
+		}
+		kind = reflect.Bool
+	case *int:
+		kind = reflect.Int
+	case *int8:
+		kind = reflect.Int8
+	case *int16:
+		kind = reflect.Int16
+	case *int32:
+		kind = reflect.Int32
+	case *int64:
+		kind = reflect.Int64
+	case *uint:
+		kind = reflect.Uint
+	case *uint8:
+		kind = reflect.Uint8
+	case *uint16:
+		kind = reflect.Uint16
+	case *uint32:
+		kind = reflect.Uint32
+	case *uint64:
+		kind = reflect.Uint64
+	case *float32:
+		kind = reflect.Float32
+	case *float64:
+		kind = reflect.Float64
+	default:
+		return result, false
+	}
+	converted, err := scalar.ConvertExact(kind)
+	if err != nil {
+		return result, false
+	}
+	switch p := any(&result).(type) {
+	case *bool:
+		*p = converted.Bool()
+	case *int:
+		*p = int(converted.Int())
+	case *int8:
+		*p = int8(converted.Int())
+	case *int16:
+		*p = int16(converted.Int())
+	case *int32:
+		*p = int32(converted.Int())
+	case *int64:
+		*p = converted.Int()
+	case *uint:
+		*p = uint(converted.Uint())
+	case *uint8:
+		*p = uint8(converted.Uint())
+	case *uint16:
+		*p = uint16(converted.Uint())
+	case *uint32:
+		*p = uint32(converted.Uint())
+	case *uint64:
+		*p = converted.Uint()
+	case *float32:
+		*p = float32(converted.Float())
+	case *float64:
+		*p = converted.Float()
+	}
+	return result, true
+}
+
+// Entry represents a blackboard entry with value and type info.
+// SequenceID grows every time the entry is written and Stamp records when.
 type Entry struct {
 	Value      Any
 	Info       TypeInfo
 	SequenceID uint64
+	Stamp      Timestamp
 }
 
 // TypeInfo contains type information
 type TypeInfo struct {
 	TypeName string
+	// Type is the type every value written to the entry must have, nil
+	// until the first value is written
+	Type reflect.Type
+	// AnyTypeAllowed disables the type lock of the entry
+	AnyTypeAllowed bool
+}
+
+// TypeInfoOf returns the type information of T. TypeInfoOf[AnyTypeAllowed]
+// describes an entry accepting values of any type.
+func TypeInfoOf[T any]() TypeInfo {
+	t := typeOf[T]()
+	if t == reflect.TypeOf(AnyTypeAllowed{}) {
+		return TypeInfo{TypeName: t.Name(), AnyTypeAllowed: true}
+	}
+	return TypeInfo{TypeName: t.String(), Type: t}
+}
+
+// typeInfoOfValue returns the type information of value, untyped for nil.
+// The type name of scalars is the name of their kind, which avoids
+// building it with reflect.
+func typeInfoOfValue(value Any) TypeInfo {
+	if value.scalar.IsValid() {
+		return TypeInfo{TypeName: value.scalar.Kind.String(), Type: value.scalar.Type()}
+	}
+	if value.value == nil {
+		return TypeInfo{}
+	}
+	t := reflect.TypeOf(value.value)
+	return TypeInfo{TypeName: t.String(), Type: t}
 }
 
+// RootKeyPrefix marks the keys stored in the root blackboard, e.g. "@score"
+const RootKeyPrefix = "@"
+
 // Blackboard is used by BehaviorTrees to exchange typed data
 type Blackboard struct {
 	entries  map[string]Entry
 	parent   *Blackboard
 	mutex    sync.RWMutex
 	portInfo map[string]PortInfo
+
+	// scoped blackboards only share the keys listed in remapping with
+	// their parent, or every key when autoRemapping is enabled
+	scoped        bool
+	remapping     map[string]string
+	autoRemapping bool
+
+	// sequence numbers the writes, so every update of an entry gets a
+	// greater SequenceID than the previous one
+	sequence uint64
+
+	subscribers    map[string]map[uint64]BlackboardCallback
+	nextSubscriber uint64
+
+	// clock stamps the writes, a clockValue, inherited from the parent
+	// when not set
+	clock atomic.Value
+}
+
+// clockValue holds a Clock in an atomic.Value, which needs one concrete type
+type clockValue struct {
+	Clock
+}
+
+// StripBlackboardPointer returns the key referenced by a "{key}" port value
+func StripBlackboardPointer(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && value[0] == '{' && value[len(value)-1] == '}' {
+		return strings.TrimSpace(value[1 : len(value)-1]), true
+	}
+	return "", false
 }
 
 // NewBlackboard creates a new blackboard
@@ -55,7 +264,8 @@ func NewBlackboard() *Blackboard {
 	}
 }
 
-// NewBlackboardWithParent creates a new blackboard with a parent
+// NewBlackboardWithParent creates a new blackboard with a parent.
+// Keys not found locally are read from the parent, writes stay local.
 func NewBlackboardWithParent(parent *Blackboard) *Blackboard {
 	return &Blackboard{
 		entries: make(map[string]Entry),
@@ -63,36 +273,343 @@ func NewBlackboardWithParent(parent *Blackboard) *Blackboard {
 	}
 }
 
-// Set sets a value in the blackboard
+// NewSubtreeBlackboard creates the blackboard of a SubTree instance.
+// It is isolated from parent except for keys added with AddSubtreeRemapping,
+// or all keys once EnableAutoRemapping is called.
+func NewSubtreeBlackboard(parent *Blackboard) *Blackboard {
+	return &Blackboard{
+		entries:   make(map[string]Entry),
+		parent:    parent,
+		scoped:    true,
+		remapping: make(map[string]string),
+	}
+}
+
+// AddSubtreeRemapping makes the local key internal an alias of the parent key external
+func (bb *Blackboard) AddSubtreeRemapping(internal, external string) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+	if bb.remapping == nil {
+		bb.remapping = make(map[string]string)
+	}
+	bb.remapping[internal] = external
+}
+
+// EnableAutoRemapping shares every key with the parent blackboard, except
+// keys starting with '_' which stay private to this blackboard
+func (bb *Blackboard) EnableAutoRemapping(enable bool) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+	bb.autoRemapping = enable
+}
+
+// SetClock sets the clock stamping the writes of the blackboard and of its
+// children that have no clock of their own. nil inherits the clock of the
+// parent again.
+func (bb *Blackboard) SetClock(clock Clock) {
+	bb.clock.Store(clockValue{clock})
+}
+
+// Clock returns the clock stamping the writes: the clock set with SetClock,
+// else the clock of the parent, SystemClock for a root blackboard
+func (bb *Blackboard) Clock() Clock {
+	for b := bb; b != nil; b = b.parent {
+		if c, _ := b.clock.Load().(clockValue); c.Clock != nil {
+			return c.Clock
+		}
+	}
+	return SystemClock
+}
+
+// Parent returns the parent blackboard, nil for a root blackboard
+func (bb *Blackboard) Parent() *Blackboard {
+	return bb.parent
+}
+
+// RootBlackboard returns the top-most parent, or bb itself when it has no
+// parent. Keys starting with '@' always refer to the root blackboard.
+func (bb *Blackboard) RootBlackboard() *Blackboard {
+	root := bb
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+// rootKey resolves a key written "@key" to the root blackboard
+func (bb *Blackboard) rootKey(key string) (*Blackboard, string, bool) {
+	if !strings.HasPrefix(key, RootKeyPrefix) {
+		return nil, "", false
+	}
+	return bb.RootBlackboard(), strings.TrimPrefix(key, RootKeyPrefix), true
+}
+
+// forward returns the parent key that a locally missing key resolves to.
+// The caller must hold the mutex.
+func (bb *Blackboard) forward(key string) (string, bool) {
+	if bb.parent == nil {
+		return "", false
+	}
+	if !bb.scoped {
+		return key, true
+	}
+	if external, ok := bb.remapping[key]; ok {
+		return external, true
+	}
+	if bb.autoRemapping && !strings.HasPrefix(key, "_") {
+		return key, true
+	}
+	return "", false
+}
+
+// Set sets a value in the blackboard.
+//
+// The first value written to an entry locks its type. Later writes of a value
+// of another type are rejected, use SetConverted to convert them. Entries
+// created with CreateEntry and TypeInfoOf[AnyTypeAllowed] accept any type.
 func (bb *Blackboard) Set(key string, value interface{}) error {
+	return bb.set(key, NewAny(value), false)
+}
+
+// SetConverted sets a value in the blackboard like Set, but converts it to
+// the locked type of the entry: strings are parsed, e.g. the values written
+// in XML, and numbers are converted when no precision is lost.
+func (bb *Blackboard) SetConverted(key string, value interface{}) error {
+	return bb.set(key, NewAny(value), true)
+}
+
+// SetScalar sets a boolean or numeric value, like Set but without boxing
+// it. It implements scripting.ScalarEnvironment.
+func (bb *Blackboard) SetScalar(key string, value scripting.Scalar) error {
+	return bb.set(key, Any{scalar: value}, false)
+}
+
+// SetValue sets a value in the blackboard, like Set. Booleans and numbers
+// of predeclared types are stored without allocating.
+func SetValue[T any](bb *Blackboard, key string, value T) error {
+	return bb.set(key, AnyOf(value), false)
+}
+
+// set writes value to the entry key. A value whose type differs from the
+// locked type of the entry is converted if convert is set, rejected
+// otherwise.
+func (bb *Blackboard) set(key string, value Any, convert bool) error {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		return root.set(rootKey, value, convert)
+	}
+
+	bb.mutex.Lock()
+	entry, exists := bb.entries[key]
+	if !exists && bb.scoped {
+		// Remapped keys are written to the parent blackboard
+		if external, ok := bb.forward(key); ok {
+			bb.mutex.Unlock()
+			return bb.parent.set(external, value, convert)
+		}
+	}
+
+	if entry.Info.Type == nil && !entry.Info.AnyTypeAllowed {
+		entry.Info = typeInfoOfValue(value)
+	} else if !entry.Info.AnyTypeAllowed {
+		var err error
+		if convert {
+			value, err = convertToEntryType(value, entry.Info.Type)
+		} else {
+			err = checkEntryType(value, entry.Info.Type)
+		}
+		if err != nil {
+			bb.mutex.Unlock()
+			return fmt.Errorf("blackboard entry '%s': %v", key, err)
+		}
+	}
+
+	bb.sequence++
+	entry.Value = value
+	entry.SequenceID = bb.sequence
+	entry.Stamp = Timestamp(bb.Clock().Now())
+	bb.entries[key] = entry
+	callbacks := bb.callbacksFor(key)
+	bb.mutex.Unlock()
+
+	if len(callbacks) > 0 {
+		notify(callbacks, BlackboardEvent{Key: key, Entry: entry})
+	}
+	return nil
+}
+
+// CreateEntry creates an entry without value whose type is locked to info.
+// It fails if the entry already exists with a different type.
+func (bb *Blackboard) CreateEntry(key string, info TypeInfo) error {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		return root.CreateEntry(rootKey, info)
+	}
+
 	bb.mutex.Lock()
 	defer bb.mutex.Unlock()
 
-	bb.entries[key] = Entry{
-		Value: NewAny(value),
-		Info:  TypeInfo{TypeName: reflect.TypeOf(value).String()},
+	if entry, exists := bb.entries[key]; exists {
+		if entry.Info.Type != info.Type || entry.Info.AnyTypeAllowed != info.AnyTypeAllowed {
+			return fmt.Errorf("blackboard entry '%s' already exists with type %s", key, entry.Info.TypeName)
+		}
+		return nil
 	}
+	bb.entries[key] = Entry{Info: info}
 	return nil
 }
 
-// Get retrieves a value from the blackboard
-func (bb *Blackboard) Get(key string) (interface{}, bool) {
+// checkEntryType checks that value has the locked type t of an entry
+func checkEntryType(value Any, t reflect.Type) error {
+	if value.isNil() {
+		return fmt.Errorf("can't assign nil to an entry of type %s", t)
+	}
+	if valueType := value.Type(); valueType != t {
+		return fmt.Errorf("type mismatch: can't assign a value of type %s to an entry of type %s", valueType, t)
+	}
+	return nil
+}
+
+// convertToEntryType converts value to the locked type of an entry
+func convertToEntryType(value Any, t reflect.Type) (Any, error) {
+	if value.isNil() {
+		return Any{}, fmt.Errorf("can't assign nil to an entry of type %s", t)
+	}
+	if value.Type() == t {
+		return value, nil
+	}
+	// Numbers are converted without boxing them when t is predeclared
+	if scalar := value.scalar; scalar.IsNumber() && scripting.ScalarType(t.Kind()) == t {
+		converted, err := scalar.ConvertExact(t.Kind())
+		if err != nil {
+			return Any{}, err
+		}
+		return Any{scalar: converted}, nil
+	}
+	converted, err := convertValue(value.Value(), t)
+	if err != nil {
+		return Any{}, err
+	}
+	return NewAny(converted), nil
+}
+
+// convertValue converts a boxed value to the type t
+func convertValue(value interface{}, t reflect.Type) (interface{}, error) {
+	valueType := reflect.TypeOf(value)
+
+	// A string assigned to a typed entry is parsed, e.g. "1;2;3" written by
+	// a SetBlackboard node into a []float64
+	if s, ok := value.(string); ok {
+		return ConvertFromString(s, t)
+	}
+
+	if isNumericKind(valueType.Kind()) && isNumericKind(t.Kind()) {
+		return convertNumber(reflect.ValueOf(value), t)
+	}
+	return nil, fmt.Errorf("can't assign a value of type %s to an entry of type %s", valueType, t)
+}
+
+// Unset removes an entry from the blackboard
+func (bb *Blackboard) Unset(key string) {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		root.Unset(rootKey)
+		return
+	}
+
+	bb.mutex.Lock()
+	if _, exists := bb.entries[key]; !exists && bb.scoped {
+		if external, ok := bb.forward(key); ok {
+			bb.mutex.Unlock()
+			bb.parent.Unset(external)
+			return
+		}
+	}
+	_, exists := bb.entries[key]
+	delete(bb.entries, key)
+	var callbacks []BlackboardCallback
+	if exists {
+		callbacks = bb.callbacksFor(key)
+	}
+	bb.mutex.Unlock()
+
+	notify(callbacks, BlackboardEvent{Key: key, Removed: true})
+}
+
+// Keys returns the sorted keys of the entries stored in this blackboard,
+// without the keys of its parents
+func (bb *Blackboard) Keys() []string {
 	bb.mutex.RLock()
 	defer bb.mutex.RUnlock()
 
+	keys := make([]string, 0, len(bb.entries))
+	for key := range bb.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get retrieves a value from the blackboard
+func (bb *Blackboard) Get(key string) (interface{}, bool) {
+	value, found := bb.lookup(key)
+	return value.Value(), found
+}
+
+// GetScalar retrieves a boolean or numeric value without boxing it. It
+// implements scripting.ScalarEnvironment.
+func (bb *Blackboard) GetScalar(key string) (scripting.Scalar, bool) {
+	value, found := bb.lookup(key)
+	return value.scalar, found && value.scalar.IsValid()
+}
+
+// lookup returns the value of key, in bb or in its parents
+func (bb *Blackboard) lookup(key string) (Any, bool) {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		return root.lookup(rootKey)
+	}
+
+	bb.mutex.RLock()
 	if entry, exists := bb.entries[key]; exists {
-		return entry.Value.Value(), true
+		bb.mutex.RUnlock()
+		return entry.Value, true
 	}
+	external, forwarded := bb.forward(key)
+	bb.mutex.RUnlock()
 
-	if bb.parent != nil {
-		return bb.parent.Get(key)
+	if forwarded {
+		return bb.parent.lookup(external)
 	}
+	return Any{}, false
+}
 
-	return nil, false
+// GetValue retrieves a value from the blackboard as a T. String values are
+// converted with the registered converters.
+func GetValue[T any](bb *Blackboard, key string) (T, error) {
+	var zero T
+	value, found := bb.lookup(key)
+	if !found {
+		return zero, fmt.Errorf("blackboard entry '%s' not found", key)
+	}
+	result, err := AnyCast[T](value)
+	if err != nil {
+		return zero, fmt.Errorf("blackboard entry '%s': %v", key, err)
+	}
+	return result, nil
+}
+
+// GetString retrieves a value from the blackboard in its string form
+func (bb *Blackboard) GetString(key string) (string, error) {
+	value, found := bb.Get(key)
+	if !found {
+		return "", fmt.Errorf("blackboard entry '%s' not found", key)
+	}
+	return ConvertToString(value)
 }
 
 // HasKey checks if a key exists in the blackboard
 func (bb *Blackboard) HasKey(key string) bool {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		return root.HasKey(rootKey)
+	}
+
 	bb.mutex.RLock()
 	defer bb.mutex.RUnlock()
 
@@ -100,8 +617,8 @@ func (bb *Blackboard) HasKey(key string) bool {
 		return true
 	}
 
-	if bb.parent != nil {
-		return bb.parent.HasKey(key)
+	if external, ok := bb.forward(key); ok {
+		return bb.parent.HasKey(external)
 	}
 
 	return false
@@ -109,9 +626,18 @@ func (bb *Blackboard) HasKey(key string) bool {
 
 // Clear removes all entries from the blackboard
 func (bb *Blackboard) Clear() {
+	for _, key := range bb.Keys() {
+		bb.Unset(key)
+	}
+}
+
+// Reset removes the local entries and the subscriptions without notifying
+// the subscribers. The parent and the subtree remappings are kept.
+func (bb *Blackboard) Reset() {
 	bb.mutex.Lock()
 	defer bb.mutex.Unlock()
 	bb.entries = make(map[string]Entry)
+	bb.subscribers = nil
 }
 
 // RegisterPort registers a port with the blackboard
@@ -135,8 +661,13 @@ func (bb *Blackboard) GetPortInfo(name string) (PortInfo, bool) {
 	return info, exists
 }
 
-// GetEntry retrieves a blackboard entry
+// GetEntry retrieves a copy of a blackboard entry, not affected by later
+// writes. It returns nil if the entry does not exist.
 func (bb *Blackboard) GetEntry(key string) *Entry {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		return root.GetEntry(rootKey)
+	}
+
 	bb.mutex.RLock()
 	defer bb.mutex.RUnlock()
 
@@ -144,8 +675,8 @@ func (bb *Blackboard) GetEntry(key string) *Entry {
 		return &entry
 	}
 
-	if bb.parent != nil {
-		return bb.parent.GetEntry(key)
+	if external, ok := bb.forward(key); ok {
+		return bb.parent.GetEntry(external)
 	}
 
 	return nil
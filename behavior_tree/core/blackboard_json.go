@@ -0,0 +1,341 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// BlackboardSnapshot is the serializable state of a blackboard and of its
+// parents
+type BlackboardSnapshot struct {
+	Entries       map[string]SnapshotEntry `json:"entries"`
+	Scoped        bool                     `json:"scoped,omitempty"`
+	Remapping     map[string]string        `json:"remapping,omitempty"`
+	AutoRemapping bool                     `json:"auto_remapping,omitempty"`
+	Parent        *BlackboardSnapshot      `json:"parent,omitempty"`
+}
+
+// SnapshotEntry is a blackboard entry encoded with the codec of its type
+type SnapshotEntry struct {
+	// Type is the name of the value type, see ConverterType
+	Type           string          `json:"type"`
+	Value          json.RawMessage `json:"value"`
+	AnyTypeAllowed bool            `json:"any_type_allowed,omitempty"`
+	SequenceID     uint64          `json:"sequence_id"`
+	Stamp          time.Time       `json:"stamp"`
+}
+
+// jsonCodec encodes the values of one type
+type jsonCodec struct {
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+}
+
+// RegisterJSONCodec registers how values of type T are stored in blackboard
+// snapshots. A nil encode or decode uses encoding/json. Types with a
+// converter, see RegisterConverter, are stored with encoding/json unless a
+// codec is registered; other types must be registered to be restored.
+func RegisterJSONCodec[T any](encode func(T) ([]byte, error), decode func([]byte) (T, error), aliases ...string) {
+	codec := jsonCodec{}
+	if encode != nil {
+		codec.encode = func(value interface{}) ([]byte, error) {
+			return encode(value.(T))
+		}
+	}
+	if decode != nil {
+		codec.decode = func(data []byte) (interface{}, error) {
+			return decode(data)
+		}
+	}
+
+	t := typeOf[T]()
+	converters.mutex.Lock()
+	defer converters.mutex.Unlock()
+	converters.codecs[t] = codec
+	converters.byName[t.String()] = t
+	for _, alias := range aliases {
+		converters.byName[alias] = t
+	}
+}
+
+func lookupJSONCodec(t reflect.Type) jsonCodec {
+	converters.mutex.RLock()
+	defer converters.mutex.RUnlock()
+	return converters.codecs[t]
+}
+
+// encodeJSONValue encodes value with the codec of its type
+func encodeJSONValue(value interface{}) ([]byte, error) {
+	if value != nil {
+		if codec := lookupJSONCodec(reflect.TypeOf(value)); codec.encode != nil {
+			return codec.encode(value)
+		}
+	}
+	return json.Marshal(value)
+}
+
+// decodeJSONValue decodes data as a value of type t
+func decodeJSONValue(data []byte, t reflect.Type) (interface{}, error) {
+	if codec := lookupJSONCodec(t); codec.decode != nil {
+		value, err := codec.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(value).Convert(t).Interface(), nil
+	}
+	target := reflect.New(t)
+	if err := json.Unmarshal(data, target.Interface()); err != nil {
+		return nil, err
+	}
+	return target.Elem().Interface(), nil
+}
+
+// Snapshot captures the entries of the blackboard and of its parents
+func (bb *Blackboard) Snapshot() (*BlackboardSnapshot, error) {
+	bb.mutex.RLock()
+	snapshot := &BlackboardSnapshot{
+		Entries:       make(map[string]SnapshotEntry, len(bb.entries)),
+		Scoped:        bb.scoped,
+		AutoRemapping: bb.autoRemapping,
+	}
+	if len(bb.remapping) > 0 {
+		snapshot.Remapping = make(map[string]string, len(bb.remapping))
+		for internal, external := range bb.remapping {
+			snapshot.Remapping[internal] = external
+		}
+	}
+	entries := make(map[string]Entry, len(bb.entries))
+	for key, entry := range bb.entries {
+		entries[key] = entry
+	}
+	parent := bb.parent
+	bb.mutex.RUnlock()
+
+	for key, entry := range entries {
+		encoded, err := encodeEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("blackboard entry '%s': %v", key, err)
+		}
+		snapshot.Entries[key] = encoded
+	}
+
+	if parent != nil {
+		parentSnapshot, err := parent.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Parent = parentSnapshot
+	}
+	return snapshot, nil
+}
+
+func encodeEntry(entry Entry) (SnapshotEntry, error) {
+	value := entry.Value.Value()
+	encoded := SnapshotEntry{
+		Type:           entry.Info.TypeName,
+		AnyTypeAllowed: entry.Info.AnyTypeAllowed,
+		SequenceID:     entry.SequenceID,
+		Stamp:          entry.Stamp.Time(),
+	}
+	if value != nil {
+		// The value type is needed to decode entries accepting any type
+		encoded.Type = reflect.TypeOf(value).String()
+	}
+
+	data, err := encodeJSONValue(value)
+	if err != nil {
+		return SnapshotEntry{}, err
+	}
+	encoded.Value = data
+	return encoded, nil
+}
+
+// MarshalJSON encodes the snapshot of the blackboard
+func (bb *Blackboard) MarshalJSON() ([]byte, error) {
+	snapshot, err := bb.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(snapshot)
+}
+
+// RestoreBlackboard creates a new blackboard, with new parents, from a snapshot
+func RestoreBlackboard(snapshot *BlackboardSnapshot) (*Blackboard, error) {
+	var parent *Blackboard
+	if snapshot.Parent != nil {
+		var err error
+		if parent, err = RestoreBlackboard(snapshot.Parent); err != nil {
+			return nil, err
+		}
+	}
+
+	bb := &Blackboard{
+		entries:       make(map[string]Entry, len(snapshot.Entries)),
+		parent:        parent,
+		scoped:        snapshot.Scoped,
+		remapping:     make(map[string]string, len(snapshot.Remapping)),
+		autoRemapping: snapshot.AutoRemapping,
+	}
+	for internal, external := range snapshot.Remapping {
+		bb.remapping[internal] = external
+	}
+
+	for key, encoded := range snapshot.Entries {
+		entry, err := decodeEntry(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("blackboard entry '%s': %v", key, err)
+		}
+		bb.entries[key] = entry
+		if entry.SequenceID > bb.sequence {
+			bb.sequence = entry.SequenceID
+		}
+	}
+	return bb, nil
+}
+
+func decodeEntry(encoded SnapshotEntry) (Entry, error) {
+	entry := Entry{
+		SequenceID: encoded.SequenceID,
+		Stamp:      Timestamp(encoded.Stamp),
+	}
+	if encoded.AnyTypeAllowed {
+		entry.Info = TypeInfoOf[AnyTypeAllowed]()
+	}
+	if encoded.Type == "" {
+		return entry, nil
+	}
+
+	t, known := ConverterType(encoded.Type)
+	if !known {
+		return Entry{}, fmt.Errorf("unknown type %s, register it with RegisterJSONCodec", encoded.Type)
+	}
+	if !encoded.AnyTypeAllowed {
+		entry.Info = TypeInfo{TypeName: encoded.Type, Type: t}
+	}
+	if len(encoded.Value) == 0 || bytes.Equal(encoded.Value, []byte("null")) {
+		return entry, nil
+	}
+
+	value, err := decodeJSONValue(encoded.Value, t)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Value = NewAny(value)
+	return entry, nil
+}
+
+// UnmarshalBlackboard creates a new blackboard from JSON written by MarshalJSON
+func UnmarshalBlackboard(data []byte) (*Blackboard, error) {
+	var snapshot BlackboardSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return RestoreBlackboard(&snapshot)
+}
+
+// DiffKind tells how an entry differs between two snapshots
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+// String returns the string representation of the DiffKind
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// EntryDiff is a difference between two snapshots
+type EntryDiff struct {
+	Key  string
+	Kind DiffKind
+	// Level is 0 for the entries of the blackboard, 1 for its parent and so on
+	Level  int
+	Before *SnapshotEntry
+	After  *SnapshotEntry
+}
+
+// String returns a readable description of the difference
+func (d EntryDiff) String() string {
+	key := d.Key
+	for i := 0; i < d.Level; i++ {
+		key = "../" + key
+	}
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s (%s) = %s", key, d.After.Type, d.After.Value)
+	case DiffRemoved:
+		return fmt.Sprintf("- %s (%s) = %s", key, d.Before.Type, d.Before.Value)
+	default:
+		return fmt.Sprintf("~ %s (%s) = %s -> (%s) = %s", key, d.Before.Type, d.Before.Value, d.After.Type, d.After.Value)
+	}
+}
+
+// DiffSnapshots lists the entries added, removed or changed from before to
+// after, sorted by level and key. Sequence IDs and stamps are ignored.
+func DiffSnapshots(before, after *BlackboardSnapshot) []EntryDiff {
+	var diffs []EntryDiff
+	for level := 0; before != nil || after != nil; level++ {
+		var beforeEntries, afterEntries map[string]SnapshotEntry
+		if before != nil {
+			beforeEntries = before.Entries
+			before = before.Parent
+		}
+		if after != nil {
+			afterEntries = after.Entries
+			after = after.Parent
+		}
+		diffs = append(diffs, diffEntries(beforeEntries, afterEntries, level)...)
+	}
+	return diffs
+}
+
+func diffEntries(before, after map[string]SnapshotEntry, level int) []EntryDiff {
+	var diffs []EntryDiff
+	for key, b := range before {
+		b := b
+		a, exists := after[key]
+		switch {
+		case !exists:
+			diffs = append(diffs, EntryDiff{Key: key, Kind: DiffRemoved, Level: level, Before: &b})
+		case a.Type != b.Type || !equalJSON(a.Value, b.Value):
+			a := a
+			diffs = append(diffs, EntryDiff{Key: key, Kind: DiffChanged, Level: level, Before: &b, After: &a})
+		}
+	}
+	for key, a := range after {
+		a := a
+		if _, exists := before[key]; !exists {
+			diffs = append(diffs, EntryDiff{Key: key, Kind: DiffAdded, Level: level, After: &a})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs
+}
+
+// equalJSON compares two JSON documents ignoring formatting
+func equalJSON(a, b []byte) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testInventory struct {
+	Items []string
+}
+
+func init() {
+	RegisterJSONCodec[testInventory](nil, nil)
+	// Colors are stored by name
+	RegisterJSONCodec(func(c testColor) ([]byte, error) {
+		s, _ := ConvertToString(c)
+		return json.Marshal(s)
+	}, func(data []byte) (testColor, error) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, err
+		}
+		return ParseString[testColor](s)
+	})
+}
+
+func TestBlackboard_JSONRoundTrip(t *testing.T) {
+	world := NewBlackboard()
+	world.Set("time_of_day", 2*time.Hour)
+	npc := NewSubtreeBlackboard(world)
+	npc.AddSubtreeRemapping("clock", "time_of_day")
+	npc.Set("position", testPosition{1, 2, 3})
+	npc.Set("inventory", testInventory{Items: []string{"sword"}})
+	npc.Set("color", testGreen)
+	npc.Set("path", []int{4, 5})
+	npc.CreateEntry("anything", TypeInfoOf[AnyTypeAllowed]())
+	npc.Set("anything", "text")
+
+	data, err := json.Marshal(npc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"GREEN"`) {
+		t.Fatalf("codec not used: %s", data)
+	}
+
+	restored, err := UnmarshalBlackboard(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := restored.Get("position"); v != (testPosition{1, 2, 3}) {
+		t.Fatalf("position: %#v", v)
+	}
+	if v, _ := restored.Get("color"); v != testGreen {
+		t.Fatalf("color: %#v", v)
+	}
+	if v, _ := restored.Get("clock"); v != 2*time.Hour {
+		t.Fatalf("remapped parent entry: %#v", v)
+	}
+	if v, err := GetValue[testInventory](restored, "inventory"); err != nil || v.Items[0] != "sword" {
+		t.Fatalf("inventory: %#v, %v", v, err)
+	}
+	if err := restored.Set("anything", 1); err != nil {
+		t.Fatalf("any type entry not restored: %v", err)
+	}
+	if err := restored.Set("path", "oops"); err == nil {
+		t.Fatalf("type lock not restored")
+	}
+
+	// Writes after a restore get greater sequence IDs
+	before := restored.GetEntry("color").SequenceID
+	restored.Set("color", testRed)
+	if restored.GetEntry("color").SequenceID <= before {
+		t.Fatalf("sequence not restored")
+	}
+}
+
+func TestBlackboard_Diff(t *testing.T) {
+	world := NewBlackboard()
+	world.Set("weather", "rain")
+	bb := NewBlackboardWithParent(world)
+	bb.Set("hp", 10)
+	bb.Set("target", "orc")
+
+	before, _ := bb.Snapshot()
+	bb.Set("hp", 10) // same value, not a change
+	bb.Set("target", "troll")
+	bb.Unset("hp")
+	bb.Set("mana", 3)
+	world.Set("weather", "sun")
+	after, _ := bb.Snapshot()
+
+	var lines []string
+	for _, diff := range DiffSnapshots(before, after) {
+		lines = append(lines, diff.String())
+	}
+	want := []string{
+		"- hp (int) = 10",
+		"+ mana (int) = 3",
+		`~ target (string) = "orc" -> (string) = "troll"`,
+		`~ ../weather (string) = "rain" -> (string) = "sun"`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected diff:\n%s", strings.Join(lines, "\n"))
+	}
+}
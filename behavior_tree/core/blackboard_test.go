@@ -0,0 +1,233 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
+
+func TestBlackboard_SequenceAndStamp(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("a", 1)
+	first := bb.GetEntry("a")
+	bb.Set("b", 1)
+	bb.Set("a", 2)
+	second := bb.GetEntry("a")
+
+	if second.SequenceID <= first.SequenceID {
+		t.Fatalf("sequence did not grow: %d then %d", first.SequenceID, second.SequenceID)
+	}
+	if second.Stamp.Time().Before(first.Stamp.Time()) || second.Stamp.Time().IsZero() {
+		t.Fatalf("stamp not updated")
+	}
+	if first.Value.Value() != 1 {
+		t.Fatalf("GetEntry must return a copy, got %v", first.Value.Value())
+	}
+}
+
+func TestBlackboard_Clock(t *testing.T) {
+	start := time.Unix(100, 0)
+	clock := NewManualClock(start)
+	root := NewBlackboard()
+	root.SetClock(clock)
+	subtree := NewSubtreeBlackboard(NewBlackboardWithParent(root))
+
+	// The children stamp their writes with the clock of the root
+	subtree.Set("hp", 1)
+	clock.Advance(time.Second)
+	subtree.Set("hp", 2)
+	if stamp := subtree.GetEntry("hp").Stamp.Time(); !stamp.Equal(start.Add(time.Second)) {
+		t.Fatalf("expected the stamp of the clock, got %v", stamp)
+	}
+
+	own := NewManualClock(time.Unix(5, 0))
+	subtree.SetClock(own)
+	if subtree.Clock() != own || root.Clock() != clock {
+		t.Fatalf("expected the subtree to use its own clock")
+	}
+	subtree.SetClock(nil)
+	if subtree.Clock() != clock || NewBlackboard().Clock() != SystemClock {
+		t.Fatalf("expected the clock to be inherited again")
+	}
+}
+
+func TestBlackboard_UnsetAndKeys(t *testing.T) {
+	parent := NewBlackboard()
+	parent.Set("shared", 1)
+	child := NewSubtreeBlackboard(parent)
+	child.AddSubtreeRemapping("alias", "shared")
+	child.Set("local", 2)
+	child.Set("other", 3)
+
+	if keys := child.Keys(); !reflect.DeepEqual(keys, []string{"local", "other"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	child.Unset("local")
+	if child.HasKey("local") {
+		t.Fatalf("local not removed")
+	}
+	child.Unset("alias")
+	if parent.HasKey("shared") {
+		t.Fatalf("remapped key not removed from the parent")
+	}
+}
+
+func TestBlackboard_TypeLock(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("hp", 10)
+
+	// Values of another type are rejected
+	for _, value := range []interface{}{"12", true, 7.0, int64(7), nil} {
+		if err := bb.Set("hp", value); err == nil || !strings.Contains(err.Error(), "hp") {
+			t.Fatalf("expected an error writing %#v to an int entry, got %v", value, err)
+		}
+	}
+	if err := bb.Set("hp", 11); err != nil {
+		t.Fatal(err)
+	}
+
+	// SetConverted converts them when no precision is lost
+	if err := bb.SetConverted("hp", "oops"); err == nil {
+		t.Fatalf("expected an error writing a non numeric string")
+	}
+	if err := bb.SetConverted("hp", true); err == nil {
+		t.Fatalf("expected an error writing a bool to an int entry")
+	}
+	if err := bb.SetConverted("hp", 2.5); err == nil {
+		t.Fatalf("expected an error losing precision")
+	}
+	if err := bb.SetConverted("hp", -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bb.SetConverted("hp", 7.0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := bb.Get("hp"); v != 7 {
+		t.Fatalf("expected int 7, got %#v", v)
+	}
+	bb.Set("ammo", uint8(3))
+	if err := bb.SetConverted("ammo", -1); err == nil {
+		t.Fatalf("expected an error writing a negative number to an uint8 entry")
+	}
+
+	bb.CreateEntry("anything", TypeInfoOf[AnyTypeAllowed]())
+	if err := bb.Set("anything", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bb.Set("anything", "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	bb.CreateEntry("speed", TypeInfoOf[float64]())
+	if err := bb.Set("speed", "1.5"); err == nil {
+		t.Fatalf("expected an error writing a string to a float64 entry")
+	}
+	if err := bb.SetConverted("speed", "1.5"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := bb.Get("speed"); v != 1.5 {
+		t.Fatalf("expected 1.5, got %#v", v)
+	}
+	if err := bb.CreateEntry("speed", TypeInfoOf[string]()); err == nil {
+		t.Fatalf("expected an error creating an entry with another type")
+	}
+}
+
+func TestBlackboard_RootKeys(t *testing.T) {
+	root := NewBlackboard()
+	tree := NewBlackboardWithParent(root)
+	subtree := NewSubtreeBlackboard(tree)
+
+	if err := subtree.Set("@score", 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := root.Get("score"); v != 1 {
+		t.Fatalf("'@' key not stored in the root, got %v", v)
+	}
+	if subtree.HasKey("score") {
+		t.Fatalf("isolated subtree must not see the key without '@'")
+	}
+	if v, _ := tree.Get("@score"); v != 1 || subtree.RootBlackboard() != root {
+		t.Fatalf("'@' key not read from the root")
+	}
+
+	var events int
+	subscription := subtree.Subscribe("@score", func(BlackboardEvent) { events++ })
+	root.Set("score", 2)
+	subtree.Unset("@score")
+	subscription.Cancel()
+	if events != 2 || root.HasKey("score") {
+		t.Fatalf("expected 2 events and the key removed, got %d", events)
+	}
+}
+
+func TestBlackboard_Scalars(t *testing.T) {
+	bb := NewBlackboard()
+	if err := SetValue(bb, "hp", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if entry := bb.GetEntry("hp"); entry.Info.TypeName != "int" || entry.Value.Value() != 1000 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if hp, err := GetValue[float64](bb, "hp"); err != nil || hp != 1000 {
+		t.Fatalf("expected 1000.0, got %v (%v)", hp, err)
+	}
+
+	// The type lock checks scalars without boxing them
+	if err := SetValue(bb, "hp", int8(12)); err == nil {
+		t.Fatalf("expected an error writing an int8 to an int entry")
+	}
+	if err := SetValue(bb, "hp", 12); err != nil {
+		t.Fatal(err)
+	}
+	if err := bb.SetScalar("hp", scripting.BoolScalar(true)); err == nil {
+		t.Fatalf("expected an error writing a bool to an int entry")
+	}
+	if s, ok := bb.GetScalar("hp"); !ok || s.Kind != reflect.Int || s.Int() != 12 {
+		t.Fatalf("expected int 12, got %+v", s)
+	}
+
+	if err := SetValue(bb, "name", "orc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bb.GetScalar("name"); ok {
+		t.Fatalf("a string is not a scalar")
+	}
+	if name, err := GetValue[string](bb, "name"); err != nil || name != "orc" {
+		t.Fatalf("expected orc, got %v (%v)", name, err)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		SetValue(bb, "hp", 5000)
+		GetValue[int](bb, "hp")
+	}); allocs != 0 {
+		t.Fatalf("expected no allocation, got %v", allocs)
+	}
+}
+
+func BenchmarkBlackboard(b *testing.B) {
+	bb := NewBlackboard()
+	bb.Set("hp", 0)
+	b.Run("Set", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bb.Set("hp", i)
+		}
+	})
+	b.Run("SetValue", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			SetValue(bb, "hp", i)
+		}
+	})
+	b.Run("GetValue", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GetValue[int](bb, "hp")
+		}
+	})
+}
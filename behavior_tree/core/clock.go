@@ -0,0 +1,176 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the time-based nodes, Sleep, Delay and Timeout,
+// and to the tree waiting between two ticks
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the system clock
+type RealClock struct{}
+
+// Now returns time.Now
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// After returns time.After
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTimer returns time.After's channel with a function stopping the timer
+func (RealClock) NewTimer(d time.Duration) (<-chan time.Time, func()) {
+	timer := time.NewTimer(d)
+	return timer.C, func() { timer.Stop() }
+}
+
+// TimerClock is implemented by clocks whose timers can be stopped before
+// they fire, so that a wait ended early leaves nothing behind
+type TimerClock interface {
+	Clock
+	// NewTimer is like After, stop releases the timer if it did not fire
+	NewTimer(d time.Duration) (c <-chan time.Time, stop func())
+}
+
+// StartTimer starts a timer of d on clock. Call stop when the wait ends
+// before the timer fires. Clocks not implementing TimerClock release their
+// timers once they fire.
+func StartTimer(clock Clock, d time.Duration) (c <-chan time.Time, stop func()) {
+	if timers, ok := clock.(TimerClock); ok {
+		return timers.NewTimer(d)
+	}
+	return clock.After(d), func() {}
+}
+
+// SystemClock is used when no clock is configured
+var SystemClock Clock = RealClock{}
+
+// ManualClock is a clock that only moves when told to, for deterministic
+// tests and fixed frame rate servers
+type ManualClock struct {
+	mutex       sync.Mutex
+	now         time.Time
+	autoAdvance bool
+	waiters     []manualWaiter
+}
+
+type manualWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewManualClock creates a clock starting at start that moves with Advance
+// and Set
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// NewSimulatedClock creates a manual clock that jumps forward instead of
+// waiting: After advances the clock by d immediately. A tree ticked with
+// TickWhileRunning then runs as fast as possible with consistent times.
+func NewSimulatedClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start, autoAdvance: true}
+}
+
+// Now returns the current time of the clock
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time when the clock reaches now + d.
+// The clock keeps the channel until then, use NewTimer for waits that may end
+// earlier.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	ch, _ := c.NewTimer(d)
+	return ch
+}
+
+// NewTimer is like After, stop removes the channel from the clock if the
+// time was not reached
+func (c *ManualClock) NewTimer(d time.Duration) (<-chan time.Time, func()) {
+	ch := make(chan time.Time, 1)
+	c.mutex.Lock()
+	deadline := c.now.Add(d)
+	if c.autoAdvance && deadline.After(c.now) {
+		c.now = deadline
+	}
+	c.waiters = append(c.waiters, manualWaiter{deadline: deadline, ch: ch})
+	fired := c.fire()
+	c.mutex.Unlock()
+
+	deliver(fired)
+	return ch, func() { c.stop(ch) }
+}
+
+// stop removes the waiter of ch
+func (c *ManualClock) stop(ch chan time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, waiter := range c.waiters {
+		if waiter.ch == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Waiters returns the number of channels returned by After and NewTimer
+// waiting for the clock
+func (c *ManualClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	fired := c.fire()
+	c.mutex.Unlock()
+
+	deliver(fired)
+}
+
+// Set moves the clock to t
+func (c *ManualClock) Set(t time.Time) {
+	c.mutex.Lock()
+	c.now = t
+	fired := c.fire()
+	c.mutex.Unlock()
+
+	deliver(fired)
+}
+
+// fire removes the waiters whose deadline is reached. The caller must hold
+// the mutex.
+func (c *ManualClock) fire() []manualWaiter {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+	n := 0
+	for n < len(c.waiters) && !c.waiters[n].deadline.After(c.now) {
+		n++
+	}
+	fired := make([]manualWaiter, n)
+	copy(fired, c.waiters[:n])
+	c.waiters = c.waiters[n:]
+	return fired
+}
+
+func deliver(waiters []manualWaiter) {
+	for _, waiter := range waiters {
+		waiter.ch <- waiter.deadline
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(100, 0)
+	clock := NewManualClock(start)
+
+	late := clock.After(20 * time.Millisecond)
+	early := clock.After(10 * time.Millisecond)
+	clock.Advance(15 * time.Millisecond)
+
+	select {
+	case at := <-early:
+		if !at.Equal(start.Add(10 * time.Millisecond)) {
+			t.Fatalf("fired with %v", at)
+		}
+	default:
+		t.Fatalf("the reached deadline did not fire")
+	}
+	select {
+	case <-late:
+		t.Fatalf("fired before its deadline")
+	default:
+	}
+
+	clock.Set(start.Add(time.Second))
+	if _, ok := <-late; !ok {
+		t.Fatalf("Set did not fire the deadline")
+	}
+	if !clock.Now().Equal(start.Add(time.Second)) {
+		t.Fatalf("unexpected time %v", clock.Now())
+	}
+}
+
+func TestManualClock_StopTimer(t *testing.T) {
+	clock := NewManualClock(time.Unix(100, 0))
+	for i := 0; i < 10; i++ {
+		_, stop := StartTimer(clock, time.Minute)
+		stop()
+	}
+	fired, _ := clock.NewTimer(time.Second)
+	clock.Advance(time.Second)
+	<-fired
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Fatalf("expected the waiters to drain, %d left", waiters)
+	}
+}
+
+func TestSimulatedClock(t *testing.T) {
+	start := time.Unix(100, 0)
+	clock := NewSimulatedClock(start)
+
+	at := <-clock.After(time.Minute)
+	if !at.Equal(start.Add(time.Minute)) || !clock.Now().Equal(at) {
+		t.Fatalf("the clock did not jump to the deadline, now %v", clock.Now())
+	}
+}
+
+func TestWakeUpSignal_Deadline(t *testing.T) {
+	signal := NewWakeUpSignal()
+	if _, ok := signal.Deadline(); ok {
+		t.Fatalf("unexpected deadline")
+	}
+
+	start := time.Unix(100, 0)
+	signal.EmitAt(start.Add(time.Second))
+	signal.EmitAt(start.Add(time.Millisecond))
+	signal.EmitAt(start.Add(time.Minute))
+	if deadline, ok := signal.Deadline(); !ok || !deadline.Equal(start.Add(time.Millisecond)) {
+		t.Fatalf("expected the earliest deadline, got %v", deadline)
+	}
+
+	signal.ClearDeadline()
+	if _, ok := signal.Deadline(); ok {
+		t.Fatalf("deadline not cleared")
+	}
+}
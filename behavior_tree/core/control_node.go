@@ -23,3 +23,8 @@ func (cn *ControlNode) ResetChildren() {
 		child.HaltAndReset()
 	}
 }
+
+// Halt resets all children nodes, halting the running ones
+func (cn *ControlNode) Halt() {
+	cn.ResetChildren()
+}
@@ -0,0 +1,310 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SliceSeparator separates the elements of a slice written as a string,
+// e.g. "1.0;2.0;3.0"
+const SliceSeparator = ";"
+
+// converter turns the string form of a port value into a Go value and back
+type converter struct {
+	fromString func(string) (interface{}, error)
+	toString   func(interface{}) (string, error)
+}
+
+// converterRegistry holds the converters of every type used in ports and
+// blackboard entries, and their JSON codecs. Types are looked up by
+// reflect.Type, or by name when reading the type of a port declared in XML
+// or of an entry in a blackboard snapshot.
+type converterRegistry struct {
+	mutex  sync.RWMutex
+	byType map[reflect.Type]converter
+	byName map[string]reflect.Type
+	codecs map[reflect.Type]jsonCodec
+}
+
+var converters = newConverterRegistry()
+
+func newConverterRegistry() *converterRegistry {
+	r := &converterRegistry{
+		byType: make(map[reflect.Type]converter),
+		byName: make(map[string]reflect.Type),
+		codecs: make(map[reflect.Type]jsonCodec),
+	}
+
+	r.register(reflect.TypeOf(""), func(s string) (interface{}, error) {
+		return s, nil
+	}, nil)
+	r.register(reflect.TypeOf(false), func(s string) (interface{}, error) {
+		return strconv.ParseBool(strings.TrimSpace(s))
+	}, nil)
+	r.register(reflect.TypeOf(time.Duration(0)), parseDuration, nil)
+	r.register(reflect.TypeOf(NodeStatusIdle), func(s string) (interface{}, error) {
+		return ParseNodeStatus(s)
+	}, nil, "NodeStatus")
+
+	for _, value := range []interface{}{
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+	} {
+		t := reflect.TypeOf(value)
+		r.register(t, numericParser(t), nil)
+	}
+	r.byName["double"] = reflect.TypeOf(float64(0))
+	r.byName["float"] = reflect.TypeOf(float32(0))
+	return r
+}
+
+// register adds a converter for t. A nil toString formats the value with fmt.
+func (r *converterRegistry) register(t reflect.Type, fromString func(string) (interface{}, error), toString func(interface{}) (string, error), aliases ...string) {
+	if toString == nil {
+		toString = func(value interface{}) (string, error) {
+			return fmt.Sprint(value), nil
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.byType[t] = converter{fromString: fromString, toString: toString}
+	r.byName[t.String()] = t
+	for _, alias := range aliases {
+		r.byName[alias] = t
+	}
+}
+
+func (r *converterRegistry) lookup(t reflect.Type) (converter, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	c, ok := r.byType[t]
+	return c, ok
+}
+
+func (r *converterRegistry) lookupName(name string) (reflect.Type, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// RegisterConverter registers the string conversion of a user type so it can
+// be used in ports, blackboard entries and XML. The type is known by its Go
+// name, e.g. "game.Position", and by the optional aliases. A nil toString
+// formats values with fmt.
+func RegisterConverter[T any](fromString func(string) (T, error), toString func(T) string, aliases ...string) {
+	var encode func(interface{}) (string, error)
+	if toString != nil {
+		encode = func(value interface{}) (string, error) {
+			return toString(value.(T)), nil
+		}
+	}
+	converters.register(typeOf[T](), func(s string) (interface{}, error) {
+		return fromString(s)
+	}, encode, aliases...)
+}
+
+// Integer is the set of types an enum can be based on
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// RegisterEnum registers an enum type by the names of its values. Strings are
+// converted by name or by number, values are converted back to their name.
+func RegisterEnum[T Integer](values map[string]T, aliases ...string) {
+	names := make(map[T]string, len(values))
+	for name, value := range values {
+		names[value] = name
+	}
+
+	RegisterConverter(func(s string) (T, error) {
+		s = strings.TrimSpace(s)
+		if value, ok := values[s]; ok {
+			return value, nil
+		}
+		number, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a value of %s", s, typeOf[T]())
+		}
+		return T(number), nil
+	}, func(value T) string {
+		if name, ok := names[value]; ok {
+			return name
+		}
+		return strconv.FormatInt(int64(value), 10)
+	}, aliases...)
+}
+
+// ConverterType returns the type registered under name, as used in the type
+// attribute of ports
+func ConverterType(name string) (reflect.Type, bool) {
+	if t, ok := converters.lookupName(name); ok {
+		return t, true
+	}
+	// Slices of registered types are supported without registration
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		if t, ok := ConverterType(elem); ok {
+			return reflect.SliceOf(t), true
+		}
+	}
+	return nil, false
+}
+
+// ConvertFromString converts s to a value of type t
+func ConvertFromString(s string, t reflect.Type) (interface{}, error) {
+	if t.Kind() == reflect.Interface {
+		// Untyped values keep the string
+		return s, nil
+	}
+
+	c, ok := converters.lookup(t)
+	if !ok {
+		// Named types such as "type EntityID int64" use the converter of
+		// their underlying basic type
+		c, ok = converters.lookup(basicType(t))
+	}
+	if ok {
+		value, err := c.fromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert '%s' to %s: %v", s, t, err)
+		}
+		if value == nil {
+			return reflect.Zero(t).Interface(), nil
+		}
+		return reflect.ValueOf(value).Convert(t).Interface(), nil
+	}
+
+	if t.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(t, 0, 0)
+		if strings.TrimSpace(s) == "" {
+			return slice.Interface(), nil
+		}
+		for _, part := range strings.Split(s, SliceSeparator) {
+			elem, err := ConvertFromString(part, t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			slice = reflect.Append(slice, reflect.ValueOf(elem))
+		}
+		return slice.Interface(), nil
+	}
+
+	return nil, fmt.Errorf("can't convert '%s' to %s: no converter registered", s, t)
+}
+
+// ConvertToString converts value to the string form its converter parses
+func ConvertToString(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+
+	t := reflect.TypeOf(value)
+	if c, ok := converters.lookup(t); ok {
+		return c.toString(value)
+	}
+
+	if t.Kind() == reflect.Slice {
+		v := reflect.ValueOf(value)
+		parts := make([]string, v.Len())
+		for i := range parts {
+			part, err := ConvertToString(v.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return strings.Join(parts, SliceSeparator), nil
+	}
+
+	// Kinds such as named string or numeric types format naturally
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("can't convert %s to string: no converter registered", t)
+}
+
+// ParseString converts s to a T using the registered converters
+func ParseString[T any](s string) (T, error) {
+	var zero T
+	value, err := ConvertFromString(s, typeOf[T]())
+	if err != nil {
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// typeOf returns the reflect.Type of T, including interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// basicType returns the predeclared type of the same kind as t, or nil
+func basicType(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.TypeOf("")
+	case reflect.Bool:
+		return reflect.TypeOf(false)
+	case reflect.Int:
+		return reflect.TypeOf(int(0))
+	case reflect.Int8:
+		return reflect.TypeOf(int8(0))
+	case reflect.Int16:
+		return reflect.TypeOf(int16(0))
+	case reflect.Int32:
+		return reflect.TypeOf(int32(0))
+	case reflect.Int64:
+		return reflect.TypeOf(int64(0))
+	case reflect.Uint:
+		return reflect.TypeOf(uint(0))
+	case reflect.Uint8:
+		return reflect.TypeOf(uint8(0))
+	case reflect.Uint16:
+		return reflect.TypeOf(uint16(0))
+	case reflect.Uint32:
+		return reflect.TypeOf(uint32(0))
+	case reflect.Uint64:
+		return reflect.TypeOf(uint64(0))
+	case reflect.Float32:
+		return reflect.TypeOf(float32(0))
+	case reflect.Float64:
+		return reflect.TypeOf(float64(0))
+	}
+	return nil
+}
+
+// parseDuration accepts Go durations like "250ms" and plain numbers of milliseconds
+func parseDuration(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if msec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(msec) * time.Millisecond, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func numericParser(t reflect.Type) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		s = strings.TrimSpace(s)
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value, err := strconv.ParseInt(s, 10, t.Bits())
+			return reflect.ValueOf(value).Convert(t).Interface(), err
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value, err := strconv.ParseUint(s, 10, t.Bits())
+			return reflect.ValueOf(value).Convert(t).Interface(), err
+		default:
+			value, err := strconv.ParseFloat(s, t.Bits())
+			return reflect.ValueOf(value).Convert(t).Interface(), err
+		}
+	}
+}
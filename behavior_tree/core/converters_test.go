@@ -0,0 +1,109 @@
+package core
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPosition struct{ X, Y, Z float64 }
+
+type testColor int
+
+const (
+	testRed testColor = iota
+	testGreen
+)
+
+type testEntityID int64
+
+func init() {
+	RegisterConverter(func(s string) (testPosition, error) {
+		values, err := ParseString[[]float64](s)
+		if err != nil || len(values) != 3 {
+			return testPosition{}, strconv.ErrSyntax
+		}
+		return testPosition{values[0], values[1], values[2]}, nil
+	}, func(p testPosition) string {
+		s, _ := ConvertToString([]float64{p.X, p.Y, p.Z})
+		return s
+	}, "Position")
+	RegisterEnum(map[string]testColor{"RED": testRed, "GREEN": testGreen})
+}
+
+func TestConverters_Builtin(t *testing.T) {
+	if v, err := ParseString[time.Duration]("250ms"); err != nil || v != 250*time.Millisecond {
+		t.Fatalf("duration: got %v, %v", v, err)
+	}
+	if v, err := ParseString[time.Duration]("40"); err != nil || v != 40*time.Millisecond {
+		t.Fatalf("duration in msec: got %v, %v", v, err)
+	}
+	if v, err := ParseString[[]int]("1;2;3"); err != nil || !reflect.DeepEqual(v, []int{1, 2, 3}) {
+		t.Fatalf("slice: got %v, %v", v, err)
+	}
+	if v, err := ParseString[testEntityID]("77"); err != nil || v != 77 {
+		t.Fatalf("named integer: got %v, %v", v, err)
+	}
+	if v, err := ParseString[NodeStatus]("RUNNING"); err != nil || v != NodeStatusRunning {
+		t.Fatalf("status: got %v, %v", v, err)
+	}
+	if _, err := ParseString[uint8]("300"); err == nil {
+		t.Fatalf("expected an overflow error")
+	}
+	if s, err := ConvertToString([]bool{true, false}); err != nil || s != "true;false" {
+		t.Fatalf("slice to string: got %q, %v", s, err)
+	}
+}
+
+func TestConverters_UserTypes(t *testing.T) {
+	p, err := ParseString[testPosition]("1.0;2.5;3")
+	if err != nil || p != (testPosition{1, 2.5, 3}) {
+		t.Fatalf("position: got %v, %v", p, err)
+	}
+	if s, _ := ConvertToString(p); s != "1;2.5;3" {
+		t.Fatalf("position to string: got %q", s)
+	}
+	if typ, ok := ConverterType("Position"); !ok || typ != reflect.TypeOf(p) {
+		t.Fatalf("alias not registered")
+	}
+	if typ, ok := ConverterType("[]Position"); !ok || typ != reflect.TypeOf([]testPosition{}) {
+		t.Fatalf("slice type not resolved")
+	}
+
+	if c, err := ParseString[testColor]("GREEN"); err != nil || c != testGreen {
+		t.Fatalf("enum: got %v, %v", c, err)
+	}
+	if s, _ := ConvertToString(testRed); s != "RED" {
+		t.Fatalf("enum to string: got %q", s)
+	}
+	if _, err := ParseString[testColor]("BLUE"); err == nil || !strings.Contains(err.Error(), "BLUE") {
+		t.Fatalf("expected an error for an unknown enum value, got %v", err)
+	}
+}
+
+func TestConverters_Blackboard(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("goal", testPosition{})
+	if err := bb.Set("goal", "4;5;6"); err == nil {
+		t.Fatalf("expected a type mismatch writing a string")
+	}
+	if err := bb.SetConverted("goal", "4;5;6"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := bb.Get("goal"); v != (testPosition{4, 5, 6}) {
+		t.Fatalf("string not converted to the entry type: %v", v)
+	}
+	if err := bb.SetConverted("goal", "nowhere"); err == nil {
+		t.Fatalf("expected a conversion error")
+	}
+
+	bb.Set("color", "RED")
+	if c, err := GetValue[testColor](bb, "color"); err != nil || c != testRed {
+		t.Fatalf("GetValue: got %v, %v", c, err)
+	}
+	if s, err := bb.GetString("goal"); err != nil || s != "4;5;6" {
+		t.Fatalf("GetString: got %q, %v", s, err)
+	}
+}
@@ -16,3 +16,10 @@ func NewDecoratorNode(name string, config NodeConfig) DecoratorNode {
 func (dn *DecoratorNode) Type() NodeType {
 	return NodeTypeDecorator
 }
+
+// Halt halts and resets the child node
+func (dn *DecoratorNode) Halt() {
+	for _, child := range dn.Children() {
+		child.HaltAndReset()
+	}
+}
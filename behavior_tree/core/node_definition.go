@@ -0,0 +1,105 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
+
+// NodeDefinition is the immutable part of a node: its name, ports,
+// attributes and parsed condition scripts. The nodes cloned from a tree
+// template share the definitions of the template; the other nodes get their
+// own. The mutable state, such as the status, lives in TreeNode.
+type NodeDefinition struct {
+	name string
+	// config has no Blackboard, WakeUp, Clock nor Definition: those belong
+	// to the instances
+	config      NodeConfig
+	preScripts  [PreCondCount]*scripting.Script
+	postScripts [PostCondCount]*scripting.Script
+	shared      sync.Map
+	// literals are the parsed values of the literal input ports. The map
+	// is replaced, never modified, so that GetInput reads it without lock.
+	literals atomic.Pointer[map[literalKey]Any]
+}
+
+// literalKey identifies an input port parsed as a type
+type literalKey struct {
+	port string
+	t    reflect.Type
+}
+
+// NewNodeDefinition creates the definition of the nodes named name
+// configured by config. Pre and post condition scripts are parsed once
+// here; it panics if one is invalid.
+func NewNodeDefinition(name string, config NodeConfig) *NodeDefinition {
+	config.Blackboard = nil
+	config.WakeUp = nil
+	config.Clock = nil
+	config.Definition = nil
+	preScripts, postScripts := parseConditionScripts(name, config)
+	return &NodeDefinition{
+		name:        name,
+		config:      config,
+		preScripts:  preScripts,
+		postScripts: postScripts,
+	}
+}
+
+// Name returns the name of the nodes
+func (d *NodeDefinition) Name() string {
+	return d.name
+}
+
+// Config returns the shared configuration, without blackboard, wake up
+// signal and clock. Its maps must not be modified.
+func (d *NodeDefinition) Config() NodeConfig {
+	return d.config
+}
+
+// SharedValue returns the value stored under key in the definition of
+// config, calling build the first time. Nodes use it in their constructor
+// for the data they derive from their ports, such as parsed scripts, so
+// that the instances of a template parse them once. Without definition,
+// build is called every time.
+func SharedValue[T any](config NodeConfig, key string, build func() T) T {
+	d := config.Definition
+	if d == nil {
+		return build()
+	}
+	if value, ok := d.shared.Load(key); ok {
+		return value.(T)
+	}
+	value, _ := d.shared.LoadOrStore(key, build())
+	return value.(T)
+}
+
+// literal returns the value of the literal input port parsed as t, if it
+// was parsed before
+func (d *NodeDefinition) literal(port string, t reflect.Type) (Any, bool) {
+	literals := d.literals.Load()
+	if literals == nil {
+		return Any{}, false
+	}
+	value, ok := (*literals)[literalKey{port, t}]
+	return value, ok
+}
+
+// storeLiteral records the value of the literal input port parsed as t
+func (d *NodeDefinition) storeLiteral(port string, t reflect.Type, value Any) {
+	for {
+		current := d.literals.Load()
+		literals := make(map[literalKey]Any)
+		if current != nil {
+			for key, literal := range *current {
+				literals[key] = literal
+			}
+		}
+		literals[literalKey{port, t}] = value
+		if d.literals.CompareAndSwap(current, &literals) {
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
+
+// GetInput reads the input port key of node as a T.
+//
+// A port value written as "{entry}" is read from the node's blackboard, or its
+// parents; "{=}" refers to the entry named like the port. Any other value is
+// a literal converted from its string form by the registered converters. If
+// the port was not assigned, the default value declared in the manifest is
+// used. Literals are parsed once per node definition.
+func GetInput[T any](node Node, key string) (T, error) {
+	var zero T
+	config, definition := portConfig(node)
+
+	value, exists := config.InputPorts[key]
+	if !exists {
+		port, declared := config.Manifest.Ports[key]
+		if !declared || port.DefaultValue == "" {
+			return zero, fmt.Errorf("input port '%s' not found in node '%s'", key, node.Name())
+		}
+		value = port.DefaultValue
+	}
+
+	entryKey, isPointer := StripBlackboardPointer(value)
+	if !isPointer {
+		result, err := parseLiteral[T](definition, key, value)
+		if err != nil {
+			return zero, fmt.Errorf("input port '%s' of node '%s': %v", key, node.Name(), err)
+		}
+		return result, nil
+	}
+	if entryKey == "=" {
+		entryKey = key
+	}
+
+	blackboard := node.Blackboard()
+	if blackboard == nil {
+		return zero, fmt.Errorf("input port '%s' of node '%s' refers to '%s' but the node has no blackboard", key, node.Name(), entryKey)
+	}
+	entry, found := blackboard.lookup(entryKey)
+	if !found {
+		return zero, fmt.Errorf("input port '%s' of node '%s': blackboard entry '%s' not found", key, node.Name(), entryKey)
+	}
+
+	result, err := AnyCast[T](entry)
+	if err != nil {
+		return zero, fmt.Errorf("input port '%s' of node '%s': blackboard entry '%s': %v", key, node.Name(), entryKey, err)
+	}
+	return result, nil
+}
+
+// SetOutput writes value to the blackboard entry the output port key of node
+// refers to. Booleans and numbers of predeclared types are written without
+// allocating. The value must have the type of the entry, see Blackboard.Set.
+func SetOutput[T any](node Node, key string, value T) error {
+	blackboard, entryKey, err := outputEntry(node, key)
+	if err != nil {
+		return err
+	}
+	return blackboard.set(entryKey, AnyOf(value), false)
+}
+
+// SetOutputConverted writes value to the blackboard entry the output port
+// key of node refers to, converted to the type of the entry, see
+// Blackboard.SetConverted. Nodes writing the literal values of their ports,
+// such as SetBlackboard, use it.
+func SetOutputConverted(node Node, key string, value interface{}) error {
+	blackboard, entryKey, err := outputEntry(node, key)
+	if err != nil {
+		return err
+	}
+	return blackboard.set(entryKey, NewAny(value), true)
+}
+
+// outputEntry returns the blackboard and the entry the output port key of
+// node refers to
+func outputEntry(node Node, key string) (*Blackboard, string, error) {
+	config, _ := portConfig(node)
+
+	remapped, exists := config.OutputPorts[key]
+	if !exists {
+		return nil, "", fmt.Errorf("output port '%s' not found in node '%s'", key, node.Name())
+	}
+
+	entryKey, isPointer := StripBlackboardPointer(remapped)
+	if !isPointer {
+		// A plain value names the entry directly
+		entryKey = remapped
+	}
+	if entryKey == "=" || entryKey == "" {
+		entryKey = key
+	}
+
+	blackboard := node.Blackboard()
+	if blackboard == nil {
+		return nil, "", fmt.Errorf("output port '%s' of node '%s': the node has no blackboard", key, node.Name())
+	}
+	return blackboard, entryKey, nil
+}
+
+// definitionHolder is implemented by nodes embedding TreeNode
+type definitionHolder interface {
+	Definition() *NodeDefinition
+}
+
+// portConfig returns the configuration holding the ports of node, without
+// copying it for the nodes embedding TreeNode, and their definition
+func portConfig(node Node) (*NodeConfig, *NodeDefinition) {
+	if holder, ok := node.(definitionHolder); ok {
+		definition := holder.Definition()
+		return &definition.config, definition
+	}
+	config := node.Config()
+	return &config, nil
+}
+
+// parseLiteral parses the literal value of an input port, or returns the
+// value parsed before for the same definition
+func parseLiteral[T any](definition *NodeDefinition, port, value string) (T, error) {
+	t := typeOf[T]()
+	if definition != nil {
+		if literal, ok := definition.literal(port, t); ok {
+			return AnyCast[T](literal)
+		}
+	}
+	result, err := ParseString[T](value)
+	if err == nil && definition != nil {
+		definition.storeLiteral(port, t, AnyOf(result))
+	}
+	return result, err
+}
+
+// castValue converts a blackboard value to T. Strings are parsed with the
+// registered converters, numbers are converted between numeric types if T
+// represents the value exactly.
+func castValue[T any](value interface{}) (T, error) {
+	var zero T
+	if result, ok := value.(T); ok {
+		return result, nil
+	}
+
+	targetType := typeOf[T]()
+	if value == nil && targetType.Kind() == reflect.Interface {
+		return zero, nil
+	}
+	if s, ok := value.(string); ok && targetType.Kind() != reflect.String {
+		return ParseString[T](s)
+	}
+
+	if value != nil {
+		source := reflect.ValueOf(value)
+		if isNumericKind(source.Kind()) && isNumericKind(targetType.Kind()) {
+			converted, err := convertNumber(source, targetType)
+			if err != nil {
+				return zero, err
+			}
+			return converted.(T), nil
+		}
+	}
+	return zero, fmt.Errorf("has type %T, expected %s", value, targetType)
+}
+
+// convertNumber converts a number to the numeric type t, failing if t can't
+// represent it exactly, see scripting.Scalar.ConvertExact
+func convertNumber(number reflect.Value, t reflect.Type) (interface{}, error) {
+	scalar := scripting.Scalar{Kind: number.Kind()}
+	switch {
+	case number.CanInt():
+		scalar.Bits = uint64(number.Int())
+	case number.CanUint():
+		scalar.Bits = number.Uint()
+	case number.CanFloat():
+		scalar.Bits = math.Float64bits(number.Float())
+	}
+	converted, err := scalar.ConvertExact(t.Kind())
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(converted.Interface()).Convert(t).Interface(), nil
+}
+
+func isNumericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
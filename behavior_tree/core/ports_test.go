@@ -0,0 +1,121 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPortNode(bb *Blackboard, inputs, outputs PortsRemapping, ports PortsList) *ActionNodeBase {
+	config := NodeConfig{
+		Blackboard:  bb,
+		InputPorts:  inputs,
+		OutputPorts: outputs,
+		Manifest:    TreeNodeManifest{Ports: ports},
+	}
+	node := NewActionNodeBase("node", config)
+	return &node
+}
+
+func TestGetInput(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("target", 42)
+	bb.Set("speed", "1.5")
+
+	node := newPortNode(bb, PortsRemapping{
+		"literal":  "7",
+		"pointer":  "{target}",
+		"speed":    "{=}",
+		"duration": "250ms",
+		"missing":  "{nothing}",
+	}, nil, PortsList{
+		"fallback": InputPort("int", "").WithDefault(3),
+	})
+
+	if v, err := GetInput[int](node, "literal"); err != nil || v != 7 {
+		t.Fatalf("literal: got %v, %v", v, err)
+	}
+	if v, err := GetInput[int64](node, "pointer"); err != nil || v != 42 {
+		t.Fatalf("pointer: got %v, %v", v, err)
+	}
+	if v, err := GetInput[float64](node, "speed"); err != nil || v != 1.5 {
+		t.Fatalf("speed: got %v, %v", v, err)
+	}
+	if v, err := GetInput[time.Duration](node, "duration"); err != nil || v != 250*time.Millisecond {
+		t.Fatalf("duration: got %v, %v", v, err)
+	}
+	if v, err := GetInput[int](node, "fallback"); err != nil || v != 3 {
+		t.Fatalf("fallback: got %v, %v", v, err)
+	}
+	if _, err := GetInput[int](node, "missing"); err == nil {
+		t.Fatalf("expected an error for a missing entry")
+	}
+	if _, err := GetInput[int](node, "undeclared"); err == nil {
+		t.Fatalf("expected an error for an undeclared port")
+	}
+	if _, err := GetInput[bool](node, "literal"); err == nil {
+		t.Fatalf("expected a conversion error")
+	}
+}
+
+func TestGetInput_NumericConversions(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("ratio", 3.7)
+	bb.Set("whole", 3.0)
+	bb.Set("negative", -1)
+	bb.Set("large", int64(1000))
+	bb.Set("timeout", time.Duration(-5))
+	node := newPortNode(bb, PortsRemapping{
+		"ratio":    "{ratio}",
+		"whole":    "{whole}",
+		"negative": "{negative}",
+		"large":    "{large}",
+		"timeout":  "{timeout}",
+	}, nil, nil)
+
+	if v, err := GetInput[int](node, "whole"); err != nil || v != 3 {
+		t.Fatalf("whole: got %v, %v", v, err)
+	}
+	if v, err := GetInput[int16](node, "large"); err != nil || v != 1000 {
+		t.Fatalf("large: got %v, %v", v, err)
+	}
+	for _, c := range []struct {
+		port string
+		read func() error
+		want string
+	}{
+		{"ratio", func() error { _, err := GetInput[int](node, "ratio"); return err }, "not an integer"},
+		{"negative", func() error { _, err := GetInput[uint](node, "negative"); return err }, "out of the range"},
+		{"large", func() error { _, err := GetInput[int8](node, "large"); return err }, "out of the range"},
+		{"timeout", func() error { _, err := GetInput[uint64](node, "timeout"); return err }, "out of the range"},
+	} {
+		if err := c.read(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.port, c.want, err)
+		}
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	bb := NewBlackboard()
+	node := newPortNode(bb, nil, PortsRemapping{
+		"result": "{answer}",
+		"same":   "{=}",
+	}, nil)
+
+	if err := SetOutput(node, "result", 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOutput(node, "same", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOutput(node, "undeclared", 1); err == nil {
+		t.Fatalf("expected an error for an undeclared port")
+	}
+
+	if v, _ := bb.Get("answer"); v != 42 {
+		t.Fatalf("expected answer=42, got %v", v)
+	}
+	if v, _ := bb.Get("same"); v != "value" {
+		t.Fatalf("expected same=value, got %v", v)
+	}
+}
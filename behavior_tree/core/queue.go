@@ -0,0 +1,16 @@
+package core
+
+import "reflect"
+
+// PopFront splits a slice into its first element and the remaining elements.
+// It returns false if queue is not a slice or is empty.
+func PopFront(queue interface{}) (front interface{}, rest interface{}, ok bool) {
+	if queue == nil {
+		return nil, nil, false
+	}
+	value := reflect.ValueOf(queue)
+	if value.Kind() != reflect.Slice || value.Len() == 0 {
+		return nil, queue, false
+	}
+	return value.Index(0).Interface(), value.Slice(1, value.Len()).Interface(), true
+}
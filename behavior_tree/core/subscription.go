@@ -0,0 +1,152 @@
+package core
+
+import "sync"
+
+// BlackboardEvent describes a change of a blackboard entry
+type BlackboardEvent struct {
+	// Key is the key the subscriber used, even when the entry is stored in
+	// a parent blackboard under another name
+	Key string
+	// Entry is the entry after the change, zero when it was removed
+	Entry   Entry
+	Removed bool
+}
+
+// BlackboardCallback is called after an entry changed. It runs on the
+// goroutine writing the blackboard and must not block.
+type BlackboardCallback func(event BlackboardEvent)
+
+// Subscription is returned by the Subscribe methods of blackboards and
+// nodes, Cancel stops it
+type Subscription struct {
+	mutex   sync.Mutex
+	cancels []func()
+}
+
+// Cancel stops delivering events. It is safe to call several times.
+func (s *Subscription) Cancel() {
+	s.mutex.Lock()
+	cancels := s.cancels
+	s.cancels = nil
+	s.mutex.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// Add makes Cancel also call cancel, to group several subscriptions in one
+func (s *Subscription) Add(cancel func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cancels = append(s.cancels, cancel)
+}
+
+// Subscribe calls callback every time key is written or removed. Keys read
+// through the parent chain are watched in the blackboard storing them, as
+// long as this blackboard does not hold its own entry.
+func (bb *Blackboard) Subscribe(key string, callback BlackboardCallback) *Subscription {
+	subscription := &Subscription{}
+	bb.subscribe(subscription, key, key, callback)
+	return subscription
+}
+
+// SubscribeChannel is like Subscribe but delivers the events to a channel
+// with the given buffer size. Events are dropped while the buffer is full.
+// The channel is closed by Cancel.
+func (bb *Blackboard) SubscribeChannel(key string, size int) (<-chan BlackboardEvent, *Subscription) {
+	ch := make(chan BlackboardEvent, size)
+	var mutex sync.Mutex
+	closed := false
+
+	subscription := bb.Subscribe(key, func(event BlackboardEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	})
+	subscription.Add(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		closed = true
+		close(ch)
+	})
+	return ch, subscription
+}
+
+// subscribe registers callback for key in bb and for the key it forwards to
+// in the parents. subscriberKey is the key reported in the events.
+func (bb *Blackboard) subscribe(subscription *Subscription, key, subscriberKey string, callback BlackboardCallback) {
+	if root, rootKey, ok := bb.rootKey(key); ok {
+		root.subscribe(subscription, rootKey, subscriberKey, callback)
+		return
+	}
+
+	bb.mutex.Lock()
+	if bb.subscribers == nil {
+		bb.subscribers = make(map[string]map[uint64]BlackboardCallback)
+	}
+	if bb.subscribers[key] == nil {
+		bb.subscribers[key] = make(map[uint64]BlackboardCallback)
+	}
+	bb.nextSubscriber++
+	id := bb.nextSubscriber
+	bb.subscribers[key][id] = func(event BlackboardEvent) {
+		event.Key = subscriberKey
+		callback(event)
+	}
+	external, forwarded := bb.forward(key)
+	bb.mutex.Unlock()
+
+	subscription.Add(func() {
+		bb.mutex.Lock()
+		defer bb.mutex.Unlock()
+		delete(bb.subscribers[key], id)
+		if len(bb.subscribers[key]) == 0 {
+			delete(bb.subscribers, key)
+		}
+	})
+
+	if forwarded {
+		bb.parent.subscribe(subscription, external, subscriberKey, func(event BlackboardEvent) {
+			// A local entry hides the one of the parent
+			if !bb.hasLocalKey(key) {
+				callback(event)
+			}
+		})
+	}
+}
+
+// hasLocalKey reports whether key is stored in bb itself
+func (bb *Blackboard) hasLocalKey(key string) bool {
+	bb.mutex.RLock()
+	defer bb.mutex.RUnlock()
+	_, exists := bb.entries[key]
+	return exists
+}
+
+// callbacksFor returns the callbacks subscribed to key.
+// The caller must hold the mutex.
+func (bb *Blackboard) callbacksFor(key string) []BlackboardCallback {
+	subscribers := bb.subscribers[key]
+	if len(subscribers) == 0 {
+		return nil
+	}
+	callbacks := make([]BlackboardCallback, 0, len(subscribers))
+	for _, callback := range subscribers {
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks
+}
+
+// notify calls the callbacks with event, without holding the mutex
+func notify(callbacks []BlackboardCallback, event BlackboardEvent) {
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
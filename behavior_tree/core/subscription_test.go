@@ -0,0 +1,64 @@
+package core
+
+import "testing"
+
+func TestBlackboard_Subscribe(t *testing.T) {
+	parent := NewBlackboard()
+	child := NewSubtreeBlackboard(parent)
+	child.AddSubtreeRemapping("target", "goal")
+
+	var events []BlackboardEvent
+	subscription := child.Subscribe("target", func(event BlackboardEvent) {
+		events = append(events, event)
+	})
+
+	parent.Set("goal", "castle")
+	child.Set("target", "town")
+	parent.Unset("goal")
+	parent.Set("other", 1)
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d: %v", len(events), events)
+	}
+	if events[0].Key != "target" || events[0].Entry.Value.Value() != "castle" {
+		t.Fatalf("unexpected first event %+v", events[0])
+	}
+	if events[1].Entry.Value.Value() != "town" || !events[2].Removed {
+		t.Fatalf("unexpected events %+v", events[1:])
+	}
+
+	subscription.Cancel()
+	parent.Set("goal", "village")
+	if len(events) != 3 {
+		t.Fatalf("event received after Cancel")
+	}
+}
+
+func TestBlackboard_SubscribeChannel(t *testing.T) {
+	parent := NewBlackboard()
+	child := NewBlackboardWithParent(parent)
+
+	ch, subscription := child.SubscribeChannel("hp", 1)
+	parent.Set("hp", 10)
+	parent.Set("hp", 20) // dropped, the buffer is full
+
+	event := <-ch
+	if event.Entry.Value.Value() != 10 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// A local entry hides the parent one
+	child.Set("hp", 5)
+	<-ch
+	parent.Set("hp", 30)
+	select {
+	case event := <-ch:
+		t.Fatalf("unexpected event from the hidden parent entry %+v", event)
+	default:
+	}
+
+	subscription.Cancel()
+	if _, open := <-ch; open {
+		t.Fatalf("channel not closed by Cancel")
+	}
+}
@@ -1,59 +1,203 @@
 package core
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
 )
 
-// TreeNode represents a tree node implementing TreeNodeInterface
+// TreeNode represents a tree node implementing TreeNodeInterface.
+// The immutable part of the node is its NodeDefinition, possibly shared with
+// other instances; TreeNode holds the state of this instance.
+//
+// A node takes no lock: its tree is ticked by one goroutine at a time, see
+// BehaviorTree. Other goroutines may read the status and subscribe to its
+// changes while the tree is ticked. The wake up signal, the clock and the
+// children are set before the tree is first ticked.
 type TreeNode struct {
-	name     string
-	config   NodeConfig
-	status   NodeStatus
-	mutex    sync.RWMutex
-	children []Node
-	parent   *Node
+	definition *NodeDefinition
+	blackboard *Blackboard
+	wakeUp     *WakeUpSignal
+	clock      Clock
+	status     atomic.Int32
+	children   []Node
+	parent     *Node
+	self       Node
+	// ctx is the context of the last tick
+	ctx context.Context
+
+	// statusSubscribers is replaced, never modified, when a subscription
+	// is added or cancelled, so that SetStatus reads it without locking
+	statusSubscribers atomic.Pointer[[]statusSubscriber]
+	nextSubscriber    atomic.Uint64
+}
+
+// statusSubscriber is a status change subscription of a node
+type statusSubscriber struct {
+	id       uint64
+	callback StatusChangeCallback
+}
+
+// StatusChange describes a status transition of a node
+type StatusChange struct {
+	Node      Node
+	Previous  NodeStatus
+	Status    NodeStatus
+	Timestamp time.Time
 }
 
-// NewTreeNode creates a new tree node
+// StatusChangeCallback is called after a node changed status, on the
+// goroutine ticking the tree. It must not block.
+type StatusChangeCallback func(change StatusChange)
+
+// NewTreeNode creates a new tree node. Without config.Definition, a new
+// definition is created: pre and post condition scripts are parsed once
+// here and it panics if one is invalid.
 func NewTreeNode(name string, config NodeConfig) TreeNode {
+	definition := config.Definition
+	if definition == nil {
+		definition = NewNodeDefinition(name, config)
+	}
 	return TreeNode{
-		name:   name,
-		config: config,
-		status: NodeStatusIdle,
+		definition: definition,
+		blackboard: config.Blackboard,
+		wakeUp:     config.WakeUp,
+		clock:      config.Clock,
 	}
 }
 
+// parseConditionScripts parses the pre and post condition scripts of config
+func parseConditionScripts(name string, config NodeConfig) (pre [PreCondCount]*scripting.Script, post [PostCondCount]*scripting.Script) {
+	for cond, code := range config.PreConditions {
+		if code == "" || cond < 0 || cond >= PreCondCount {
+			continue
+		}
+		script, err := scripting.Parse(code)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid %s in %s: %v", cond, name, err))
+		}
+		pre[cond] = script
+	}
+	for cond, code := range config.PostConditions {
+		if code == "" || cond < 0 || cond >= PostCondCount {
+			continue
+		}
+		script, err := scripting.Parse(code)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid %s in %s: %v", cond, name, err))
+		}
+		post[cond] = script
+	}
+	return pre, post
+}
+
 // Name returns the name of the node
 func (tn *TreeNode) Name() string {
-	return tn.name
+	return tn.definition.name
+}
+
+// Definition returns the immutable part of the node
+func (tn *TreeNode) Definition() *NodeDefinition {
+	return tn.definition
 }
 
 // Status returns the current status of the node
 func (tn *TreeNode) Status() NodeStatus {
-	tn.mutex.RLock()
-	defer tn.mutex.RUnlock()
-	return tn.status
+	return NodeStatus(tn.status.Load())
 }
 
-// SetStatus sets the status of the node
+// SetStatus sets the status of the node and notifies the status change
+// subscribers if it changed
 func (tn *TreeNode) SetStatus(status NodeStatus) {
-	tn.mutex.Lock()
-	defer tn.mutex.Unlock()
-	tn.status = status
+	previous := NodeStatus(tn.status.Swap(int32(status)))
+	if previous == status {
+		return
+	}
+	subscribers := tn.statusSubscribers.Load()
+	if subscribers == nil {
+		return
+	}
+
+	change := StatusChange{
+		Node:      tn.Self(),
+		Previous:  previous,
+		Status:    status,
+		Timestamp: tn.Clock().Now(),
+	}
+	for _, subscriber := range *subscribers {
+		subscriber.callback(change)
+	}
+}
+
+// SubscribeToStatusChange calls callback every time the node changes status
+func (tn *TreeNode) SubscribeToStatusChange(callback StatusChangeCallback) *Subscription {
+	id := tn.nextSubscriber.Add(1)
+	tn.updateStatusSubscribers(func(subscribers []statusSubscriber) []statusSubscriber {
+		return append(subscribers, statusSubscriber{id: id, callback: callback})
+	})
+
+	subscription := &Subscription{}
+	subscription.Add(func() {
+		tn.updateStatusSubscribers(func(subscribers []statusSubscriber) []statusSubscriber {
+			for i, subscriber := range subscribers {
+				if subscriber.id == id {
+					return append(subscribers[:i], subscribers[i+1:]...)
+				}
+			}
+			return subscribers
+		})
+	})
+	return subscription
+}
+
+// updateStatusSubscribers replaces the subscribers by update applied to a
+// copy of them. An empty list is stored as nil.
+func (tn *TreeNode) updateStatusSubscribers(update func([]statusSubscriber) []statusSubscriber) {
+	for {
+		current := tn.statusSubscribers.Load()
+		var subscribers []statusSubscriber
+		if current != nil {
+			subscribers = append(subscribers, *current...)
+		}
+		var next *[]statusSubscriber
+		if subscribers = update(subscribers); len(subscribers) > 0 {
+			next = &subscribers
+		}
+		if tn.statusSubscribers.CompareAndSwap(current, next) {
+			return
+		}
+	}
 }
 
-// Config returns the node configuration
+// ClearStatusSubscribers cancels every status change subscription of the node
+func (tn *TreeNode) ClearStatusSubscribers() {
+	tn.statusSubscribers.Store(nil)
+}
+
+// Config returns the node configuration. The maps are shared with the
+// definition and must not be modified.
 func (tn *TreeNode) Config() NodeConfig {
-	return tn.config
+	config := tn.definition.config
+	config.Blackboard = tn.blackboard
+	config.WakeUp = tn.wakeUp
+	config.Clock = tn.clock
+	return config
 }
 
 // Blackboard returns the blackboard associated with this node
 func (tn *TreeNode) Blackboard() *Blackboard {
-	return tn.config.Blackboard
+	return tn.blackboard
 }
 
-// AddChild adds a child node
+// AddChild adds a child node and binds it to its concrete implementation
 func (tn *TreeNode) AddChild(child Node) {
+	child.SetSelf(child)
+	parent := tn.Self()
+	child.SetParent(&parent)
 	tn.children = append(tn.children, child)
 }
 
@@ -72,6 +216,21 @@ func (tn *TreeNode) Parent() *Node {
 	return tn.parent
 }
 
+// SetSelf binds the node to the concrete type embedding this TreeNode, so that
+// ExecuteTick and HaltAndReset dispatch to the overriding Tick and Halt methods.
+// AddChild and NewBehaviorTree call it automatically.
+func (tn *TreeNode) SetSelf(self Node) {
+	tn.self = self
+}
+
+// Self returns the concrete node embedding this TreeNode
+func (tn *TreeNode) Self() Node {
+	if tn.self == nil {
+		return tn
+	}
+	return tn.self
+}
+
 // Tick is the main execution method that must be implemented by derived classes
 // For the base TreeNode, we return SUCCESS as a default behavior
 func (tn *TreeNode) Tick() NodeStatus {
@@ -90,23 +249,25 @@ func (tn *TreeNode) Type() NodeType {
 
 // UID returns the unique identifier of the node
 func (tn *TreeNode) UID() uint16 {
-	return tn.config.UID
+	return tn.definition.config.UID
 }
 
 // Manifest returns the node manifest
 func (tn *TreeNode) Manifest() TreeNodeManifest {
-	return tn.config.Manifest
+	return tn.definition.config.Manifest
 }
 
-// GetInput retrieves an input port value
+// GetInput retrieves the raw, unresolved value of an input port.
+// Use the generic GetInput function to read a typed value.
 func (tn *TreeNode) GetInput(key string) (string, bool) {
 	// First check if the key exists in the input ports remapping
-	if value, exists := tn.config.InputPorts[key]; exists {
+	config := &tn.definition.config
+	if value, exists := config.InputPorts[key]; exists {
 		return value, true
 	}
 
 	// If not found in input ports, check if it's defined in manifest as input/inout port
-	if portInfo, exists := tn.config.Manifest.Ports[key]; exists {
+	if portInfo, exists := config.Manifest.Ports[key]; exists {
 		if portInfo.Direction == PortDirectionInput || portInfo.Direction == PortDirectionInOut {
 			// Return empty string with true to indicate the port exists but has no value
 			return "", true
@@ -115,33 +276,176 @@ func (tn *TreeNode) GetInput(key string) (string, bool) {
 	return "", false
 }
 
-// ExecuteTick executes a tick and handles status changes
-func (tn *TreeNode) ExecuteTick() NodeStatus {
-	if tn.Status() == NodeStatusRunning {
-		newStatus := tn.Tick()
-		tn.SetStatus(newStatus)
-		return newStatus
+// ExecuteTick executes a tick and handles status changes.
+// Pre-conditions may skip the tick or force its result, post-conditions
+// run once the node completes. ctx is available to Tick through Context;
+// control and decorator nodes pass it on to their children.
+func (tn *TreeNode) ExecuteTick(ctx context.Context) NodeStatus {
+	tn.ctx = ctx
+	if tn.Status() != NodeStatusRunning {
+		// If not running, start fresh
+		tn.SetStatus(NodeStatusIdle)
 	}
 
-	// If not running, start fresh
-	tn.SetStatus(NodeStatusIdle)
-	newStatus := tn.Tick()
+	newStatus, overridden := tn.checkPreConditions()
+	if !overridden {
+		newStatus = tn.Self().Tick()
+	}
+	tn.checkPostConditions(newStatus)
+
 	tn.SetStatus(newStatus)
 	return newStatus
 }
 
+// Context returns the context of the tick in progress, or of the last tick
+// while the node is halted. It is context.Background() before the first tick.
+func (tn *TreeNode) Context() context.Context {
+	if tn.ctx == nil {
+		return context.Background()
+	}
+	return tn.ctx
+}
+
 // HaltAndReset halts the node and resets its status to Idle
-func (tnb *TreeNode) HaltAndReset() {
-	tnb.Halt()
-	tnb.SetStatus(NodeStatusIdle)
+func (tn *TreeNode) HaltAndReset() {
+	wasRunning := tn.Status() == NodeStatusRunning
+	tn.Self().Halt()
+	if wasRunning {
+		tn.runPostCondition(PostCondOnHalted)
+	}
+	tn.SetStatus(NodeStatusIdle)
 }
 
-// RequiresWakeUp returns whether the node requires wake up signal
-func (tnb *TreeNode) RequiresWakeUp() bool {
-	return false
+// HaltErrorReporter is implemented by nodes whose cleanup on Halt can fail,
+// such as StatefulActionNode
+type HaltErrorReporter interface {
+	// HaltError returns the error of the last Halt, nil if it succeeded
+	HaltError() error
 }
 
-// EmitWakeUpSignal emits wake up signal (placeholder implementation)
-func (tnb *TreeNode) EmitWakeUpSignal() {
-	// Placeholder implementation
+// HaltRunning halts and resets the RUNNING nodes of the subtree of node,
+// deepest first: the children before their parent, the siblings in order.
+// Every RUNNING node gets Halt even if another one failed to clean up; the
+// errors reported by the nodes are returned joined.
+func HaltRunning(node Node) error {
+	var errs []error
+	haltRunning(node, &errs)
+	return errors.Join(errs...)
+}
+
+func haltRunning(node Node, errs *[]error) {
+	for _, child := range node.Children() {
+		haltRunning(child, errs)
+	}
+	if node.Status() != NodeStatusRunning {
+		return
+	}
+	node.HaltAndReset()
+	if reporter, ok := node.(HaltErrorReporter); ok {
+		if err := reporter.HaltError(); err != nil {
+			*errs = append(*errs, fmt.Errorf("halt %s: %w", node.Name(), err))
+		}
+	}
+}
+
+// checkPreConditions evaluates the pre-condition scripts. It returns the
+// status to use instead of ticking the node, if any.
+// A script that fails to execute makes the node fail.
+func (tn *TreeNode) checkPreConditions() (NodeStatus, bool) {
+	status := tn.Status()
+
+	for cond := PreCond(0); cond < PreCondCount; cond++ {
+		script := tn.definition.preScripts[cond]
+		if script == nil {
+			continue
+		}
+
+		result, err := script.EvalBool(tn.blackboard, tn.definition.config.Enums)
+		if err != nil {
+			return NodeStatusFailure, true
+		}
+
+		// Only _while is checked again while the node is running
+		if status == NodeStatusIdle || status == NodeStatusSkipped {
+			if result {
+				switch cond {
+				case PreCondFailureIf:
+					return NodeStatusFailure, true
+				case PreCondSuccessIf:
+					return NodeStatusSuccess, true
+				case PreCondSkipIf:
+					return NodeStatusSkipped, true
+				}
+			} else if cond == PreCondWhileTrue {
+				return NodeStatusSkipped, true
+			}
+		} else if status == NodeStatusRunning && cond == PreCondWhileTrue && !result {
+			tn.HaltAndReset()
+			return NodeStatusSkipped, true
+		}
+	}
+	return NodeStatusIdle, false
+}
+
+// checkPostConditions runs the post-condition scripts matching status
+func (tn *TreeNode) checkPostConditions(status NodeStatus) {
+	switch status {
+	case NodeStatusSuccess:
+		tn.runPostCondition(PostCondOnSuccess)
+	case NodeStatusFailure:
+		tn.runPostCondition(PostCondOnFailure)
+	default:
+		return
+	}
+	tn.runPostCondition(PostCondAlways)
+}
+
+// runPostCondition executes a single post-condition script.
+// Errors are ignored: the node status has already been decided.
+func (tn *TreeNode) runPostCondition(cond PostCond) {
+	if script := tn.definition.postScripts[cond]; script != nil {
+		_ = script.Run(tn.blackboard, tn.definition.config.Enums)
+	}
+}
+
+// SetWakeUpSignal sets the signal emitted by EmitWakeUpSignal, normally the
+// signal of the tree the node belongs to
+func (tn *TreeNode) SetWakeUpSignal(signal *WakeUpSignal) {
+	tn.wakeUp = signal
+}
+
+// RequiresWakeUp returns whether the node can wake up its tree
+func (tn *TreeNode) RequiresWakeUp() bool {
+	return tn.wakeUp != nil
+}
+
+// EmitWakeUpSignal wakes up the tree, so that it is ticked again without
+// waiting. Asynchronous nodes call it when their state changes, also from
+// other goroutines.
+func (tn *TreeNode) EmitWakeUpSignal() {
+	if tn.wakeUp != nil {
+		tn.wakeUp.Emit()
+	}
+}
+
+// RequestWakeUpAt asks the tree to tick again at deadline, according to the
+// clock of the node. Nodes waiting for a time call it on every tick they
+// return RUNNING, instead of starting their own timer.
+func (tn *TreeNode) RequestWakeUpAt(deadline time.Time) {
+	if tn.wakeUp != nil {
+		tn.wakeUp.EmitAt(deadline)
+	}
+}
+
+// SetClock sets the clock of the node, normally the clock of its tree
+func (tn *TreeNode) SetClock(clock Clock) {
+	tn.clock = clock
+}
+
+// Clock returns the clock of the node
+func (tn *TreeNode) Clock() Clock {
+	if tn.clock == nil {
+		return SystemClock
+	}
+	return tn.clock
 }
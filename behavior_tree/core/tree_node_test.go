@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func newCountingAction(bb *Blackboard, pre map[PreCond]string, post map[PostCond]string, ticks *int, result NodeStatus) *ActionNode {
+	config := NodeConfig{Blackboard: bb, PreConditions: pre, PostConditions: post}
+	node := &ActionNode{
+		ActionNodeBase: NewActionNodeBase("action", config),
+		tickFunc: func() NodeStatus {
+			*ticks++
+			return result
+		},
+	}
+	node.SetSelf(node)
+	return node
+}
+
+func TestTreeNode_PreConditions(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("hp", 10)
+
+	cases := []struct {
+		pre  map[PreCond]string
+		want NodeStatus
+		tick bool
+	}{
+		{map[PreCond]string{PreCondSkipIf: "hp > 5"}, NodeStatusSkipped, false},
+		{map[PreCond]string{PreCondSkipIf: "hp > 50"}, NodeStatusFailure, true},
+		{map[PreCond]string{PreCondFailureIf: "hp == 10"}, NodeStatusFailure, false},
+		{map[PreCond]string{PreCondSuccessIf: "hp == 10"}, NodeStatusSuccess, false},
+		{map[PreCond]string{PreCondWhileTrue: "hp < 0"}, NodeStatusSkipped, false},
+		{map[PreCond]string{PreCondFailureIf: "missing"}, NodeStatusFailure, false},
+	}
+
+	for _, c := range cases {
+		ticks := 0
+		node := newCountingAction(bb, c.pre, nil, &ticks, NodeStatusFailure)
+		if got := node.ExecuteTick(context.Background()); got != c.want {
+			t.Fatalf("%v: expected %s, got %s", c.pre, c.want, got)
+		}
+		if (ticks == 1) != c.tick {
+			t.Fatalf("%v: unexpected tick count %d", c.pre, ticks)
+		}
+	}
+}
+
+func TestTreeNode_WhileHaltsRunningNode(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("active", true)
+	bb.Set("halted", false)
+
+	ticks := 0
+	node := newCountingAction(bb,
+		map[PreCond]string{PreCondWhileTrue: "active"},
+		map[PostCond]string{PostCondOnHalted: "halted = true"},
+		&ticks, NodeStatusRunning)
+
+	if got := node.ExecuteTick(context.Background()); got != NodeStatusRunning {
+		t.Fatalf("expected RUNNING, got %s", got)
+	}
+
+	bb.Set("active", false)
+	if got := node.ExecuteTick(context.Background()); got != NodeStatusSkipped {
+		t.Fatalf("expected SKIPPED, got %s", got)
+	}
+	if ticks != 1 {
+		t.Fatalf("expected a single tick, got %d", ticks)
+	}
+	if halted, _ := bb.Get("halted"); halted != true {
+		t.Fatalf("expected _onHalted to run")
+	}
+}
+
+func TestTreeNode_PostConditions(t *testing.T) {
+	bb := NewBlackboard()
+	bb.Set("wins", 0)
+	bb.Set("losses", 0)
+	bb.Set("done", 0)
+
+	post := map[PostCond]string{
+		PostCondOnSuccess: "wins += 1",
+		PostCondOnFailure: "losses += 1",
+		PostCondAlways:    "done += 1",
+	}
+
+	ticks := 0
+	newCountingAction(bb, nil, post, &ticks, NodeStatusSuccess).ExecuteTick(context.Background())
+	newCountingAction(bb, nil, post, &ticks, NodeStatusFailure).ExecuteTick(context.Background())
+	newCountingAction(bb, nil, post, &ticks, NodeStatusRunning).ExecuteTick(context.Background())
+
+	for key, want := range map[string]int{"wins": 1, "losses": 1, "done": 2} {
+		if got, _ := bb.Get(key); got != want {
+			t.Fatalf("expected %s=%d, got %v", key, want, got)
+		}
+	}
+}
+
+func TestTreeNode_InvalidConditionPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic for invalid script")
+		}
+	}()
+	NewTreeNode("bad", NodeConfig{PreConditions: map[PreCond]string{PreCondSkipIf: "1 +"}})
+}
+
+func TestTreeNode_StatusSubscriptions(t *testing.T) {
+	var ticks int
+	node := newCountingAction(nil, nil, nil, &ticks, NodeStatusSuccess)
+
+	var changes []StatusChange
+	first := node.SubscribeToStatusChange(func(change StatusChange) {
+		changes = append(changes, change)
+	})
+	var second int
+	subscription := node.SubscribeToStatusChange(func(StatusChange) { second++ })
+	node.ExecuteTick(context.Background())
+	subscription.Cancel()
+	node.SetStatus(NodeStatusIdle)
+
+	if len(changes) != 2 || changes[0].Status != NodeStatusSuccess || changes[1].Previous != NodeStatusSuccess || second != 1 {
+		t.Fatalf("unexpected changes %+v, %d", changes, second)
+	}
+	first.Cancel()
+
+	// Subscribing from another goroutine while the node is ticked
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			node.SubscribeToStatusChange(func(StatusChange) {}).Cancel()
+			_ = node.Status()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		node.ExecuteTick(context.Background())
+		node.SetStatus(NodeStatusIdle)
+	}
+	<-done
+	if allocs := testing.AllocsPerRun(100, func() { node.ExecuteTick(context.Background()) }); allocs != 0 {
+		t.Fatalf("expected no allocation, got %v", allocs)
+	}
+}
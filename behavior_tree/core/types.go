@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -62,6 +64,23 @@ func (ns NodeStatus) String() string {
 	}
 }
 
+// ParseNodeStatus converts a status name such as "SUCCESS" to a NodeStatus
+func ParseNodeStatus(s string) (NodeStatus, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "IDLE":
+		return NodeStatusIdle, nil
+	case "RUNNING":
+		return NodeStatusRunning, nil
+	case "SUCCESS":
+		return NodeStatusSuccess, nil
+	case "FAILURE":
+		return NodeStatusFailure, nil
+	case "SKIPPED":
+		return NodeStatusSkipped, nil
+	}
+	return NodeStatusIdle, fmt.Errorf("invalid node status '%s'", s)
+}
+
 // IsStatusActive returns true if status is not IDLE or SKIPPED
 func IsStatusActive(status NodeStatus) bool {
 	return status != NodeStatusIdle && status != NodeStatusSkipped
@@ -81,9 +100,27 @@ const (
 	PortDirectionInOut
 )
 
+func (pd PortDirection) String() string {
+	switch pd {
+	case PortDirectionInput:
+		return "Input"
+	case PortDirectionOutput:
+		return "Output"
+	case PortDirectionInOut:
+		return "InOut"
+	default:
+		return "UNDEFINED"
+	}
+}
+
 // Timestamp represents a timestamp for blackboard entries
 type Timestamp time.Time
 
+// Time returns the timestamp as a time.Time
+func (t Timestamp) Time() time.Time {
+	return time.Time(t)
+}
+
 // KeyValue represents a key-value pair
 type KeyValue struct {
 	Key   string
@@ -134,11 +171,44 @@ type PortInfo struct {
 	TypeName     string
 	Description  string
 	DefaultValue string
+	// Required tells that the node can't run without the input port, so
+	// that the validator reports it when it is missing
+	Required bool
+}
+
+// InputPort creates the description of an input port
+func InputPort(typeName string, description string) PortInfo {
+	return PortInfo{Direction: PortDirectionInput, TypeName: typeName, Description: description}
+}
+
+// OutputPort creates the description of an output port
+func OutputPort(typeName string, description string) PortInfo {
+	return PortInfo{Direction: PortDirectionOutput, TypeName: typeName, Description: description}
+}
+
+// InOutPort creates the description of a bidirectional port
+func InOutPort(typeName string, description string) PortInfo {
+	return PortInfo{Direction: PortDirectionInOut, TypeName: typeName, Description: description}
+}
+
+// WithDefault returns a copy of the port with a default value
+func (p PortInfo) WithDefault(value interface{}) PortInfo {
+	p.SetDefaultValue(value)
+	return p
+}
+
+// AsRequired returns a copy of the port marked as required
+func (p PortInfo) AsRequired() PortInfo {
+	p.Required = true
+	return p
 }
 
 // SetDefaultValue sets the default value for the port
 func (p *PortInfo) SetDefaultValue(value interface{}) {
-	// For simplicity, convert to string representation
+	if s, err := ConvertToString(value); err == nil {
+		p.DefaultValue = s
+		return
+	}
 	p.DefaultValue = fmt.Sprintf("%v", value)
 }
 
@@ -158,6 +228,22 @@ const (
 	PreCondCount
 )
 
+// String returns the XML attribute name of the pre-condition
+func (pc PreCond) String() string {
+	switch pc {
+	case PreCondFailureIf:
+		return "_failureIf"
+	case PreCondSuccessIf:
+		return "_successIf"
+	case PreCondSkipIf:
+		return "_skipIf"
+	case PreCondWhileTrue:
+		return "_while"
+	default:
+		return "UNDEFINED"
+	}
+}
+
 // PostCond defines post-condition types
 type PostCond int
 
@@ -169,6 +255,22 @@ const (
 	PostCondCount
 )
 
+// String returns the XML attribute name of the post-condition
+func (pc PostCond) String() string {
+	switch pc {
+	case PostCondOnHalted:
+		return "_onHalted"
+	case PostCondOnFailure:
+		return "_onFailure"
+	case PostCondOnSuccess:
+		return "_onSuccess"
+	case PostCondAlways:
+		return "_post"
+	default:
+		return "UNDEFINED"
+	}
+}
+
 // NodeConfig contains configuration for a tree node
 type NodeConfig struct {
 	Blackboard      *Blackboard
@@ -181,6 +283,13 @@ type NodeConfig struct {
 	Path            string
 	PreConditions   map[PreCond]string
 	PostConditions  map[PostCond]string
+	WakeUp          *WakeUpSignal
+	// Clock tells the time to the node, SystemClock when nil
+	Clock Clock
+	// Definition, when set, is the shared immutable part of the node,
+	// created from the other fields. NewTreeNode uses it instead of creating
+	// a new one; tree templates set it when cloning their nodes.
+	Definition *NodeDefinition
 }
 
 // TreeNodeManifest contains information about a tree node
@@ -205,14 +314,16 @@ type Node interface {
 	Name() string
 	Status() NodeStatus
 	SetStatus(NodeStatus)
+	SubscribeToStatusChange(StatusChangeCallback) *Subscription
 	Config() NodeConfig
 	Blackboard() *Blackboard
 	AddChild(Node)
 	Children() []Node
 	SetParent(*Node)
 	Parent() *Node
+	SetSelf(Node)
 	Tick() NodeStatus
-	ExecuteTick() NodeStatus
+	ExecuteTick(ctx context.Context) NodeStatus
 	Halt()
 	HaltAndReset()
 	RequiresWakeUp() bool
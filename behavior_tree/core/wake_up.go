@@ -0,0 +1,82 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// WakeUpSignal wakes up a tree waiting between two ticks. Signals emitted
+// while nobody waits are coalesced into one. Nodes waiting for a time
+// request a deadline instead, the tree waits until the earliest one.
+type WakeUpSignal struct {
+	ch chan struct{}
+
+	mutex       sync.Mutex
+	deadline    time.Time
+	hasDeadline bool
+}
+
+// NewWakeUpSignal creates a new wake up signal
+func NewWakeUpSignal() *WakeUpSignal {
+	return &WakeUpSignal{ch: make(chan struct{}, 1)}
+}
+
+// Emit wakes up the waiting tree, it never blocks
+func (w *WakeUpSignal) Emit() {
+	select {
+	case w.ch <- struct{}{}:
+	default:
+	}
+}
+
+// C returns the channel receiving the signals
+func (w *WakeUpSignal) C() <-chan struct{} {
+	return w.ch
+}
+
+// WaitFor waits for a signal up to timeout and reports whether one was received
+func (w *WakeUpSignal) WaitFor(timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case <-w.ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ch:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// EmitAt asks to wake up the tree at deadline. Only the earliest deadline
+// requested since the last ClearDeadline is kept.
+func (w *WakeUpSignal) EmitAt(deadline time.Time) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.hasDeadline || deadline.Before(w.deadline) {
+		w.deadline = deadline
+		w.hasDeadline = true
+	}
+}
+
+// Deadline returns the earliest deadline requested with EmitAt
+func (w *WakeUpSignal) Deadline() (time.Time, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.deadline, w.hasDeadline
+}
+
+// ClearDeadline forgets the requested deadline. The tree calls it before
+// every tick, nodes still waiting request their deadline again.
+func (w *WakeUpSignal) ClearDeadline() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.hasDeadline = false
+}
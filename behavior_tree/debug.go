@@ -0,0 +1,166 @@
+package behavior_tree
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// debugState holds the pause and breakpoint state of a tree
+type debugState struct {
+	mutex        sync.Mutex
+	paused       bool
+	steps        int
+	breakpoints  map[uint16]bool
+	subscription *core.Subscription
+	hit          core.Node
+	onBreak      func(node core.Node)
+	// active is set while the tree is paused or has breakpoints, so that
+	// the ticks of other trees skip the mutex
+	active atomic.Bool
+}
+
+// updateActive updates the active flag. The caller must hold the mutex.
+func (d *debugState) updateActive() {
+	active := d.paused || len(d.breakpoints) > 0
+	if !active {
+		d.hit = nil
+	}
+	d.active.Store(active)
+}
+
+// Pause stops ticking the tree: Tick returns the current status of the root
+// without ticking it until Resume or Step is called
+func (bt *BehaviorTree) Pause() {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	bt.debug.paused = true
+	bt.debug.updateActive()
+}
+
+// Resume ticks the tree again after Pause or a breakpoint
+func (bt *BehaviorTree) Resume() {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	bt.debug.paused = false
+	bt.debug.steps = 0
+	bt.debug.updateActive()
+}
+
+// Step lets the next Tick of a paused tree run, the tree stays paused after it
+func (bt *BehaviorTree) Step() {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	if bt.debug.paused {
+		bt.debug.steps++
+	}
+}
+
+// IsPaused reports whether the tree is paused
+func (bt *BehaviorTree) IsPaused() bool {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	return bt.debug.paused
+}
+
+// SetBreakpoint pauses the tree at the end of any tick that ticks the node
+// with the given UID
+func (bt *BehaviorTree) SetBreakpoint(uid uint16) {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+
+	if bt.debug.breakpoints == nil {
+		bt.debug.breakpoints = make(map[uint16]bool)
+	}
+	bt.debug.breakpoints[uid] = true
+	if bt.debug.subscription == nil {
+		bt.debug.subscription = bt.SubscribeToStatusChange(bt.checkBreakpoint)
+	}
+	bt.debug.updateActive()
+}
+
+// ClearBreakpoint removes the breakpoint on the node with the given UID
+func (bt *BehaviorTree) ClearBreakpoint(uid uint16) {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+
+	delete(bt.debug.breakpoints, uid)
+	if len(bt.debug.breakpoints) == 0 && bt.debug.subscription != nil {
+		bt.debug.subscription.Cancel()
+		bt.debug.subscription = nil
+	}
+	bt.debug.updateActive()
+}
+
+// Breakpoints returns the sorted UIDs of the nodes with a breakpoint
+func (bt *BehaviorTree) Breakpoints() []uint16 {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+
+	uids := make([]uint16, 0, len(bt.debug.breakpoints))
+	for uid := range bt.debug.breakpoints {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids
+}
+
+// OnBreakpoint sets the function called when a breakpoint pauses the tree
+func (bt *BehaviorTree) OnBreakpoint(handler func(node core.Node)) {
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	bt.debug.onBreak = handler
+}
+
+// checkBreakpoint records the first node with a breakpoint ticked during a tick
+func (bt *BehaviorTree) checkBreakpoint(change core.StatusChange) {
+	if change.Status == core.NodeStatusIdle {
+		return
+	}
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+	if bt.debug.hit == nil && bt.debug.breakpoints[change.Node.Config().UID] {
+		bt.debug.hit = change.Node
+	}
+}
+
+// beginTick reports whether the tree may be ticked
+func (bt *BehaviorTree) beginTick() bool {
+	if !bt.debug.active.Load() {
+		return true
+	}
+	bt.debug.mutex.Lock()
+	defer bt.debug.mutex.Unlock()
+
+	if !bt.debug.paused {
+		return true
+	}
+	if bt.debug.steps > 0 {
+		bt.debug.steps--
+		return true
+	}
+	return false
+}
+
+// endTick pauses the tree if a breakpoint was hit during the tick
+func (bt *BehaviorTree) endTick() {
+	if !bt.debug.active.Load() {
+		return
+	}
+	bt.debug.mutex.Lock()
+	hit := bt.debug.hit
+	bt.debug.hit = nil
+	handler := bt.debug.onBreak
+	if hit != nil {
+		bt.debug.paused = true
+		bt.debug.steps = 0
+		bt.debug.updateActive()
+	}
+	bt.debug.mutex.Unlock()
+
+	if hit != nil && handler != nil {
+		handler(hit)
+	}
+}
@@ -0,0 +1,371 @@
+// Package debugger serves a live view of a behavior tree over a local TCP or
+// Unix socket, for tree editors and debugging tools.
+//
+// The protocol is newline-delimited JSON. Clients send requests:
+//
+//	{"id": 1, "cmd": "tree"}
+//
+// and receive one response per request, with the same id:
+//
+//	{"id": 1, "ok": true, "result": ...}
+//	{"id": 1, "ok": false, "error": "unknown command 'foo'"}
+//
+// Commands:
+//
+//	tree              result: {"nodes": [node...]} in depth-first order, where
+//	                  node is {"uid", "parent_uid" (absent for the root),
+//	                  "name", "id", "type", "path", "status"}
+//	status            result: {"paused", "breakpoints": [uid...],
+//	                  "statuses": {"<uid>": "RUNNING", ...}}
+//	pause             stop ticking, Tick returns the current root status
+//	resume            tick again
+//	step              let one tick of the paused tree run
+//	set_breakpoint    "uid": pause the tree after a tick that ticks the node
+//	clear_breakpoint  "uid": remove the breakpoint
+//	get               "key": result {"key", "type", "value"}, value is the
+//	                  string form of the entry, see core.ConvertToString
+//	set               "key", "value": write the string value, converted to
+//	                  the type of an existing entry
+//	blackboard        result: the core.BlackboardSnapshot of the tree
+//
+// The server also pushes events to every client:
+//
+//	{"event": "status", "uid", "path", "previous", "status", "timestamp_us"}
+//	{"event": "breakpoint", "uid", "path"}
+//
+// Events are dropped for clients that do not read them fast enough, ticking
+// never waits for a client.
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// clientBuffer is the number of messages queued for a client
+const clientBuffer = 1024
+
+// Request is a command sent by a client
+type Request struct {
+	ID    int64  `json:"id"`
+	Cmd   string `json:"cmd"`
+	UID   uint16 `json:"uid,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Response answers a Request
+type Response struct {
+	ID     int64       `json:"id"`
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// NodeInfo describes a node in the tree command
+type NodeInfo struct {
+	UID       uint16  `json:"uid"`
+	ParentUID *uint16 `json:"parent_uid,omitempty"`
+	Name      string  `json:"name"`
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	Path      string  `json:"path"`
+	Status    string  `json:"status"`
+}
+
+// Event is pushed to the clients
+type Event struct {
+	Event       string `json:"event"`
+	UID         uint16 `json:"uid"`
+	Path        string `json:"path"`
+	Previous    string `json:"previous,omitempty"`
+	Status      string `json:"status,omitempty"`
+	TimestampUs int64  `json:"timestamp_us,omitempty"`
+}
+
+// Server publishes a tree to the clients connected to a socket
+type Server struct {
+	tree         *bt.BehaviorTree
+	listener     net.Listener
+	nodes        map[uint16]core.Node
+	subscription *core.Subscription
+
+	mutex   sync.Mutex
+	clients map[*client]bool
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type client struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+// NewServer listens on network ("tcp" or "unix") and address, and serves
+// tree. It replaces the breakpoint handler of the tree.
+func NewServer(tree *bt.BehaviorTree, network, address string) (*Server, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		tree:     tree,
+		listener: listener,
+		nodes:    make(map[uint16]core.Node),
+		clients:  make(map[*client]bool),
+	}
+	tree.ApplyVisitor(func(node core.Node) {
+		s.nodes[node.Config().UID] = node
+	})
+	s.subscription = tree.SubscribeToStatusChange(s.onStatusChange)
+	tree.OnBreakpoint(s.onBreakpoint)
+
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server and disconnects the clients
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.subscription.Cancel()
+	s.tree.OnBreakpoint(nil)
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{conn: conn, out: make(chan []byte, clientBuffer)}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[c] = true
+		s.mutex.Unlock()
+
+		s.wg.Add(2)
+		go s.write(c)
+		go s.read(c)
+	}
+}
+
+// read handles the requests of a client until it disconnects
+func (s *Server) read(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, c)
+		s.mutex.Unlock()
+		close(c.out)
+		c.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var request Request
+		response := Response{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			response = s.handle(request)
+		}
+		s.send(c, response)
+	}
+}
+
+// write sends the queued messages of a client
+func (s *Server) write(c *client) {
+	defer s.wg.Done()
+	writer := bufio.NewWriter(c.conn)
+	for message := range c.out {
+		writer.Write(message)
+		if len(c.out) == 0 {
+			if err := writer.Flush(); err != nil {
+				c.conn.Close()
+			}
+		}
+	}
+}
+
+// send queues a message for a client, dropping it if the queue is full
+func (s *Server) send(c *client, message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	select {
+	case c.out <- append(data, '\n'):
+	default:
+	}
+}
+
+// broadcast sends an event to every client
+func (s *Server) broadcast(event Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.clients {
+		s.send(c, event)
+	}
+}
+
+func (s *Server) onStatusChange(change core.StatusChange) {
+	config := change.Node.Config()
+	s.broadcast(Event{
+		Event:       "status",
+		UID:         config.UID,
+		Path:        config.Path,
+		Previous:    change.Previous.String(),
+		Status:      change.Status.String(),
+		TimestampUs: change.Timestamp.UnixMicro(),
+	})
+}
+
+func (s *Server) onBreakpoint(node core.Node) {
+	config := node.Config()
+	s.broadcast(Event{Event: "breakpoint", UID: config.UID, Path: config.Path})
+}
+
+// handle executes a request
+func (s *Server) handle(request Request) Response {
+	result, err := s.execute(request)
+	if err != nil {
+		return Response{ID: request.ID, Error: err.Error()}
+	}
+	return Response{ID: request.ID, OK: true, Result: result}
+}
+
+func (s *Server) execute(request Request) (interface{}, error) {
+	switch request.Cmd {
+	case "tree":
+		return map[string]interface{}{"nodes": s.treeNodes()}, nil
+	case "status":
+		statuses := make(map[string]string, len(s.nodes))
+		for uid, node := range s.nodes {
+			statuses[strconv.Itoa(int(uid))] = node.Status().String()
+		}
+		return map[string]interface{}{
+			"paused":      s.tree.IsPaused(),
+			"breakpoints": s.tree.Breakpoints(),
+			"statuses":    statuses,
+		}, nil
+	case "pause":
+		s.tree.Pause()
+		return nil, nil
+	case "resume":
+		s.tree.Resume()
+		return nil, nil
+	case "step":
+		s.tree.Step()
+		return nil, nil
+	case "set_breakpoint", "clear_breakpoint":
+		if _, exists := s.nodes[request.UID]; !exists {
+			return nil, fmt.Errorf("no node with uid %d", request.UID)
+		}
+		if request.Cmd == "set_breakpoint" {
+			s.tree.SetBreakpoint(request.UID)
+		} else {
+			s.tree.ClearBreakpoint(request.UID)
+		}
+		return nil, nil
+	case "get":
+		return s.getEntry(request.Key)
+	case "set":
+		blackboard, err := s.blackboard()
+		if err != nil {
+			return nil, err
+		}
+		return nil, blackboard.SetConverted(request.Key, request.Value)
+	case "blackboard":
+		blackboard, err := s.blackboard()
+		if err != nil {
+			return nil, err
+		}
+		return blackboard.Snapshot()
+	}
+	return nil, fmt.Errorf("unknown command '%s'", request.Cmd)
+}
+
+func (s *Server) blackboard() (*core.Blackboard, error) {
+	if blackboard := s.tree.Blackboard(); blackboard != nil {
+		return blackboard, nil
+	}
+	return nil, errors.New("the tree has no blackboard")
+}
+
+func (s *Server) getEntry(key string) (interface{}, error) {
+	blackboard, err := s.blackboard()
+	if err != nil {
+		return nil, err
+	}
+	entry := blackboard.GetEntry(key)
+	if entry == nil {
+		return nil, fmt.Errorf("blackboard entry '%s' not found", key)
+	}
+	value, err := core.ConvertToString(entry.Value.Value())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"key": key, "type": entry.Info.TypeName, "value": value}, nil
+}
+
+// treeNodes describes the nodes in depth-first order
+func (s *Server) treeNodes() []NodeInfo {
+	var nodes []NodeInfo
+	var visit func(node core.Node, parent *uint16)
+	visit = func(node core.Node, parent *uint16) {
+		config := node.Config()
+		uid := config.UID
+		info := NodeInfo{
+			UID:       uid,
+			ParentUID: parent,
+			Name:      node.Name(),
+			ID:        config.Manifest.RegistrationID,
+			Type:      config.Manifest.Type.String(),
+			Path:      config.Path,
+			Status:    node.Status().String(),
+		}
+		nodes = append(nodes, info)
+		for _, child := range node.Children() {
+			visit(child, &uid)
+		}
+	}
+	if root := s.tree.RootNode(); root != nil {
+		visit(root, nil)
+	}
+	return nodes
+}
@@ -0,0 +1,136 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+type testClient struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *bufio.Scanner
+	nextID  int64
+	events  []Event
+}
+
+func (c *testClient) call(request Request) Response {
+	c.nextID++
+	request.ID = c.nextID
+	data, _ := json.Marshal(request)
+	c.conn.Write(append(data, '\n'))
+
+	for c.scanner.Scan() {
+		var message struct {
+			Response
+			Event
+		}
+		if err := json.Unmarshal(c.scanner.Bytes(), &message); err != nil {
+			c.t.Fatal(err)
+		}
+		if message.Event.Event != "" {
+			c.events = append(c.events, message.Event)
+			continue
+		}
+		if message.ID != request.ID {
+			c.t.Fatalf("unexpected response id %d", message.ID)
+		}
+		return message.Response
+	}
+	c.t.Fatalf("connection closed: %v", c.scanner.Err())
+	return Response{}
+}
+
+func TestServer(t *testing.T) {
+	tree, err := bt.NewXMLParser(bt.NewBehaviorTreeFactory()).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence name="root">
+      <Script name="count" code="ticks += 1" />
+      <AlwaysSuccess name="done" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Blackboard().Set("ticks", 0)
+
+	server, err := NewServer(tree, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c := &testClient{t: t, conn: conn, scanner: bufio.NewScanner(conn)}
+
+	response := c.call(Request{Cmd: "tree"})
+	nodes := response.Result.(map[string]interface{})["nodes"].([]interface{})
+	if len(nodes) != 3 || nodes[1].(map[string]interface{})["path"] != "root/count" {
+		t.Fatalf("unexpected tree %v", response.Result)
+	}
+
+	// A breakpoint pauses the tree after the tick
+	c.call(Request{Cmd: "set_breakpoint", UID: 3})
+	tree.Tick()
+	tree.Tick()
+	if !tree.IsPaused() {
+		t.Fatalf("breakpoint did not pause the tree")
+	}
+	if v, _ := tree.Blackboard().Get("ticks"); v != 1 {
+		t.Fatalf("a paused tree must not be ticked, ticks=%v", v)
+	}
+
+	c.call(Request{Cmd: "clear_breakpoint", UID: 3})
+	c.call(Request{Cmd: "step"})
+	tree.Tick()
+	tree.Tick()
+	if v, _ := tree.Blackboard().Get("ticks"); v != 2 || !tree.IsPaused() {
+		t.Fatalf("step must run exactly one tick, ticks=%v", v)
+	}
+	c.call(Request{Cmd: "resume"})
+	tree.Tick()
+
+	if response := c.call(Request{Cmd: "set", Key: "ticks", Value: "10"}); !response.OK {
+		t.Fatalf("set failed: %s", response.Error)
+	}
+	response = c.call(Request{Cmd: "get", Key: "ticks"})
+	if entry := response.Result.(map[string]interface{}); entry["value"] != "10" || entry["type"] != "int" {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+	if response := c.call(Request{Cmd: "set_breakpoint", UID: 99}); response.OK {
+		t.Fatalf("expected an error for an unknown uid")
+	}
+	if response := c.call(Request{Cmd: "oops"}); response.OK || response.Error == "" {
+		t.Fatalf("expected an error for an unknown command")
+	}
+
+	var breakpoints, transitions int
+	for _, event := range c.events {
+		switch event.Event {
+		case "breakpoint":
+			breakpoints++
+			if event.Path != "root/done" {
+				t.Fatalf("unexpected breakpoint %+v", event)
+			}
+		case "status":
+			transitions++
+		}
+	}
+	if breakpoints != 1 || transitions == 0 {
+		t.Fatalf("expected 1 breakpoint and some transitions, got %d and %d", breakpoints, transitions)
+	}
+	if tree.RootNode().Status() != core.NodeStatusSuccess {
+		t.Fatalf("unexpected root status")
+	}
+}
@@ -5,28 +5,29 @@ import (
 )
 
 // ConsumeQueue 装饰器节点 - 消费队列
+// 每次从 "queue" 弹出一个元素写入 "popped_item" 并执行子节点，
+// 直到队列为空（返回SUCCESS）或子节点失败（返回FAILURE）
 type ConsumeQueue struct {
 	core.DecoratorNode
-	queueKey string
+	runningChild bool
 }
 
 // NewConsumeQueue 创建新的ConsumeQueue实例
 func NewConsumeQueue(name string, config core.NodeConfig) *ConsumeQueue {
-	queueKey := ""
-
-	if ports := config.Manifest.Ports; ports != nil {
-		if portInfo, exists := ports["queue"]; exists {
-			queueKey = portInfo.TypeName
-		}
-	}
-
 	node := &ConsumeQueue{
 		DecoratorNode: core.NewDecoratorNode(name, config),
-		queueKey:      queueKey,
 	}
 	return node
 }
 
+// ProvidedPorts 返回ConsumeQueue提供的端口
+func (cq *ConsumeQueue) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"queue":       core.InOutPort("", "queue to consume"),
+		"popped_item": core.OutputPort("", "element popped from the queue"),
+	}
+}
+
 // Tick 执行装饰器节点逻辑
 func (cq *ConsumeQueue) Tick() core.NodeStatus {
 	children := cq.Children()
@@ -36,12 +37,49 @@ func (cq *ConsumeQueue) Tick() core.NodeStatus {
 
 	child := children[0]
 
-	blackboard := cq.Config().Blackboard
-	if blackboard == nil {
-		return core.NodeStatusFailure
+	// 继续执行上次未完成的子节点
+	if cq.runningChild {
+		status := child.ExecuteTick(cq.Context())
+		if status == core.NodeStatusRunning {
+			return core.NodeStatusRunning
+		}
+		cq.runningChild = false
+		if status == core.NodeStatusFailure {
+			return core.NodeStatusFailure
+		}
 	}
 
-	// TODO: 实现队列消费逻辑
-	// 目前直接执行子节点作为占位实现
-	return child.Tick()
+	for {
+		queue, err := core.GetInput[interface{}](cq, "queue")
+		if err != nil {
+			return core.NodeStatusFailure
+		}
+
+		front, rest, ok := core.PopFront(queue)
+		if !ok {
+			return core.NodeStatusSuccess
+		}
+		if err := core.SetOutput(cq, "queue", rest); err != nil {
+			return core.NodeStatusFailure
+		}
+		if err := core.SetOutput(cq, "popped_item", front); err != nil {
+			return core.NodeStatusFailure
+		}
+
+		cq.SetStatus(core.NodeStatusRunning)
+		status := child.ExecuteTick(cq.Context())
+		switch status {
+		case core.NodeStatusRunning:
+			cq.runningChild = true
+			return core.NodeStatusRunning
+		case core.NodeStatusFailure:
+			return core.NodeStatusFailure
+		}
+	}
+}
+
+// Halt 中断节点执行
+func (cq *ConsumeQueue) Halt() {
+	cq.runningChild = false
+	cq.DecoratorNode.Halt()
 }
@@ -2,21 +2,19 @@ package decorators
 
 import (
 	"fmt"
-	"strconv"
-	"sync"
 	"time"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
 
 // DelayNode delays the execution of its child by a specified number of milliseconds.
+// The delay is measured on the clock of the node; while it lasts the node
+// returns RUNNING and asks the tree to wake up when it ends.
 type DelayNode struct {
 	core.DecoratorNode
 	msec          uint
 	delayStarted  bool
-	delayComplete bool
-	delayAborted  bool
-	delayMutex    sync.Mutex
+	deadline      time.Time
 	readFromPorts bool
 }
 
@@ -26,90 +24,57 @@ func NewDelayNode(name string, config core.NodeConfig) *DelayNode {
 		DecoratorNode: core.NewDecoratorNode(name, config),
 		msec:          0,
 		delayStarted:  false,
-		delayComplete: false,
-		delayAborted:  false,
 		readFromPorts: true,
 	}
 
-	// Try to get delay_msec from input ports
-	if msecStr, ok := config.InputPorts["delay_msec"]; ok {
-		if msec, err := strconv.Atoi(msecStr); err == nil && msec >= 0 {
-			delayNode.msec = uint(msec)
-		}
-	}
-
 	return delayNode
 }
 
+// ProvidedPorts returns the ports provided by DelayNode
+func (dn *DelayNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"delay_msec": core.InputPort("uint", "tick the child after a few milliseconds").AsRequired(),
+	}
+}
+
 // Tick executes the delay logic
 func (dn *DelayNode) Tick() core.NodeStatus {
-	if dn.readFromPorts {
-		var delayMsec uint
-		if value, ok := dn.GetInput("delay_msec"); ok {
-			if intValue, err := strconv.ParseUint(value, 10, 32); err == nil {
-				delayMsec = uint(intValue)
-				dn.msec = delayMsec
-			} else {
+	if !dn.delayStarted {
+		if dn.readFromPorts {
+			delayMsec, err := core.GetInput[uint](dn, "delay_msec")
+			if err != nil {
 				panic(fmt.Sprintf("Invalid parameter [delay_msec] in DelayNode: %v", err))
 			}
-		} else {
-			panic("Missing parameter [delay_msec] in DelayNode")
+			dn.msec = delayMsec
 		}
-	}
 
-	if !dn.delayStarted {
-		dn.delayComplete = false
-		dn.delayAborted = false
 		dn.delayStarted = true
+		dn.deadline = dn.Clock().Now().Add(time.Duration(dn.msec) * time.Millisecond)
 		dn.SetStatus(core.NodeStatusRunning)
-
-		// Start the delay timer
-		go func() {
-			time.Sleep(time.Duration(dn.msec) * time.Millisecond)
-			dn.delayMutex.Lock()
-			dn.delayComplete = true
-			dn.delayMutex.Unlock()
-			dn.EmitWakeUpSignal()
-		}()
 	}
 
-	dn.delayMutex.Lock()
-	defer dn.delayMutex.Unlock()
+	if dn.Clock().Now().Before(dn.deadline) {
+		dn.RequestWakeUpAt(dn.deadline)
+		return core.NodeStatusRunning
+	}
 
-	if dn.delayAborted {
-		dn.delayAborted = false
+	children := dn.Children()
+	if len(children) == 0 {
 		dn.delayStarted = false
 		return core.NodeStatusFailure
 	}
 
-	if dn.delayComplete {
-		children := dn.Children()
-		if len(children) == 0 {
-			dn.delayStarted = false
-			dn.delayAborted = false
-			return core.NodeStatusFailure
-		}
-
-		child := children[0]
-		childStatus := child.Tick()
-		if core.IsStatusCompleted(childStatus) {
-			dn.delayStarted = false
-			dn.delayAborted = false
-			child.HaltAndReset()
-		}
-		return childStatus
+	child := children[0]
+	childStatus := child.ExecuteTick(dn.Context())
+	if core.IsStatusCompleted(childStatus) {
+		dn.delayStarted = false
+		child.HaltAndReset()
 	}
-
-	return core.NodeStatusRunning
+	return childStatus
 }
 
 // Halt handles halting the delay node
 func (dn *DelayNode) Halt() {
 	dn.delayStarted = false
-	dn.delayAborted = true
-	children := dn.Children()
-	if len(children) > 0 {
-		children[0].Halt()
-	}
 	dn.DecoratorNode.Halt()
 }
@@ -25,7 +25,7 @@ func (fsn *ForceSuccessNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(fsn.Context())
 
 	if core.IsStatusCompleted(status) {
 		child.HaltAndReset()
@@ -59,7 +59,7 @@ func (ffn *ForceFailureNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(ffn.Context())
 
 	if core.IsStatusCompleted(status) {
 		child.HaltAndReset()
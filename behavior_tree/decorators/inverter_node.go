@@ -26,7 +26,7 @@ func (in *InverterNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(in.Context())
 
 	switch status {
 	case core.NodeStatusSuccess:
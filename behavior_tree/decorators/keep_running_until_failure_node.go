@@ -25,10 +25,13 @@ func (kruf *KeepRunningUntilFailureNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(kruf.Context())
 
-	if status == core.NodeStatusFailure {
+	switch status {
+	case core.NodeStatusFailure:
 		return core.NodeStatusSuccess
+	case core.NodeStatusSkipped:
+		return core.NodeStatusSkipped
 	}
 
 	return core.NodeStatusRunning
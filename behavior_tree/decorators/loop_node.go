@@ -4,7 +4,7 @@ import (
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
 
-// LoopNode 装饰器循环执行子节点指定次数
+// LoopNode 装饰器循环执行子节点指定次数（num_cycles 端口，-1 表示无限循环）
 type LoopNode struct {
 	core.DecoratorNode
 	numIterations    int
@@ -13,23 +13,21 @@ type LoopNode struct {
 
 // NewLoopNode 创建新的LoopNode实例
 func NewLoopNode(name string, config core.NodeConfig) *LoopNode {
-	numIterations := -1 // -1 表示无限循环
-
-	if ports := config.Manifest.Ports; len(ports) > 0 {
-		if _, exists := ports["num_cycles"]; exists {
-			// TODO: 需要解析端口值，这里暂时使用默认值
-			numIterations = -1
-		}
-	}
-
 	node := &LoopNode{
 		DecoratorNode:    core.NewDecoratorNode(name, config),
-		numIterations:    numIterations,
+		numIterations:    -1, // -1 表示无限循环
 		currentIteration: 0,
 	}
 	return node
 }
 
+// ProvidedPorts 返回LoopNode提供的端口
+func (ln *LoopNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"num_cycles": core.InputPort("int", "execute the child N times, -1 means forever").WithDefault(-1),
+	}
+}
+
 // Tick 执行装饰器节点逻辑
 func (ln *LoopNode) Tick() core.NodeStatus {
 	children := ln.Children()
@@ -39,17 +37,26 @@ func (ln *LoopNode) Tick() core.NodeStatus {
 
 	child := children[0]
 
-	status := child.Tick()
+	// 每轮循环开始时读取循环次数，端口未设置时无限循环
+	if ln.currentIteration == 0 {
+		ln.numIterations = -1
+		if numCycles, err := core.GetInput[int](ln, "num_cycles"); err == nil {
+			ln.numIterations = numCycles
+		}
+	}
+
+	status := child.ExecuteTick(ln.Context())
 
-	if status == core.NodeStatusRunning {
-		return core.NodeStatusRunning
+	if status == core.NodeStatusRunning || status == core.NodeStatusSkipped {
+		return status
 	}
 
 	// 子节点已完成（成功或失败），开始下一次循环
 	ln.currentIteration++
 
 	// 检查是否达到指定的循环次数
-	if ln.numIterations > 0 && ln.currentIteration >= ln.numIterations {
+	if ln.numIterations >= 0 && ln.currentIteration >= ln.numIterations {
+		ln.currentIteration = 0
 		return core.NodeStatusSuccess
 	}
 
@@ -2,7 +2,6 @@ package decorators
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
@@ -30,16 +29,16 @@ func NewRepeatNode(name string, config core.NodeConfig) *RepeatNode {
 		readFromPorts: true,
 	}
 
-	// Try to get num_cycles from input ports
-	if numCyclesStr, ok := config.InputPorts[RepeatNumCycles]; ok {
-		if numCycles, err := strconv.Atoi(numCyclesStr); err == nil {
-			repeatNode.numCycles = numCycles
-		}
-	}
-
 	return repeatNode
 }
 
+// ProvidedPorts returns the ports provided by RepeatNode
+func (rn *RepeatNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		RepeatNumCycles: core.InputPort("int", "repeat a successful child up to N times, -1 means forever").AsRequired(),
+	}
+}
+
 // NewRepeatNodeFromConfig creates a new RepeatNode that reads num_cycles from ports
 func NewRepeatNodeFromConfig(name string, config core.NodeConfig) *RepeatNode {
 	return &RepeatNode{
@@ -53,15 +52,11 @@ func NewRepeatNodeFromConfig(name string, config core.NodeConfig) *RepeatNode {
 // Tick executes the repeat logic
 func (rn *RepeatNode) Tick() core.NodeStatus {
 	if rn.readFromPorts {
-		if value, ok := rn.GetInput(RepeatNumCycles); ok {
-			if intValue, err := strconv.Atoi(value); err == nil {
-				rn.numCycles = intValue
-			} else {
-				panic(fmt.Sprintf("Invalid parameter [%s] in RepeatNode: %v", RepeatNumCycles, err))
-			}
-		} else {
-			panic("Missing parameter [" + RepeatNumCycles + "] in RepeatNode")
+		numCycles, err := core.GetInput[int](rn, RepeatNumCycles)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid parameter [%s] in RepeatNode: %v", RepeatNumCycles, err))
 		}
+		rn.numCycles = numCycles
 	}
 
 	children := rn.Children()
@@ -74,7 +69,7 @@ func (rn *RepeatNode) Tick() core.NodeStatus {
 
 	for doLoop {
 		prevStatus := child.Status()
-		status := child.Tick()
+		status := child.ExecuteTick(rn.Context())
 
 		switch status {
 		case core.NodeStatusSuccess:
@@ -2,7 +2,6 @@ package decorators
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
@@ -38,29 +37,26 @@ func NewRetryNode(name string, config core.NodeConfig, maxAttempts ...int) *Retr
 		// Read from ports (for XML usage)
 		retryNode.maxAttempts = -1 // default to infinite
 		retryNode.readFromPorts = true
-
-		if numAttemptsStr, ok := config.InputPorts[RetryNumAttempts]; ok {
-			if numAttempts, err := strconv.Atoi(numAttemptsStr); err == nil {
-				retryNode.maxAttempts = numAttempts
-			}
-		}
 	}
 
 	return retryNode
 }
 
+// ProvidedPorts returns the ports provided by RetryNode
+func (rn *RetryNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		RetryNumAttempts: core.InputPort("int", "execute again a failing child up to N times, -1 means forever").AsRequired(),
+	}
+}
+
 // Tick executes the retry logic
 func (rn *RetryNode) Tick() core.NodeStatus {
 	if rn.readFromPorts {
-		if value, ok := rn.GetInput(RetryNumAttempts); ok {
-			if intValue, err := strconv.Atoi(value); err == nil {
-				rn.maxAttempts = intValue
-			} else {
-				panic(fmt.Sprintf("Invalid parameter [%s] in RetryNode: %v", RetryNumAttempts, err))
-			}
-		} else {
-			panic("Missing parameter [" + RetryNumAttempts + "] in RetryNode")
+		maxAttempts, err := core.GetInput[int](rn, RetryNumAttempts)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid parameter [%s] in RetryNode: %v", RetryNumAttempts, err))
 		}
+		rn.maxAttempts = maxAttempts
 	}
 
 	children := rn.Children()
@@ -73,7 +69,7 @@ func (rn *RetryNode) Tick() core.NodeStatus {
 
 	for doLoop {
 		prevStatus := child.Status()
-		status := child.Tick()
+		status := child.ExecuteTick(rn.Context())
 
 		switch status {
 		case core.NodeStatusSuccess:
@@ -85,10 +81,8 @@ func (rn *RetryNode) Tick() core.NodeStatus {
 			rn.tryCount++
 			// Refresh maxAttempts in case it changed in one of the child nodes
 			if rn.readFromPorts {
-				if value, ok := rn.GetInput(RetryNumAttempts); ok {
-					if intValue, err := strconv.Atoi(value); err == nil {
-						rn.maxAttempts = intValue
-					}
+				if maxAttempts, err := core.GetInput[int](rn, RetryNumAttempts); err == nil {
+					rn.maxAttempts = maxAttempts
 				}
 			}
 			doLoop = rn.tryCount < rn.maxAttempts || rn.maxAttempts == -1
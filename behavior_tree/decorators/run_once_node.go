@@ -31,9 +31,9 @@ func (ron *RunOnceNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(ron.Context())
 
-	if status != core.NodeStatusRunning {
+	if core.IsStatusCompleted(status) {
 		ron.hasRun = true
 	}
 
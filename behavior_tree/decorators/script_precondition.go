@@ -1,25 +1,39 @@
 package decorators
 
 import (
+	"fmt"
+
 	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
 )
 
 // ScriptPrecondition 装饰器节点 - 脚本前置条件
+// 脚本为真时执行子节点，否则返回 "else" 端口指定的状态（默认 FAILURE）。
+// 子节点运行期间不再重新计算条件。
 type ScriptPrecondition struct {
 	core.DecoratorNode
-	script string
+	script       *scripting.Script
+	childRunning bool
 }
 
 // NewScriptPrecondition 创建新的ScriptPrecondition实例
+// 脚本从 "if" 端口读取（BehaviorTree.CPP 的 Precondition），也接受 "code" 端口
 func NewScriptPrecondition(name string, config core.NodeConfig) *ScriptPrecondition {
-	script := ""
+	code, exists := config.InputPorts["if"]
+	if !exists {
+		code, exists = config.InputPorts["code"]
+	}
+	if !exists || code == "" {
+		panic("Missing port 'if' in " + name)
+	}
 
-	// 使用 config.Manifest.Ports 而不是 config.Props
-	if ports := config.Manifest.Ports; ports != nil {
-		if portInfo, exists := ports["script"]; exists {
-			script = portInfo.TypeName
+	script := core.SharedValue(config, "script", func() *scripting.Script {
+		script, err := scripting.Parse(code)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid script in %s: %v", name, err))
 		}
-	}
+		return script
+	})
 
 	node := &ScriptPrecondition{
 		DecoratorNode: core.NewDecoratorNode(name, config),
@@ -28,6 +42,15 @@ func NewScriptPrecondition(name string, config core.NodeConfig) *ScriptPrecondit
 	return node
 }
 
+// ProvidedPorts 返回ScriptPrecondition提供的端口
+func (sp *ScriptPrecondition) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"if":   core.InputPort("string", "condition script"),
+		"code": core.InputPort("string", "alias of 'if'"),
+		"else": core.InputPort("NodeStatus", "status returned when the condition is false").WithDefault("FAILURE"),
+	}
+}
+
 // Tick 执行装饰器节点逻辑
 func (sp *ScriptPrecondition) Tick() core.NodeStatus {
 	children := sp.Children()
@@ -37,12 +60,39 @@ func (sp *ScriptPrecondition) Tick() core.NodeStatus {
 
 	child := children[0]
 
-	blackboard := sp.Config().Blackboard
-	if blackboard == nil {
-		return core.NodeStatusFailure
+	if !sp.childRunning {
+		config := sp.Config()
+		result, err := sp.script.EvalBool(config.Blackboard, config.Enums)
+		if err != nil {
+			return core.NodeStatusFailure
+		}
+		if !result {
+			return sp.elseStatus()
+		}
 	}
 
-	// TODO: 实现脚本执行和条件检查逻辑
-	// 目前直接执行子节点作为占位实现
-	return child.Tick()
+	status := child.ExecuteTick(sp.Context())
+	sp.childRunning = (status == core.NodeStatusRunning)
+	if core.IsStatusCompleted(status) {
+		child.HaltAndReset()
+	}
+	return status
+}
+
+// Halt 重置运行状态
+func (sp *ScriptPrecondition) Halt() {
+	sp.childRunning = false
+	sp.DecoratorNode.Halt()
+}
+
+// elseStatus 读取 "else" 端口，可以是黑板指针，未设置时为 FAILURE
+func (sp *ScriptPrecondition) elseStatus() core.NodeStatus {
+	if _, exists := sp.Config().InputPorts["else"]; !exists {
+		return core.NodeStatusFailure
+	}
+	status, err := core.GetInput[core.NodeStatus](sp, "else")
+	if err != nil {
+		panic(fmt.Sprintf("Invalid parameter [else] in Precondition: %v", err))
+	}
+	return status
 }
@@ -0,0 +1,37 @@
+package decorators
+
+import "github.com/actfuns/gamekit/behavior_tree/core"
+
+// SimpleDecoratorTickFunc computes the status of a SimpleDecoratorNode from
+// the status of its child
+type SimpleDecoratorTickFunc func(childStatus core.NodeStatus, node core.Node) core.NodeStatus
+
+// SimpleDecoratorNode ticks its child and returns the status computed by a
+// function, so that decorators can be registered without a new type
+type SimpleDecoratorNode struct {
+	core.DecoratorNode
+	tickFunc SimpleDecoratorTickFunc
+}
+
+// NewSimpleDecoratorNode creates a new SimpleDecoratorNode
+func NewSimpleDecoratorNode(name string, config core.NodeConfig, tickFunc SimpleDecoratorTickFunc) *SimpleDecoratorNode {
+	return &SimpleDecoratorNode{
+		DecoratorNode: core.NewDecoratorNode(name, config),
+		tickFunc:      tickFunc,
+	}
+}
+
+// Tick ticks the child and applies the function to its status
+func (sdn *SimpleDecoratorNode) Tick() core.NodeStatus {
+	children := sdn.Children()
+	if len(children) == 0 {
+		return core.NodeStatusFailure
+	}
+
+	child := children[0]
+	childStatus := child.ExecuteTick(sdn.Context())
+	if core.IsStatusCompleted(childStatus) {
+		child.HaltAndReset()
+	}
+	return sdn.tickFunc(childStatus, sdn)
+}
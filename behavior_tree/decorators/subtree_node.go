@@ -16,7 +16,7 @@ func NewSubtreeNode(name string, config core.NodeConfig) *SubtreeNode {
 }
 
 // ProvidedPorts returns the ports provided by SubtreeNode
-func (stn *SubtreeNode) ProvidedPorts() map[string]core.PortInfo {
+func (stn *SubtreeNode) ProvidedPorts() core.PortsList {
 	port := core.PortInfo{
 		Direction: core.PortDirectionInput,
 		TypeName:  "bool",
@@ -24,7 +24,7 @@ func (stn *SubtreeNode) ProvidedPorts() map[string]core.PortInfo {
 	port.SetDefaultValue(false)
 	port.SetDescription("If true, all the ports with the same name will be remapped")
 
-	return map[string]core.PortInfo{
+	return core.PortsList{
 		"_autoremap": port,
 	}
 }
@@ -42,7 +42,7 @@ func (stn *SubtreeNode) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	childStatus := child.Tick()
+	childStatus := child.ExecuteTick(stn.Context())
 	if core.IsStatusCompleted(childStatus) {
 		child.HaltAndReset()
 	}
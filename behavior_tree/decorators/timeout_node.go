@@ -2,21 +2,20 @@ package decorators
 
 import (
 	"fmt"
-	"strconv"
-	"sync"
 	"time"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
 )
 
 // TimeoutNode adds a timeout to its child execution.
-// If the child doesn't complete within the specified time, it returns FAILURE.
+// If the child doesn't complete within the specified time, it is halted and
+// the node returns FAILURE. The time is measured on the clock of the node;
+// while the child runs the node asks the tree to wake up at the deadline.
 type TimeoutNode struct {
 	core.DecoratorNode
 	msec           uint
 	timeoutStarted bool
-	childHalted    bool
-	timeoutMutex   sync.Mutex
+	deadline       time.Time
 	readFromPorts  bool
 }
 
@@ -26,89 +25,65 @@ func NewTimeoutNode(name string, config core.NodeConfig) *TimeoutNode {
 		DecoratorNode:  core.NewDecoratorNode(name, config),
 		msec:           0,
 		timeoutStarted: false,
-		childHalted:    false,
 		readFromPorts:  true,
 	}
 
-	// Try to get msec from input ports
-	if msecStr, ok := config.InputPorts["msec"]; ok {
-		if msec, err := strconv.Atoi(msecStr); err == nil && msec >= 0 {
-			timeoutNode.msec = uint(msec)
-		}
-	}
-
 	return timeoutNode
 }
 
+// ProvidedPorts returns the ports provided by TimeoutNode
+func (tn *TimeoutNode) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"msec": core.InputPort("uint", "after a certain amount of time, halt the child and return FAILURE").AsRequired(),
+	}
+}
+
 // NewTimeoutNodeFromConfig creates a new TimeoutNode that reads msec from ports
 func NewTimeoutNodeFromConfig(name string, config core.NodeConfig) *TimeoutNode {
 	return &TimeoutNode{
 		DecoratorNode:  core.NewDecoratorNode(name, config),
 		msec:           0,
 		timeoutStarted: false,
-		childHalted:    false,
 		readFromPorts:  true,
 	}
 }
 
 // Tick executes the timeout logic
 func (tn *TimeoutNode) Tick() core.NodeStatus {
-	if tn.readFromPorts {
-		var msec uint
-		if value, ok := tn.GetInput("msec"); ok {
-			if intValue, err := strconv.ParseUint(value, 10, 32); err == nil {
-				msec = uint(intValue)
-				tn.msec = msec
-			} else {
+	if !tn.timeoutStarted {
+		if tn.readFromPorts {
+			msec, err := core.GetInput[uint](tn, "msec")
+			if err != nil {
 				panic(fmt.Sprintf("Invalid parameter [msec] in TimeoutNode: %v", err))
 			}
-		} else {
-			panic("Missing parameter [msec] in TimeoutNode")
+			tn.msec = msec
 		}
 
-	}
-
-	if !tn.timeoutStarted {
 		tn.timeoutStarted = true
+		tn.deadline = tn.Clock().Now().Add(time.Duration(tn.msec) * time.Millisecond)
 		tn.SetStatus(core.NodeStatusRunning)
-		tn.childHalted = false
-
-		if tn.msec > 0 {
-			// Start the timeout timer
-			go func() {
-				time.Sleep(time.Duration(tn.msec) * time.Millisecond)
-				tn.timeoutMutex.Lock()
-				defer tn.timeoutMutex.Unlock()
-
-				children := tn.Children()
-				if len(children) > 0 && children[0].Status() == core.NodeStatusRunning {
-					tn.childHalted = true
-					children[0].Halt()
-					tn.EmitWakeUpSignal()
-				}
-			}()
-		}
 	}
 
-	tn.timeoutMutex.Lock()
-	defer tn.timeoutMutex.Unlock()
-
-	if tn.childHalted {
+	children := tn.Children()
+	if len(children) == 0 {
 		tn.timeoutStarted = false
 		return core.NodeStatusFailure
 	}
+	child := children[0]
 
-	children := tn.Children()
-	if len(children) == 0 {
+	// A msec of 0 disables the timeout
+	if tn.msec > 0 && !tn.Clock().Now().Before(tn.deadline) {
 		tn.timeoutStarted = false
+		child.HaltAndReset()
 		return core.NodeStatusFailure
 	}
 
-	child := children[0]
-	childStatus := child.Tick()
+	childStatus := child.ExecuteTick(tn.Context())
 	if core.IsStatusCompleted(childStatus) {
 		tn.timeoutStarted = false
 		child.HaltAndReset()
+	} else if tn.msec > 0 {
+		tn.RequestWakeUpAt(tn.deadline)
 	}
 
 	return childStatus
@@ -117,10 +92,5 @@ func (tn *TimeoutNode) Tick() core.NodeStatus {
 // Halt handles halting the timeout node
 func (tn *TimeoutNode) Halt() {
 	tn.timeoutStarted = false
-	// Note: In Go, we can't easily cancel the goroutine, but the flag will prevent action
-	children := tn.Children()
-	if len(children) > 0 {
-		children[0].Halt()
-	}
 	tn.DecoratorNode.Halt()
 }
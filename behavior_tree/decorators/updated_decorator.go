@@ -21,8 +21,8 @@ func NewEntryUpdatedDecorator(name string, config core.NodeConfig, ifNotUpdated
 
 	// Extract the entry key (handle blackboard pointer syntax)
 	entryKey := entryPort
-	if len(entryKey) > 0 && entryKey[0] == '{' && entryKey[len(entryKey)-1] == '}' {
-		entryKey = entryKey[1 : len(entryKey)-1]
+	if key, isPointer := core.StripBlackboardPointer(entryPort); isPointer {
+		entryKey = key
 	}
 
 	return &EntryUpdatedDecorator{
@@ -34,6 +34,13 @@ func NewEntryUpdatedDecorator(name string, config core.NodeConfig, ifNotUpdated
 	}
 }
 
+// ProvidedPorts returns the ports provided by EntryUpdatedDecorator
+func (eud *EntryUpdatedDecorator) ProvidedPorts() core.PortsList {
+	return core.PortsList{
+		"entry": core.InputPort("string", "entry whose updates are watched").AsRequired(),
+	}
+}
+
 // Tick executes the updated decorator logic
 func (eud *EntryUpdatedDecorator) Tick() core.NodeStatus {
 	// Continue executing an asynchronous child
@@ -45,7 +52,7 @@ func (eud *EntryUpdatedDecorator) Tick() core.NodeStatus {
 		}
 
 		child := children[0]
-		status := child.Tick()
+		status := child.ExecuteTick(eud.Context())
 		eud.stillExecutingChild = (status == core.NodeStatusRunning)
 		return status
 	}
@@ -79,7 +86,7 @@ func (eud *EntryUpdatedDecorator) Tick() core.NodeStatus {
 	}
 
 	child := children[0]
-	status := child.Tick()
+	status := child.ExecuteTick(eud.Context())
 	eud.stillExecutingChild = (status == core.NodeStatusRunning)
 	return status
 }
@@ -0,0 +1,62 @@
+package loggers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// ConsoleLogger prints every transition on a line, indented by the depth of
+// the node in the tree
+type ConsoleLogger struct {
+	StatusChangeLogger
+	out    io.Writer
+	depths map[core.Node]int
+	start  time.Time
+}
+
+// NewConsoleLogger starts printing the transitions of tree to stdout
+func NewConsoleLogger(tree *bt.BehaviorTree) *ConsoleLogger {
+	return NewWriterLogger(tree, os.Stdout)
+}
+
+// NewWriterLogger is like NewConsoleLogger but prints to out
+func NewWriterLogger(tree *bt.BehaviorTree, out io.Writer) *ConsoleLogger {
+	l := &ConsoleLogger{
+		out:    out,
+		depths: make(map[core.Node]int),
+		start:  tree.Clock().Now(),
+	}
+	computeDepths(tree.RootNode(), 0, l.depths)
+	l.StatusChangeLogger.start(tree, l.log)
+	return l
+}
+
+func computeDepths(node core.Node, depth int, depths map[core.Node]int) {
+	if node == nil {
+		return
+	}
+	depths[node] = depth
+	for _, child := range node.Children() {
+		computeDepths(child, depth+1, depths)
+	}
+}
+
+func (l *ConsoleLogger) log(change core.StatusChange) {
+	elapsed := change.Timestamp.Sub(l.start).Seconds()
+	indent := ""
+	for i := 0; i < l.depths[change.Node]; i++ {
+		indent += "  "
+	}
+	fmt.Fprintf(l.out, "[%.3f]: %s%-20s %s -> %s\n",
+		elapsed, indent, change.Node.Name(), change.Previous, change.Status)
+}
+
+// Close stops printing
+func (l *ConsoleLogger) Close() {
+	l.stop()
+}
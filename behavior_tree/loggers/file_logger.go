@@ -0,0 +1,159 @@
+package loggers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// LogMagic starts every binary log
+const LogMagic = "BTGOLOG2"
+
+// The binary log, similar to BehaviorTree.CPP's FileLogger2, is little
+// endian and made of:
+//
+//	magic        8 bytes, LogMagic
+//	start        uint64, unix time in microseconds
+//	node count   uvarint
+//	nodes        in depth-first order:
+//	               parent   uvarint, index of the parent + 1, 0 for the root
+//	               uid      uint16
+//	               type     uint8, core.NodeType
+//	               name, registration ID, path
+//	                        uvarint length followed by the bytes
+//	transitions  9 bytes each until the end of the file:
+//	               time     6 bytes, microseconds since start
+//	               node     uint16, index of the node
+//	               status   uint8, previous status << 4 | new status
+const transitionSize = 9
+
+// FileLogger writes a compact binary log of the transitions of a tree.
+// Transitions are buffered, Flush or Close write them out.
+type FileLogger struct {
+	StatusChangeLogger
+	writerMutex sync.Mutex
+	writer      *bufio.Writer
+	closer      io.Closer
+	indexes     map[core.Node]uint16
+	start       time.Time
+	err         error
+}
+
+// NewFileLogger creates filename and starts logging the transitions of tree
+func NewFileLogger(tree *bt.BehaviorTree, filename string) (*FileLogger, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewBinaryLogger(tree, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.closer = file
+	return l, nil
+}
+
+// NewBinaryLogger is like NewFileLogger but writes the log to w
+func NewBinaryLogger(tree *bt.BehaviorTree, w io.Writer) (*FileLogger, error) {
+	l := &FileLogger{
+		writer:  bufio.NewWriter(w),
+		indexes: make(map[core.Node]uint16),
+		start:   tree.Clock().Now(),
+	}
+	if err := l.writeHeader(tree); err != nil {
+		return nil, err
+	}
+	l.StatusChangeLogger.start(tree, l.log)
+	return l, nil
+}
+
+func (l *FileLogger) writeHeader(tree *bt.BehaviorTree) error {
+	var nodes []core.Node
+	parents := make(map[core.Node]int)
+	var collect func(node core.Node, parent int)
+	collect = func(node core.Node, parent int) {
+		index := len(nodes)
+		nodes = append(nodes, node)
+		parents[node] = parent
+		l.indexes[node] = uint16(index)
+		for _, child := range node.Children() {
+			collect(child, index+1)
+		}
+	}
+	if root := tree.RootNode(); root != nil {
+		collect(root, 0)
+	}
+
+	var buffer []byte
+	buffer = append(buffer, LogMagic...)
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(l.start.UnixMicro()))
+	buffer = binary.AppendUvarint(buffer, uint64(len(nodes)))
+	for _, node := range nodes {
+		config := node.Config()
+		buffer = binary.AppendUvarint(buffer, uint64(parents[node]))
+		buffer = binary.LittleEndian.AppendUint16(buffer, config.UID)
+		buffer = append(buffer, byte(nodeType(node)))
+		for _, s := range []string{node.Name(), config.Manifest.RegistrationID, config.Path} {
+			buffer = binary.AppendUvarint(buffer, uint64(len(s)))
+			buffer = append(buffer, s...)
+		}
+	}
+	_, err := l.writer.Write(buffer)
+	return err
+}
+
+func (l *FileLogger) log(change core.StatusChange) {
+	index, known := l.indexes[change.Node]
+	if !known {
+		return
+	}
+
+	var record [transitionSize]byte
+	// The timestamps come from the clock of the tree, which may be set back
+	elapsed := change.Timestamp.Sub(l.start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	usec := uint64(elapsed.Microseconds())
+	for i := 0; i < 6; i++ {
+		record[i] = byte(usec >> (8 * i))
+	}
+	binary.LittleEndian.PutUint16(record[6:], index)
+	record[8] = byte(change.Previous)<<4 | byte(change.Status)&0x0f
+
+	l.writerMutex.Lock()
+	defer l.writerMutex.Unlock()
+	if l.err == nil {
+		_, l.err = l.writer.Write(record[:])
+	}
+}
+
+// Flush writes the buffered transitions
+func (l *FileLogger) Flush() error {
+	l.writerMutex.Lock()
+	defer l.writerMutex.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	return l.writer.Flush()
+}
+
+// Close stops logging, flushes and closes the file
+func (l *FileLogger) Close() error {
+	l.stop()
+	err := l.Flush()
+	if l.closer != nil {
+		if closeErr := l.closer.Close(); err == nil {
+			err = closeErr
+		}
+		l.closer = nil
+	}
+	return err
+}
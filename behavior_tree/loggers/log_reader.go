@@ -0,0 +1,164 @@
+package loggers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// LogNode is a node of the tree rebuilt from a binary log
+type LogNode struct {
+	Index          int
+	UID            uint16
+	Type           core.NodeType
+	Name           string
+	RegistrationID string
+	Path           string
+	Parent         *LogNode
+	Children       []*LogNode
+}
+
+// Transition is a status transition read from a binary log
+type Transition struct {
+	// Elapsed is the time since the start of the log
+	Elapsed  time.Duration
+	Node     *LogNode
+	Previous core.NodeStatus
+	Status   core.NodeStatus
+}
+
+// LogReader reads a binary log written by FileLogger. Next steps through the
+// transitions and Status tells the status of every node at that point.
+type LogReader struct {
+	Start time.Time
+	Nodes []*LogNode
+	Root  *LogNode
+
+	reader   *bufio.Reader
+	statuses []core.NodeStatus
+}
+
+// NewLogReader reads the header of a binary log and rebuilds the tree
+func NewLogReader(r io.Reader) (*LogReader, error) {
+	reader := bufio.NewReader(r)
+
+	magic := make([]byte, len(LogMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != LogMagic {
+		return nil, fmt.Errorf("not a behavior tree log")
+	}
+	var start uint64
+	if err := binary.Read(reader, binary.LittleEndian, &start); err != nil {
+		return nil, fmt.Errorf("truncated log header: %v", err)
+	}
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("truncated log header: %v", err)
+	}
+
+	lr := &LogReader{
+		Start:  time.UnixMicro(int64(start)),
+		reader: reader,
+	}
+	for i := 0; i < int(count); i++ {
+		node, err := lr.readNode(i)
+		if err != nil {
+			return nil, fmt.Errorf("truncated log header: %v", err)
+		}
+		lr.Nodes = append(lr.Nodes, node)
+	}
+	if len(lr.Nodes) > 0 {
+		lr.Root = lr.Nodes[0]
+	}
+	lr.statuses = make([]core.NodeStatus, len(lr.Nodes))
+	return lr, nil
+}
+
+func (lr *LogReader) readNode(index int) (*LogNode, error) {
+	parent, err := binary.ReadUvarint(lr.reader)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		UID  uint16
+		Type uint8
+	}
+	if err := binary.Read(lr.reader, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	node := &LogNode{Index: index, UID: header.UID, Type: core.NodeType(header.Type)}
+	for _, field := range []*string{&node.Name, &node.RegistrationID, &node.Path} {
+		length, err := binary.ReadUvarint(lr.reader)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(lr.reader, data); err != nil {
+			return nil, err
+		}
+		*field = string(data)
+	}
+
+	if parent > 0 {
+		if int(parent) > index {
+			return nil, fmt.Errorf("node %d has an invalid parent", index)
+		}
+		node.Parent = lr.Nodes[parent-1]
+		node.Parent.Children = append(node.Parent.Children, node)
+	}
+	return node, nil
+}
+
+// Next reads the next transition and applies it to the node statuses.
+// It returns io.EOF at the end of the log.
+func (lr *LogReader) Next() (Transition, error) {
+	var record [transitionSize]byte
+	if _, err := io.ReadFull(lr.reader, record[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Transition{}, fmt.Errorf("truncated transition")
+		}
+		return Transition{}, err
+	}
+
+	var usec uint64
+	for i := 0; i < 6; i++ {
+		usec |= uint64(record[i]) << (8 * i)
+	}
+	index := int(binary.LittleEndian.Uint16(record[6:]))
+	if index >= len(lr.Nodes) {
+		return Transition{}, fmt.Errorf("transition of unknown node %d", index)
+	}
+
+	transition := Transition{
+		Elapsed:  time.Duration(usec) * time.Microsecond,
+		Node:     lr.Nodes[index],
+		Previous: core.NodeStatus(record[8] >> 4),
+		Status:   core.NodeStatus(record[8] & 0x0f),
+	}
+	lr.statuses[index] = transition.Status
+	return transition, nil
+}
+
+// Status returns the status of node after the transitions read so far
+func (lr *LogReader) Status(node *LogNode) core.NodeStatus {
+	return lr.statuses[node.Index]
+}
+
+// ReadAll reads the remaining transitions
+func (lr *LogReader) ReadAll() ([]Transition, error) {
+	var transitions []Transition
+	for {
+		transition, err := lr.Next()
+		if err == io.EOF {
+			return transitions, nil
+		}
+		if err != nil {
+			return transitions, err
+		}
+		transitions = append(transitions, transition)
+	}
+}
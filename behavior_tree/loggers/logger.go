@@ -0,0 +1,78 @@
+// Package loggers records the status transitions of the nodes of a tree.
+//
+// ConsoleLogger prints them, RotatingFileLogger writes them to text files
+// and FileLogger writes a compact binary log that LogReader replays offline.
+package loggers
+
+import (
+	"sync"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// StatusChangeLogger subscribes to every node of a tree and passes the
+// status transitions to a callback. The loggers of this package embed it.
+type StatusChangeLogger struct {
+	mutex                sync.Mutex
+	enabled              bool
+	showTransitionToIdle bool
+	subscription         *core.Subscription
+}
+
+// start subscribes to the nodes of tree
+func (l *StatusChangeLogger) start(tree *bt.BehaviorTree, callback func(change core.StatusChange)) {
+	l.enabled = true
+	l.showTransitionToIdle = true
+	l.subscription = tree.SubscribeToStatusChange(func(change core.StatusChange) {
+		l.mutex.Lock()
+		enabled := l.enabled
+		showIdle := l.showTransitionToIdle
+		l.mutex.Unlock()
+
+		if !enabled || (!showIdle && change.Status == core.NodeStatusIdle) {
+			return
+		}
+		callback(change)
+	})
+}
+
+// SetEnabled pauses or resumes logging
+func (l *StatusChangeLogger) SetEnabled(enabled bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.enabled = enabled
+}
+
+// Enabled reports whether transitions are logged
+func (l *StatusChangeLogger) Enabled() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.enabled
+}
+
+// SetShowTransitionToIdle sets whether transitions to IDLE are logged,
+// true by default
+func (l *StatusChangeLogger) SetShowTransitionToIdle(show bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.showTransitionToIdle = show
+}
+
+// stop unsubscribes from the tree
+func (l *StatusChangeLogger) stop() {
+	if l.subscription != nil {
+		l.subscription.Cancel()
+	}
+}
+
+// nodeType returns the type of node, from its manifest if the node does not
+// report it
+func nodeType(node core.Node) core.NodeType {
+	if typed, ok := node.(interface{ Type() core.NodeType }); ok {
+		if t := typed.Type(); t != core.NodeTypeUndefined {
+			return t
+		}
+	}
+	return node.Config().Manifest.Type
+}
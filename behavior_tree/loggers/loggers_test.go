@@ -0,0 +1,175 @@
+package loggers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+const testTreeXML = `<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence name="root">
+      <AlwaysSuccess name="first" />
+      <Inverter name="not">
+        <AlwaysFailure name="second" />
+      </Inverter>
+    </Sequence>
+  </BehaviorTree>
+</root>`
+
+func loadTestTree(t *testing.T) *bt.BehaviorTree {
+	tree, err := bt.NewXMLParser(bt.NewBehaviorTreeFactory()).LoadFromText(testTreeXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestConsoleLogger(t *testing.T) {
+	tree := loadTestTree(t)
+	var out bytes.Buffer
+	logger := NewWriterLogger(tree, &out)
+	logger.SetShowTransitionToIdle(false)
+	tree.Tick()
+	logger.Close()
+	tree.Tick()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 transitions, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[0], "]: root") || !strings.Contains(lines[2], "]:     second") {
+		t.Fatalf("unexpected indentation:\n%s", out.String())
+	}
+}
+
+func TestRotatingFileLogger(t *testing.T) {
+	tree := loadTestTree(t)
+	filename := filepath.Join(t.TempDir(), "tree.log")
+	logger, err := NewRotatingFileLogger(tree, filename, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Tick()
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{filename, filename + ".1", filename + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("missing %s: %v", name, err)
+		}
+		if info.Size() > 300 {
+			t.Fatalf("%s not rotated: %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); err == nil {
+		t.Fatalf("too many backups kept")
+	}
+	data, _ := os.ReadFile(filename)
+	if !strings.Contains(string(data), " [1] RUNNING -> SUCCESS\n") {
+		t.Fatalf("unexpected content:\n%s", data)
+	}
+}
+
+func TestFileLoggerReplay(t *testing.T) {
+	tree := loadTestTree(t)
+	filename := filepath.Join(t.TempDir(), "tree.btlog")
+	logger, err := NewFileLogger(tree, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Tick()
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := NewLogReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reader.Nodes) != 4 || reader.Root.Name != "root" || reader.Root.RegistrationID != "Sequence" {
+		t.Fatalf("unexpected tree %+v", reader.Root)
+	}
+	second := reader.Root.Children[1].Children[0]
+	if second.Path != "root/not/second" || second.Type != core.NodeTypeAction || second.UID != 4 {
+		t.Fatalf("unexpected node %+v", second)
+	}
+
+	// Step until the inverter completes and check the replayed state
+	for {
+		transition, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transition.Node.Name == "not" && transition.Status == core.NodeStatusSuccess {
+			break
+		}
+	}
+	if reader.Status(reader.Root) != core.NodeStatusRunning || reader.Status(second) != core.NodeStatusFailure {
+		t.Fatalf("unexpected replayed statuses")
+	}
+
+	rest, err := reader.ReadAll()
+	if err != nil || len(rest) == 0 {
+		t.Fatalf("expected the remaining transitions, got %d, %v", len(rest), err)
+	}
+	// The replayed statuses match the tree
+	index := 0
+	tree.ApplyVisitor(func(node core.Node) {
+		if got := reader.Status(reader.Nodes[index]); got != node.Status() {
+			t.Fatalf("%s: replayed %s, tree %s", node.Name(), got, node.Status())
+		}
+		index++
+	})
+}
+
+func TestLoggers_TreeClock(t *testing.T) {
+	tree := loadTestTree(t)
+	start := time.Unix(1000, 0)
+	clock := core.NewManualClock(start)
+	tree.SetClock(clock)
+
+	var out, binary bytes.Buffer
+	console := NewWriterLogger(tree, &out)
+	file, err := NewBinaryLogger(tree, &binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	tree.Tick()
+	console.Close()
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(out.String(), "[1.500]: root") {
+		t.Fatalf("elapsed time not measured on the tree clock:\n%s", out.String())
+	}
+	reader, err := NewLogReader(&binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reader.Start.Equal(start) {
+		t.Fatalf("expected the log to start at %v, got %v", start, reader.Start)
+	}
+	transition, err := reader.Next()
+	if err != nil || transition.Elapsed != 1500*time.Millisecond {
+		t.Fatalf("expected a transition after 1.5s, got %+v, %v", transition, err)
+	}
+}
@@ -0,0 +1,130 @@
+package loggers
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	bt "github.com/actfuns/gamekit/behavior_tree"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// RotatingFileLogger writes every transition as a line of text. When the file
+// exceeds MaxSize bytes it is renamed filename.1, older files are shifted up
+// to filename.<MaxBackups> and a new file is started.
+type RotatingFileLogger struct {
+	StatusChangeLogger
+	filename   string
+	maxSize    int64
+	maxBackups int
+
+	fileMutex sync.Mutex
+	file      *os.File
+	size      int64
+	err       error
+}
+
+// NewRotatingFileLogger starts writing the transitions of tree to filename.
+// A maxSize of zero disables rotation.
+func NewRotatingFileLogger(tree *bt.BehaviorTree, filename string, maxSize int64, maxBackups int) (*RotatingFileLogger, error) {
+	l := &RotatingFileLogger{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	l.StatusChangeLogger.start(tree, l.log)
+	return l, nil
+}
+
+// open opens the current file in append mode
+func (l *RotatingFileLogger) open() error {
+	file, err := os.OpenFile(l.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups and starts a new file
+func (l *RotatingFileLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.filename, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.filename, i), fmt.Sprintf("%s.%d", l.filename, i+1))
+		}
+		if err := os.Rename(l.filename, l.filename+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.filename); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *RotatingFileLogger) log(change core.StatusChange) {
+	line := fmt.Sprintf("%s %s [%d] %s -> %s\n",
+		change.Timestamp.Format("2006-01-02T15:04:05.000000"),
+		nodeLabel(change.Node), change.Node.Config().UID, change.Previous, change.Status)
+
+	l.fileMutex.Lock()
+	defer l.fileMutex.Unlock()
+	if l.file == nil || l.err != nil {
+		return
+	}
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.err = err
+			return
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		l.err = err
+	}
+}
+
+// nodeLabel returns the path of the node, or its name when it has none
+func nodeLabel(node core.Node) string {
+	if path := node.Config().Path; path != "" {
+		return path
+	}
+	return node.Name()
+}
+
+// Err returns the first error that stopped the logger
+func (l *RotatingFileLogger) Err() error {
+	l.fileMutex.Lock()
+	defer l.fileMutex.Unlock()
+	return l.err
+}
+
+// Close stops logging and closes the file
+func (l *RotatingFileLogger) Close() error {
+	l.stop()
+
+	l.fileMutex.Lock()
+	defer l.fileMutex.Unlock()
+	if l.file == nil {
+		return l.err
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package behavior_tree
+
+import (
+	"sync"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// NodeStatistics counts the status transitions of one node
+type NodeStatistics struct {
+	// LastResult is the last SUCCESS, FAILURE or SKIPPED status
+	LastResult core.NodeStatus
+	// CurrentStatus is the status after the last transition
+	CurrentStatus core.NodeStatus
+	// LastTimestamp is the time of the last transition
+	LastTimestamp time.Time
+
+	TransitionsCount uint
+	SuccessCount     uint
+	FailureCount     uint
+	SkipCount        uint
+}
+
+// TreeObserver collects NodeStatistics for every node of a tree, keyed by
+// NodeConfig.UID and NodeConfig.Path. Trees loaded by XMLParser have unique
+// UIDs and paths.
+type TreeObserver struct {
+	mutex        sync.RWMutex
+	statistics   map[uint16]*NodeStatistics
+	pathToUID    map[string]uint16
+	uidToPath    map[uint16]string
+	subscription *core.Subscription
+}
+
+// NewTreeObserver starts observing tree
+func NewTreeObserver(tree *BehaviorTree) *TreeObserver {
+	observer := &TreeObserver{
+		statistics: make(map[uint16]*NodeStatistics),
+		pathToUID:  make(map[string]uint16),
+		uidToPath:  make(map[uint16]string),
+	}
+
+	tree.ApplyVisitor(func(node core.Node) {
+		config := node.Config()
+		observer.statistics[config.UID] = &NodeStatistics{}
+		observer.pathToUID[config.Path] = config.UID
+		observer.uidToPath[config.UID] = config.Path
+	})
+	observer.subscription = tree.SubscribeToStatusChange(observer.onStatusChange)
+	return observer
+}
+
+func (o *TreeObserver) onStatusChange(change core.StatusChange) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	stats, exists := o.statistics[change.Node.Config().UID]
+	if !exists {
+		return
+	}
+	stats.TransitionsCount++
+	stats.CurrentStatus = change.Status
+	stats.LastTimestamp = change.Timestamp
+
+	switch change.Status {
+	case core.NodeStatusSuccess:
+		stats.SuccessCount++
+		stats.LastResult = change.Status
+	case core.NodeStatusFailure:
+		stats.FailureCount++
+		stats.LastResult = change.Status
+	case core.NodeStatusSkipped:
+		stats.SkipCount++
+		stats.LastResult = change.Status
+	}
+}
+
+// Statistics returns the statistics of the node with the given UID
+func (o *TreeObserver) Statistics(uid uint16) (NodeStatistics, bool) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	stats, exists := o.statistics[uid]
+	if !exists {
+		return NodeStatistics{}, false
+	}
+	return *stats, true
+}
+
+// StatisticsByPath returns the statistics of the node with the given path
+func (o *TreeObserver) StatisticsByPath(path string) (NodeStatistics, bool) {
+	o.mutex.RLock()
+	uid, exists := o.pathToUID[path]
+	o.mutex.RUnlock()
+	if !exists {
+		return NodeStatistics{}, false
+	}
+	return o.Statistics(uid)
+}
+
+// PathToUID returns a copy of the mapping from node paths to UIDs
+func (o *TreeObserver) PathToUID() map[string]uint16 {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	paths := make(map[string]uint16, len(o.pathToUID))
+	for path, uid := range o.pathToUID {
+		paths[path] = uid
+	}
+	return paths
+}
+
+// UIDToPath returns a copy of the mapping from node UIDs to paths
+func (o *TreeObserver) UIDToPath() map[uint16]string {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	uids := make(map[uint16]string, len(o.uidToPath))
+	for uid, path := range o.uidToPath {
+		uids[uid] = path
+	}
+	return uids
+}
+
+// Reset clears the statistics of every node
+func (o *TreeObserver) Reset() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for uid := range o.statistics {
+		o.statistics[uid] = &NodeStatistics{}
+	}
+}
+
+// Close stops observing the tree
+func (o *TreeObserver) Close() {
+	o.subscription.Cancel()
+}
@@ -0,0 +1,59 @@
+package behavior_tree
+
+import (
+	"testing"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+func TestTreeObserver(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	tree, err := parser.LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Boss">
+    <Fallback name="root">
+      <AlwaysFailure name="melee" />
+      <AlwaysSuccess name="ranged" />
+      <AlwaysSuccess name="flee" />
+    </Fallback>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []core.StatusChange
+	subscription := tree.SubscribeToStatusChange(func(change core.StatusChange) {
+		changes = append(changes, change)
+	})
+	observer := NewTreeObserver(tree)
+	defer observer.Close()
+
+	for i := 0; i < 3; i++ {
+		tree.Tick()
+	}
+	subscription.Cancel()
+
+	// The fallback starts RUNNING, then ticks its first child
+	if len(changes) < 2 || changes[0].Node.Name() != "root" || changes[1].Node.Name() != "melee" ||
+		changes[1].Previous != core.NodeStatusIdle || changes[1].Status != core.NodeStatusFailure {
+		t.Fatalf("unexpected first transitions %+v", changes)
+	}
+
+	melee, _ := observer.StatisticsByPath("root/melee")
+	if melee.FailureCount != 3 || melee.LastResult != core.NodeStatusFailure {
+		t.Fatalf("unexpected melee statistics %+v", melee)
+	}
+	ranged, _ := observer.StatisticsByPath("root/ranged")
+	if ranged.SuccessCount != 3 || ranged.TransitionsCount != 6 {
+		t.Fatalf("unexpected ranged statistics %+v", ranged)
+	}
+	flee, ok := observer.Statistics(observer.PathToUID()["root/flee"])
+	if !ok || flee.TransitionsCount != 0 {
+		t.Fatalf("flee must never run, got %+v", flee)
+	}
+
+	observer.Reset()
+	if stats, _ := observer.StatisticsByPath("root"); stats.TransitionsCount != 0 {
+		t.Fatalf("statistics not reset")
+	}
+}
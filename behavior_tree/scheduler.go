@@ -0,0 +1,469 @@
+package behavior_tree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// SchedulerConfig configures a Scheduler
+type SchedulerConfig struct {
+	// Workers is the number of goroutines ticking trees during a frame,
+	// runtime.GOMAXPROCS(0) when 0
+	Workers int
+	// FrameBudget is the time a frame may spend ticking trees. The trees
+	// that were not ticked when it is spent are ticked first on the next
+	// frame. 0 means no limit.
+	FrameBudget time.Duration
+	// SlowestTrees is the number of trees reported in
+	// SchedulerMetrics.SlowestTrees, 10 when 0
+	SlowestTrees int
+	// Clock measures the budget and the tick durations, SystemClock when nil
+	Clock core.Clock
+}
+
+// Scheduler ticks many trees each server frame. Every tree has a tick
+// interval, its level of detail: 1 ticks it every frame, e.g. for NPCs in
+// combat, 10 every ten frames, e.g. for distant idle NPCs. Trees sharing an
+// interval are spread over the frames. Trees can be added, removed and
+// given another interval at any time, also by the nodes of a tree being
+// ticked.
+type Scheduler struct {
+	config SchedulerConfig
+	// running serializes the frames
+	running sync.Mutex
+	mutex   sync.Mutex
+	trees   map[*BehaviorTree]*scheduledTree
+	// order is the order of addition, for a deterministic schedule
+	order []*scheduledTree
+	// pending are the trees due in a previous frame, not ticked yet
+	pending []*scheduledTree
+	frame   uint64
+	added   uint64
+	// queue is reused between frames
+	queue []*scheduledTree
+
+	metrics     SchedulerMetrics
+	windowStart time.Time
+	windowTicks uint64
+}
+
+// scheduledTree is a tree with its schedule and statistics
+type scheduledTree struct {
+	tree      *BehaviorTree
+	interval  uint64
+	nextFrame uint64
+	pending   bool
+	// removed is read by the workers, which skip the removed trees
+	removed atomic.Bool
+	// ticking is held by the worker ticking the tree
+	ticking sync.Mutex
+
+	// Written by the worker ticking the tree, read after the frame
+	tickStatus core.NodeStatus
+	tickErr    error
+	duration   time.Duration
+	ticked     bool
+
+	ticks    uint64
+	status   core.NodeStatus
+	err      error
+	lastTick time.Duration
+	maxTick  time.Duration
+}
+
+// FrameStats describes one frame
+type FrameStats struct {
+	Frame uint64
+	// Ticked is the number of trees ticked
+	Ticked int
+	// CarriedOver is the number of due trees left for the next frame
+	CarriedOver int
+	Duration    time.Duration
+	// Overrun tells if the frame spent more than its budget
+	Overrun bool
+}
+
+// TreeStats are the tick statistics of a scheduled tree
+type TreeStats struct {
+	Tree     *BehaviorTree
+	Interval int
+	Ticks    uint64
+	// Status is the status returned by the last tick
+	Status core.NodeStatus
+	// Err is the error of the last tick: the error of the context that
+	// halted the tree, or the panic of a node, which fails the tree
+	Err      error
+	LastTick time.Duration
+	MaxTick  time.Duration
+}
+
+// SchedulerMetrics are the statistics of a Scheduler since it was created
+// or since ResetMetrics
+type SchedulerMetrics struct {
+	Frames uint64
+	Ticks  uint64
+	// TicksPerSecond is measured over the last complete second
+	TicksPerSecond float64
+	// Overruns is the number of frames that spent more than their budget
+	Overruns uint64
+	// CarriedOver is the number of times a due tree was left for the next frame
+	CarriedOver uint64
+	LastFrame   FrameStats
+	// SlowestTrees are the trees with the longest tick, slowest first
+	SlowestTrees []TreeStats
+}
+
+// NewScheduler creates a new scheduler
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	if config.Workers <= 0 {
+		config.Workers = runtime.GOMAXPROCS(0)
+	}
+	if config.SlowestTrees <= 0 {
+		config.SlowestTrees = 10
+	}
+	if config.Clock == nil {
+		config.Clock = core.SystemClock
+	}
+	return &Scheduler{
+		config: config,
+		trees:  make(map[*BehaviorTree]*scheduledTree),
+	}
+}
+
+// Add schedules tree to be ticked every interval frames
+func (s *Scheduler) Add(tree *BehaviorTree, interval int) error {
+	if interval < 1 {
+		return fmt.Errorf("invalid tick interval %d", interval)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.trees[tree]; exists {
+		return fmt.Errorf("tree already scheduled")
+	}
+	st := &scheduledTree{
+		tree:     tree,
+		interval: uint64(interval),
+		// Spread the trees of an interval over its frames
+		nextFrame: s.frame + 1 + s.added%uint64(interval),
+	}
+	s.added++
+	s.trees[tree] = st
+	s.order = append(s.order, st)
+	return nil
+}
+
+// Remove stops ticking tree, also when it is due in the current frame and
+// not ticked yet. It does not halt it, nor wait for the end of a tick in
+// progress, so that the nodes of a tree can remove it; see RemoveAndWait.
+func (s *Scheduler) Remove(tree *BehaviorTree) {
+	s.remove(tree)
+}
+
+// RemoveAndWait stops ticking tree like Remove, and waits for the end of
+// its tick in progress, if any. Once it returns the tree can be halted,
+// or released to its TreeTemplate. It must not be called by the nodes of
+// tree, which would wait for their own tick.
+func (s *Scheduler) RemoveAndWait(tree *BehaviorTree) {
+	if st := s.remove(tree); st != nil {
+		st.ticking.Lock()
+		st.ticking.Unlock()
+	}
+}
+
+// remove unschedules tree and returns it, nil if it was not scheduled
+func (s *Scheduler) remove(tree *BehaviorTree) *scheduledTree {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, exists := s.trees[tree]
+	if !exists {
+		return nil
+	}
+	st.removed.Store(true)
+	delete(s.trees, tree)
+	for i, other := range s.order {
+		if other == st {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return st
+}
+
+// SetTickInterval changes the number of frames between two ticks of tree.
+// A shorter interval takes effect from the next frame.
+func (s *Scheduler) SetTickInterval(tree *BehaviorTree, interval int) error {
+	if interval < 1 {
+		return fmt.Errorf("invalid tick interval %d", interval)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, exists := s.trees[tree]
+	if !exists {
+		return fmt.Errorf("tree not scheduled")
+	}
+	st.interval = uint64(interval)
+	if next := s.frame + st.interval; next < st.nextFrame {
+		st.nextFrame = next
+	}
+	return nil
+}
+
+// Len returns the number of scheduled trees
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.order)
+}
+
+// Frame runs one frame: the trees carried over from the previous frame,
+// then the trees due in this frame, are ticked with TickCtx by the workers
+// until the frame budget is spent. A tree whose tick panics is reported as
+// failed in its TreeStats, the other trees are ticked as usual.
+func (s *Scheduler) Frame(ctx context.Context) FrameStats {
+	s.running.Lock()
+	defer s.running.Unlock()
+	clock := s.config.Clock
+	start := clock.Now()
+
+	s.mutex.Lock()
+	s.frame++
+	frame := s.frame
+	queue := s.queue[:0]
+	for _, st := range s.pending {
+		if !st.removed.Load() {
+			queue = append(queue, st)
+		}
+	}
+	for _, st := range s.order {
+		if !st.pending && st.nextFrame <= frame {
+			st.pending = true
+			queue = append(queue, st)
+		}
+	}
+	s.queue = queue
+	s.mutex.Unlock()
+
+	var deadline time.Time
+	if s.config.FrameBudget > 0 {
+		deadline = start.Add(s.config.FrameBudget)
+	}
+	var next int64
+	work := func() {
+		for {
+			if !deadline.IsZero() && !clock.Now().Before(deadline) {
+				return
+			}
+			i := int(atomic.AddInt64(&next, 1) - 1)
+			if i >= len(queue) {
+				return
+			}
+			st := queue[i]
+			st.ticking.Lock()
+			if !st.removed.Load() {
+				tickStart := clock.Now()
+				st.tickStatus, st.tickErr = tickTree(ctx, st.tree)
+				st.duration = clock.Now().Sub(tickStart)
+				st.ticked = true
+			}
+			st.ticking.Unlock()
+		}
+	}
+
+	workers := s.config.Workers
+	if workers > len(queue) {
+		workers = len(queue)
+	}
+	var wg sync.WaitGroup
+	for w := 1; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	work()
+	wg.Wait()
+
+	end := clock.Now()
+	stats := FrameStats{Frame: frame, Duration: end.Sub(start)}
+	stats.Overrun = s.config.FrameBudget > 0 && stats.Duration > s.config.FrameBudget
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending = s.pending[:0]
+	for _, st := range queue {
+		if !st.ticked {
+			if !st.removed.Load() {
+				s.pending = append(s.pending, st)
+				stats.CarriedOver++
+			}
+			continue
+		}
+		st.ticked = false
+		st.pending = false
+		st.nextFrame = frame + st.interval
+		st.ticks++
+		st.status = st.tickStatus
+		st.err = st.tickErr
+		st.lastTick = st.duration
+		if st.duration > st.maxTick {
+			st.maxTick = st.duration
+		}
+		stats.Ticked++
+	}
+	s.updateMetrics(stats, end)
+	return stats
+}
+
+// tickTree ticks tree with ctx, turning a panic of a node into a failure
+func tickTree(ctx context.Context, tree *BehaviorTree) (status core.NodeStatus, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			status = core.NodeStatusFailure
+			err = fmt.Errorf("panic ticking tree %s: %v", tree.ID(), r)
+		}
+	}()
+	return tree.TickCtx(ctx)
+}
+
+// updateMetrics records a frame. The caller must hold the mutex.
+func (s *Scheduler) updateMetrics(stats FrameStats, now time.Time) {
+	m := &s.metrics
+	m.Frames++
+	m.Ticks += uint64(stats.Ticked)
+	m.CarriedOver += uint64(stats.CarriedOver)
+	if stats.Overrun {
+		m.Overruns++
+	}
+	m.LastFrame = stats
+
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	s.windowTicks += uint64(stats.Ticked)
+	if elapsed := now.Sub(s.windowStart); elapsed >= time.Second {
+		m.TicksPerSecond = float64(s.windowTicks) / elapsed.Seconds()
+		s.windowStart = now
+		s.windowTicks = 0
+	}
+}
+
+// Run runs a frame every period on the clock of the scheduler until ctx is
+// cancelled. A frame longer than period is followed by the next one
+// immediately. When ctx is done every scheduled tree is halted, and Run
+// returns ctx's error joined with the errors of the nodes that failed to
+// clean up.
+func (s *Scheduler) Run(ctx context.Context, period time.Duration) error {
+	clock := s.config.Clock
+	for {
+		start := clock.Now()
+		s.Frame(ctx)
+		if err := ctx.Err(); err != nil {
+			return s.halt(err)
+		}
+		wait := period - clock.Now().Sub(start)
+		if wait <= 0 {
+			continue
+		}
+		timer, stop := core.StartTimer(clock, wait)
+		select {
+		case <-ctx.Done():
+			stop()
+			return s.halt(ctx.Err())
+		case <-timer:
+		}
+	}
+}
+
+// halt halts the scheduled trees after Run ended with err, and returns err
+// with their cleanup errors
+func (s *Scheduler) halt(err error) error {
+	s.running.Lock()
+	defer s.running.Unlock()
+	s.mutex.Lock()
+	trees := make([]*BehaviorTree, len(s.order))
+	for i, st := range s.order {
+		trees[i] = st.tree
+	}
+	s.mutex.Unlock()
+
+	errs := []error{err}
+	for _, tree := range trees {
+		if haltErr := tree.Halt(); haltErr != nil {
+			errs = append(errs, fmt.Errorf("tree %s: %w", tree.ID(), haltErr))
+		}
+	}
+	if len(errs) == 1 {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// TreeStats returns the statistics of a scheduled tree
+func (s *Scheduler) TreeStats(tree *BehaviorTree) (TreeStats, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st, exists := s.trees[tree]
+	if !exists {
+		return TreeStats{}, false
+	}
+	return st.stats(), true
+}
+
+func (st *scheduledTree) stats() TreeStats {
+	return TreeStats{
+		Tree:     st.tree,
+		Interval: int(st.interval),
+		Ticks:    st.ticks,
+		Status:   st.status,
+		Err:      st.err,
+		LastTick: st.lastTick,
+		MaxTick:  st.maxTick,
+	}
+}
+
+// Metrics returns the statistics of the scheduler
+func (s *Scheduler) Metrics() SchedulerMetrics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m := s.metrics
+	slowest := make([]TreeStats, 0, len(s.order))
+	for _, st := range s.order {
+		if st.ticks > 0 {
+			slowest = append(slowest, st.stats())
+		}
+	}
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].MaxTick > slowest[j].MaxTick
+	})
+	if len(slowest) > s.config.SlowestTrees {
+		slowest = slowest[:s.config.SlowestTrees]
+	}
+	m.SlowestTrees = slowest
+	return m
+}
+
+// ResetMetrics clears the metrics and the statistics of the trees
+func (s *Scheduler) ResetMetrics() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.metrics = SchedulerMetrics{}
+	s.windowStart = time.Time{}
+	s.windowTicks = 0
+	for _, st := range s.order {
+		st.ticks = 0
+		st.lastTick = 0
+		st.maxTick = 0
+	}
+}
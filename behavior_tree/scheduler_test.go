@@ -0,0 +1,302 @@
+package behavior_tree
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// newCountingTree creates a tree whose single action calls tick
+func newCountingTree(tick func() core.NodeStatus) *BehaviorTree {
+	action := core.NewActionNode("Count", core.NodeConfig{}, tick)
+	return NewBehaviorTree(&action, core.NewBlackboard())
+}
+
+func TestScheduler_TickIntervals(t *testing.T) {
+	scheduler := NewScheduler(SchedulerConfig{Workers: 4})
+
+	var combat, idle int64
+	combatTrees := make([]*BehaviorTree, 4)
+	for i := range combatTrees {
+		combatTrees[i] = newCountingTree(func() core.NodeStatus {
+			atomic.AddInt64(&combat, 1)
+			return core.NodeStatusRunning
+		})
+		if err := scheduler.Add(combatTrees[i], 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idleTrees := make([]*BehaviorTree, 10)
+	for i := range idleTrees {
+		var tree *BehaviorTree
+		tree = newCountingTree(func() core.NodeStatus {
+			atomic.AddInt64(&idle, 1)
+			// An idle NPC entering combat is ticked every frame
+			if atomic.LoadInt64(&idle) == 20 {
+				if err := scheduler.SetTickInterval(tree, 1); err != nil {
+					t.Error(err)
+				}
+			}
+			return core.NodeStatusSuccess
+		})
+		idleTrees[i] = tree
+		if err := scheduler.Add(tree, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := scheduler.Add(idleTrees[0], 1); err == nil {
+		t.Fatalf("expected an error adding a tree twice")
+	}
+
+	// The idle trees are spread over the frames of their interval
+	for frame := 1; frame <= 10; frame++ {
+		if stats := scheduler.Frame(context.Background()); stats.Ticked != 6 || stats.CarriedOver != 0 {
+			t.Fatalf("frame %d: expected 6 ticks, got %+v", frame, stats)
+		}
+	}
+	if combat != 40 || idle != 20 {
+		t.Fatalf("expected 40 combat and 20 idle ticks, got %d and %d", combat, idle)
+	}
+	if stats := scheduler.Frame(context.Background()); stats.Ticked != 7 {
+		t.Fatalf("expected the tree that entered combat to be ticked, got %+v", stats)
+	}
+
+	scheduler.Remove(combatTrees[0])
+	if stats := scheduler.Frame(context.Background()); stats.Ticked != 6 || scheduler.Len() != 13 {
+		t.Fatalf("expected 6 ticks after Remove, got %+v", stats)
+	}
+	stats, ok := scheduler.TreeStats(combatTrees[1])
+	if !ok || stats.Ticks != 12 || stats.Interval != 1 || stats.Status != core.NodeStatusRunning {
+		t.Fatalf("unexpected tree stats %+v", stats)
+	}
+}
+
+func TestScheduler_FrameBudget(t *testing.T) {
+	clock := core.NewManualClock(time.Unix(0, 0))
+	scheduler := NewScheduler(SchedulerConfig{Workers: 1, FrameBudget: 10 * time.Millisecond, SlowestTrees: 2, Clock: clock})
+
+	ticks := make([]int, 6)
+	trees := make([]*BehaviorTree, len(ticks))
+	for i := range trees {
+		i := i
+		trees[i] = newCountingTree(func() core.NodeStatus {
+			ticks[i]++
+			clock.Advance(time.Duration(3+i) * time.Millisecond)
+			return core.NodeStatusSuccess
+		})
+		if err := scheduler.Add(trees[i], 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 3+4+5 ms spend the budget of the first frame
+	stats := scheduler.Frame(context.Background())
+	if stats.Ticked != 3 || stats.CarriedOver != 3 || !stats.Overrun || stats.Duration != 12*time.Millisecond {
+		t.Fatalf("unexpected first frame %+v", stats)
+	}
+	// The trees carried over are ticked first
+	stats = scheduler.Frame(context.Background())
+	if stats.Ticked != 2 || stats.CarriedOver != 4 || ticks[3] != 1 || ticks[4] != 1 || ticks[5] != 0 {
+		t.Fatalf("unexpected second frame %+v, ticks %v", stats, ticks)
+	}
+
+	metrics := scheduler.Metrics()
+	if metrics.Frames != 2 || metrics.Ticks != 5 || metrics.Overruns != 2 || metrics.CarriedOver != 7 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	if len(metrics.SlowestTrees) != 2 || metrics.SlowestTrees[0].Tree != trees[4] || metrics.SlowestTrees[0].MaxTick != 7*time.Millisecond {
+		t.Fatalf("unexpected slowest trees %+v", metrics.SlowestTrees)
+	}
+
+	scheduler.ResetMetrics()
+	if metrics := scheduler.Metrics(); metrics.Frames != 0 || len(metrics.SlowestTrees) != 0 {
+		t.Fatalf("metrics not reset %+v", metrics)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	clock := core.NewSimulatedClock(time.Unix(0, 0))
+	scheduler := NewScheduler(SchedulerConfig{Workers: 2, Clock: clock})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ticks int64
+	for i := 0; i < 8; i++ {
+		tree := newCountingTree(func() core.NodeStatus {
+			if atomic.AddInt64(&ticks, 1) == 8*100 {
+				cancel()
+			}
+			return core.NodeStatusSuccess
+		})
+		if err := scheduler.Add(tree, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := scheduler.Run(ctx, 50*time.Millisecond); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	metrics := scheduler.Metrics()
+	if metrics.Frames != 100 || metrics.Ticks != 800 {
+		t.Fatalf("expected 100 frames, got %+v", metrics)
+	}
+	// 20 frames per second of the simulated clock
+	if metrics.TicksPerSecond != 160 {
+		t.Fatalf("expected 160 ticks per second, got %v", metrics.TicksPerSecond)
+	}
+}
+
+// newRunningTree creates a tree whose single action stays RUNNING until it
+// is halted, cleaning up with cleanupErr
+func newRunningTree(halted *int64, cleanupErr error) *BehaviorTree {
+	action := core.NewStatefulActionNodeWithContext("Walk", core.NodeConfig{},
+		func(context.Context) core.NodeStatus { return core.NodeStatusRunning },
+		func(context.Context) core.NodeStatus { return core.NodeStatusRunning },
+		func(context.Context) error {
+			atomic.AddInt64(halted, 1)
+			return cleanupErr
+		})
+	return NewBehaviorTree(&action, core.NewBlackboard())
+}
+
+func TestScheduler_RunHalts(t *testing.T) {
+	clock := core.NewSimulatedClock(time.Unix(0, 0))
+	scheduler := NewScheduler(SchedulerConfig{Workers: 2, Clock: clock})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var halted int64
+	trees := make([]*BehaviorTree, 6)
+	for i := range trees {
+		trees[i] = newRunningTree(&halted, nil)
+		if err := scheduler.Add(trees[i], 1+i%3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stuck := errors.New("path not released")
+	trees = append(trees, newRunningTree(&halted, stuck))
+	if err := scheduler.Add(trees[6], 1); err != nil {
+		t.Fatal(err)
+	}
+	var frames int64
+	if err := scheduler.Add(newCountingTree(func() core.NodeStatus {
+		if atomic.AddInt64(&frames, 1) == 10 {
+			cancel()
+		}
+		return core.NodeStatusSuccess
+	}), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every tree is halted, including those not ticked in the last frame
+	err := scheduler.Run(ctx, 50*time.Millisecond)
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, stuck) {
+		t.Fatalf("expected context.Canceled with the cleanup error, got %v", err)
+	}
+	if halted != 7 {
+		t.Fatalf("expected 7 trees halted, got %d", halted)
+	}
+	for i, tree := range trees {
+		if status := tree.RootNode().Status(); status != core.NodeStatusIdle {
+			t.Fatalf("tree %d left %v", i, status)
+		}
+	}
+}
+
+func TestScheduler_PanicIsolation(t *testing.T) {
+	scheduler := NewScheduler(SchedulerConfig{Workers: 2})
+	faulty := newCountingTree(func() core.NodeStatus {
+		panic("target despawned")
+	})
+	if err := scheduler.Add(faulty, 1); err != nil {
+		t.Fatal(err)
+	}
+	var ticks int64
+	for i := 0; i < 4; i++ {
+		if err := scheduler.Add(newCountingTree(func() core.NodeStatus {
+			atomic.AddInt64(&ticks, 1)
+			return core.NodeStatusSuccess
+		}), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for frame := 0; frame < 3; frame++ {
+		if stats := scheduler.Frame(context.Background()); stats.Ticked != 5 {
+			t.Fatalf("expected 5 ticks, got %+v", stats)
+		}
+	}
+	if ticks != 12 {
+		t.Fatalf("expected the other trees to be ticked, got %d ticks", ticks)
+	}
+	stats, _ := scheduler.TreeStats(faulty)
+	if stats.Status != core.NodeStatusFailure || stats.Ticks != 3 ||
+		stats.Err == nil || !strings.Contains(stats.Err.Error(), "target despawned") {
+		t.Fatalf("expected the tree to be reported as failed, got %+v", stats)
+	}
+}
+
+func TestScheduler_RemoveDuringFrame(t *testing.T) {
+	scheduler := NewScheduler(SchedulerConfig{Workers: 1})
+
+	// A tree removed by the tick of another is skipped in the same frame
+	var despawned int64
+	despawnedTree := newCountingTree(func() core.NodeStatus {
+		atomic.AddInt64(&despawned, 1)
+		return core.NodeStatusSuccess
+	})
+	killer := newCountingTree(func() core.NodeStatus {
+		scheduler.Remove(despawnedTree)
+		return core.NodeStatusSuccess
+	})
+	for _, tree := range []*BehaviorTree{killer, despawnedTree} {
+		if err := scheduler.Add(tree, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := scheduler.Frame(context.Background()); stats.Ticked != 1 || stats.CarriedOver != 0 || despawned != 0 {
+		t.Fatalf("expected the removed tree to be skipped, got %+v and %d ticks", stats, despawned)
+	}
+	scheduler.Remove(killer)
+
+	// RemoveAndWait returns once the tick in progress ends
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := newCountingTree(func() core.NodeStatus {
+		close(started)
+		<-release
+		return core.NodeStatusRunning
+	})
+	if err := scheduler.Add(slow, 1); err != nil {
+		t.Fatal(err)
+	}
+	frameDone := make(chan struct{})
+	go func() {
+		scheduler.Frame(context.Background())
+		close(frameDone)
+	}()
+	<-started
+	removed := make(chan struct{})
+	go func() {
+		scheduler.RemoveAndWait(slow)
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Fatalf("RemoveAndWait returned during the tick")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-removed
+	if err := slow.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	<-frameDone
+	if scheduler.Len() != 0 {
+		t.Fatalf("expected no tree left, got %d", scheduler.Len())
+	}
+}
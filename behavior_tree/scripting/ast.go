@@ -0,0 +1,566 @@
+package scripting
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// expr is a node of the parsed expression tree
+type expr interface {
+	eval(ctx evalContext) (value, error)
+}
+
+// evalContext carries the environment of a single script execution. It is
+// passed by value so that executing a script does not allocate it.
+type evalContext struct {
+	env   Environment
+	enums map[string]int
+}
+
+// valueKind enumerates the script value domain
+type valueKind uint8
+
+const (
+	nilKind valueKind = iota
+	boolKind
+	intKind
+	floatKind
+	stringKind
+	otherKind
+)
+
+// value is a script value. Booleans and numbers are not boxed in an
+// interface{}, so evaluating expressions does not allocate.
+type value struct {
+	kind valueKind
+	// i is the value of integers, 1 for true
+	i     int64
+	f     float64
+	s     string
+	other interface{}
+}
+
+func boolValue(b bool) value {
+	if b {
+		return value{kind: boolKind, i: 1}
+	}
+	return value{kind: boolKind}
+}
+
+func intValue(i int64) value {
+	return value{kind: intKind, i: i}
+}
+
+func floatValue(f float64) value {
+	return value{kind: floatKind, f: f}
+}
+
+func stringValue(s string) value {
+	return value{kind: stringKind, s: s}
+}
+
+type literalExpr struct {
+	value value
+}
+
+func (e *literalExpr) eval(ctx evalContext) (value, error) {
+	return e.value, nil
+}
+
+type identExpr struct {
+	name string
+}
+
+func (e *identExpr) eval(ctx evalContext) (value, error) {
+	if enum, ok := ctx.enums[e.name]; ok {
+		return intValue(int64(enum)), nil
+	}
+	if ctx.env == nil {
+		return value{}, fmt.Errorf("variable '%s' not found: no blackboard", e.name)
+	}
+	if scalars, ok := ctx.env.(ScalarEnvironment); ok {
+		if s, found := scalars.GetScalar(e.name); found {
+			return scalarValue(s), nil
+		}
+	}
+	v, ok := ctx.env.Get(e.name)
+	if !ok {
+		return value{}, fmt.Errorf("variable '%s' not found", e.name)
+	}
+	return normalize(v), nil
+}
+
+type unaryExpr struct {
+	op      string
+	operand expr
+}
+
+func (e *unaryExpr) eval(ctx evalContext) (value, error) {
+	v, err := e.operand.eval(ctx)
+	if err != nil {
+		return value{}, err
+	}
+	switch e.op {
+	case "!":
+		b, err := v.toBool()
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(!b), nil
+	case "-":
+		switch v.kind {
+		case intKind:
+			return intValue(-v.i), nil
+		case floatKind:
+			return floatValue(-v.f), nil
+		}
+		return value{}, fmt.Errorf("operator '-' not applicable to %s", v.describe())
+	}
+	return value{}, fmt.Errorf("unknown unary operator '%s'", e.op)
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(ctx evalContext) (value, error) {
+	left, err := e.left.eval(ctx)
+	if err != nil {
+		return value{}, err
+	}
+
+	// Logical operators short-circuit
+	if e.op == "&&" || e.op == "||" {
+		lb, err := left.toBool()
+		if err != nil {
+			return value{}, err
+		}
+		if (e.op == "&&" && !lb) || (e.op == "||" && lb) {
+			return boolValue(lb), nil
+		}
+		right, err := e.right.eval(ctx)
+		if err != nil {
+			return value{}, err
+		}
+		rb, err := right.toBool()
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(rb), nil
+	}
+
+	right, err := e.right.eval(ctx)
+	if err != nil {
+		return value{}, err
+	}
+	return applyBinary(e.op, left, right)
+}
+
+type ternaryExpr struct {
+	cond, then, otherwise expr
+}
+
+func (e *ternaryExpr) eval(ctx evalContext) (value, error) {
+	cond, err := e.cond.eval(ctx)
+	if err != nil {
+		return value{}, err
+	}
+	b, err := cond.toBool()
+	if err != nil {
+		return value{}, err
+	}
+	if b {
+		return e.then.eval(ctx)
+	}
+	return e.otherwise.eval(ctx)
+}
+
+type assignExpr struct {
+	op    string
+	name  string
+	value expr
+}
+
+func (e *assignExpr) eval(ctx evalContext) (value, error) {
+	if ctx.env == nil {
+		return value{}, fmt.Errorf("can't assign '%s': no blackboard", e.name)
+	}
+	if _, isEnum := ctx.enums[e.name]; isEnum {
+		return value{}, fmt.Errorf("can't assign to enum constant '%s'", e.name)
+	}
+
+	v, err := e.value.eval(ctx)
+	if err != nil {
+		return value{}, err
+	}
+
+	scalars, _ := ctx.env.(ScalarEnvironment)
+	if scalars != nil {
+		if current, found := scalars.GetScalar(e.name); found {
+			return e.assignScalar(scalars, current, v)
+		}
+	}
+
+	current, exists := ctx.env.Get(e.name)
+	if !exists && e.op != ":=" {
+		if e.op == "=" {
+			return value{}, fmt.Errorf("variable '%s' does not exist, use ':=' to create it", e.name)
+		}
+		return value{}, fmt.Errorf("variable '%s' not found", e.name)
+	}
+
+	if e.isCompound() {
+		if v, err = applyBinary(e.op[:1], normalize(current), v); err != nil {
+			return value{}, err
+		}
+	}
+
+	if exists && current != nil {
+		stored, err := convertTo(v, reflect.TypeOf(current))
+		if err != nil {
+			return value{}, fmt.Errorf("can't assign to '%s': %v", e.name, err)
+		}
+		if err := ctx.env.Set(e.name, stored); err != nil {
+			return value{}, err
+		}
+		return v, nil
+	}
+
+	// New variables store integers as int
+	if s, ok := v.scalar(reflect.Int); ok && scalars != nil {
+		err = scalars.SetScalar(e.name, s)
+	} else {
+		err = ctx.env.Set(e.name, v.toInterface())
+	}
+	if err != nil {
+		return value{}, err
+	}
+	return v, nil
+}
+
+// isCompound tells if the operator is one of +=, -=, *= and /=
+func (e *assignExpr) isCompound() bool {
+	return len(e.op) == 2 && e.op != ":="
+}
+
+// assignScalar assigns a variable holding a scalar, keeping its type
+func (e *assignExpr) assignScalar(env ScalarEnvironment, current Scalar, v value) (value, error) {
+	if e.isCompound() {
+		var err error
+		if v, err = applyBinary(e.op[:1], scalarValue(current), v); err != nil {
+			return value{}, err
+		}
+	}
+	s, err := v.toScalar(current.Kind)
+	if err != nil {
+		return value{}, fmt.Errorf("can't assign to '%s': %v", e.name, err)
+	}
+	if err := env.SetScalar(e.name, s); err != nil {
+		return value{}, err
+	}
+	return v, nil
+}
+
+// applyBinary evaluates an arithmetic, comparison or concatenation operator
+func applyBinary(op string, left, right value) (value, error) {
+	switch op {
+	case "..":
+		return stringValue(left.string() + right.string()), nil
+	case "==":
+		return boolValue(equals(left, right)), nil
+	case "!=":
+		return boolValue(!equals(left, right)), nil
+	}
+
+	lIsStr := left.kind == stringKind
+	rIsStr := right.kind == stringKind
+	if lIsStr && rIsStr {
+		ls, rs := left.s, right.s
+		switch op {
+		case "+":
+			return stringValue(ls + rs), nil
+		case "<":
+			return boolValue(ls < rs), nil
+		case "<=":
+			return boolValue(ls <= rs), nil
+		case ">":
+			return boolValue(ls > rs), nil
+		case ">=":
+			return boolValue(ls >= rs), nil
+		}
+		return value{}, fmt.Errorf("operator '%s' not applicable to strings", op)
+	}
+	if op == "+" && (lIsStr || rIsStr) {
+		return stringValue(left.string() + right.string()), nil
+	}
+
+	if left.kind == intKind && right.kind == intKind {
+		li, ri := left.i, right.i
+		switch op {
+		case "+":
+			return intValue(li + ri), nil
+		case "-":
+			return intValue(li - ri), nil
+		case "*":
+			return intValue(li * ri), nil
+		case "/":
+			if ri == 0 {
+				return value{}, fmt.Errorf("division by zero")
+			}
+			// Integer division truncates, as in BehaviorTree.CPP
+			return intValue(li / ri), nil
+		case "%":
+			if ri == 0 {
+				return value{}, fmt.Errorf("division by zero")
+			}
+			return intValue(li % ri), nil
+		}
+	}
+
+	lf, lok := left.toFloat()
+	rf, rok := right.toFloat()
+	if !lok || !rok {
+		return value{}, fmt.Errorf("operator '%s' not applicable to %s and %s", op, left.describe(), right.describe())
+	}
+	switch op {
+	case "+":
+		return floatValue(lf + rf), nil
+	case "-":
+		return floatValue(lf - rf), nil
+	case "*":
+		return floatValue(lf * rf), nil
+	case "/":
+		if rf == 0 {
+			return value{}, fmt.Errorf("division by zero")
+		}
+		return floatValue(lf / rf), nil
+	case "%":
+		if rf == 0 {
+			return value{}, fmt.Errorf("division by zero")
+		}
+		return floatValue(math.Mod(lf, rf)), nil
+	case "<":
+		return boolValue(lf < rf), nil
+	case "<=":
+		return boolValue(lf <= rf), nil
+	case ">":
+		return boolValue(lf > rf), nil
+	case ">=":
+		return boolValue(lf >= rf), nil
+	}
+	return value{}, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// equals compares two values, numbers compare by value
+func equals(left, right value) bool {
+	lf, lok := left.toFloat()
+	rf, rok := right.toFloat()
+	if lok && rok {
+		return lf == rf
+	}
+	if left.kind == stringKind && rok {
+		return left.s == right.string()
+	}
+	if right.kind == stringKind && lok {
+		return right.s == left.string()
+	}
+	if left.kind != right.kind {
+		return false
+	}
+	switch left.kind {
+	case nilKind:
+		return true
+	case boolKind:
+		return left.i == right.i
+	case stringKind:
+		return left.s == right.s
+	}
+	if reflect.TypeOf(left.other).Comparable() && reflect.TypeOf(right.other).Comparable() {
+		return left.other == right.other
+	}
+	return reflect.DeepEqual(left.other, right.other)
+}
+
+// normalize maps Go values to the script value domain: bool, int64, float64, string
+func normalize(v interface{}) value {
+	switch v := v.(type) {
+	case nil:
+		return value{}
+	case bool:
+		return boolValue(v)
+	case int64:
+		return intValue(v)
+	case float64:
+		return floatValue(v)
+	case string:
+		return stringValue(v)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intValue(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return intValue(int64(rv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return floatValue(rv.Float())
+	case reflect.Bool:
+		return boolValue(rv.Bool())
+	case reflect.String:
+		return stringValue(rv.String())
+	}
+	return value{kind: otherKind, other: v}
+}
+
+// scalarValue maps a scalar to the script value domain
+func scalarValue(s Scalar) value {
+	switch {
+	case s.Kind == reflect.Bool:
+		return boolValue(s.Bool())
+	case s.isFloat():
+		return floatValue(s.Float())
+	case s.IsNumber():
+		return intValue(s.Int())
+	}
+	return value{}
+}
+
+// toInterface converts v to the Go value stored for new variables: integers
+// become int
+func (v value) toInterface() interface{} {
+	switch v.kind {
+	case boolKind:
+		return v.i != 0
+	case intKind:
+		return int(v.i)
+	case floatKind:
+		return v.f
+	case stringKind:
+		return v.s
+	case otherKind:
+		return v.other
+	}
+	return nil
+}
+
+// scalar returns a number or a boolean as a Scalar, integers as kind
+func (v value) scalar(integer reflect.Kind) (Scalar, bool) {
+	switch v.kind {
+	case boolKind:
+		return BoolScalar(v.i != 0), true
+	case intKind:
+		return Scalar{reflect.Int64, uint64(v.i)}.Convert(integer)
+	case floatKind:
+		return Scalar{reflect.Float64, math.Float64bits(v.f)}, true
+	}
+	return Scalar{}, false
+}
+
+// toScalar converts v to the scalar kind of an existing variable. Floats
+// are rounded to the precision of kind, integers must fit in kind.
+func (v value) toScalar(kind reflect.Kind) (Scalar, error) {
+	s, ok := v.scalar(reflect.Int64)
+	target := Scalar{Kind: kind}
+	if ok && s.IsNumber() && target.IsNumber() {
+		if target.isFloat() {
+			s, _ = s.Convert(kind)
+			return s, nil
+		}
+		return s.ConvertExact(kind)
+	}
+	if ok && s.Kind == kind {
+		return s, nil
+	}
+	return Scalar{}, fmt.Errorf("can't convert %s to %s", v.describe(), kind)
+}
+
+// convertTo converts a script value to the Go type of an existing variable
+func convertTo(v value, target reflect.Type) (interface{}, error) {
+	if v.kind == nilKind {
+		return nil, fmt.Errorf("can't convert nil to %s", target)
+	}
+	if v.kind == otherKind && reflect.TypeOf(v.other) == target {
+		return v.other, nil
+	}
+	switch target.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		s, err := v.toScalar(target.Kind())
+		if err != nil {
+			return nil, err
+		}
+		if s.Type() == target {
+			return s.Interface(), nil
+		}
+		return reflect.ValueOf(s.Interface()).Convert(target).Interface(), nil
+	case reflect.String:
+		return reflect.ValueOf(v.string()).Convert(target).Interface(), nil
+	case reflect.Interface:
+		return v.toInterface(), nil
+	}
+	return nil, fmt.Errorf("can't convert %s to %s", v.describe(), target)
+}
+
+// toBool interprets v as a boolean, see ToBool
+func (v value) toBool() (bool, error) {
+	switch v.kind {
+	case boolKind, intKind:
+		return v.i != 0, nil
+	case floatKind:
+		return v.f != 0, nil
+	case stringKind:
+		b, err := strconv.ParseBool(v.s)
+		if err != nil {
+			return false, fmt.Errorf("can't convert string '%s' to bool", v.s)
+		}
+		return b, nil
+	case nilKind:
+		return false, nil
+	}
+	return false, fmt.Errorf("can't convert %s to bool", v.describe())
+}
+
+func (v value) toFloat() (float64, bool) {
+	switch v.kind {
+	case intKind:
+		return float64(v.i), true
+	case floatKind:
+		return v.f, true
+	}
+	return 0, false
+}
+
+func (v value) string() string {
+	switch v.kind {
+	case stringKind:
+		return v.s
+	case intKind:
+		return strconv.FormatInt(v.i, 10)
+	case floatKind:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case boolKind:
+		return strconv.FormatBool(v.i != 0)
+	case nilKind:
+		return ""
+	}
+	return fmt.Sprint(v.other)
+}
+
+func (v value) describe() string {
+	switch v.kind {
+	case nilKind:
+		return "nil"
+	case boolKind:
+		return "bool"
+	case intKind:
+		return "int64"
+	case floatKind:
+		return "float64"
+	case stringKind:
+		return "string"
+	}
+	return fmt.Sprintf("%T", v.other)
+}
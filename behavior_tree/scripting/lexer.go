@@ -0,0 +1,130 @@
+package scripting
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind enumerates the lexical tokens of the script language
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInteger
+	tokenReal
+	tokenString
+	tokenOperator
+	tokenSemicolon
+)
+
+// token is a single lexical unit with its byte offset in the source
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists all multi and single character operators, longest first
+var operators = []string{
+	":=", "+=", "-=", "*=", "/=", "==", "!=", "<=", ">=", "&&", "||", "..",
+	"=", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "(", ")",
+}
+
+// tokenize splits source into tokens
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == ';':
+			tokens = append(tokens, token{kind: tokenSemicolon, text: ";", pos: i})
+			i++
+
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(source) && source[i] != c {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string starting at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+
+		case isDigit(c) || (c == '.' && i+1 < len(source) && isDigit(source[i+1])):
+			start := i
+			kind := tokenInteger
+			for i < len(source) && isDigit(source[i]) {
+				i++
+			}
+			// A single dot followed by a digit is a decimal point, ".." is concatenation
+			if i+1 < len(source) && source[i] == '.' && isDigit(source[i+1]) {
+				kind = tokenReal
+				i++
+				for i < len(source) && isDigit(source[i]) {
+					i++
+				}
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				j := i + 1
+				if j < len(source) && (source[j] == '+' || source[j] == '-') {
+					j++
+				}
+				if j < len(source) && isDigit(source[j]) {
+					kind = tokenReal
+					i = j
+					for i < len(source) && isDigit(source[i]) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, token{kind: kind, text: source[start:i], pos: start})
+
+		case isIdentStart(c):
+			start := i
+			for i < len(source) && isIdentPart(source[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at offset %d", c, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(source)})
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
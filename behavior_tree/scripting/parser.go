@@ -0,0 +1,209 @@
+package scripting
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// parser is a recursive descent parser over a token stream
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseStatements parses a semicolon separated list of expressions
+func (p *parser) parseStatements() ([]expr, error) {
+	var statements []expr
+	for {
+		for p.peek().kind == tokenSemicolon {
+			p.next()
+		}
+		if p.peek().kind == tokenEOF {
+			return statements, nil
+		}
+
+		statement, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+
+		switch tok := p.peek(); tok.kind {
+		case tokenSemicolon, tokenEOF:
+		default:
+			return nil, fmt.Errorf("unexpected '%s' at offset %d", tok.text, tok.pos)
+		}
+	}
+}
+
+func (p *parser) parseAssignment() (expr, error) {
+	if p.peek().kind == tokenIdent {
+		if op := p.peekAt(1); op.kind == tokenOperator {
+			switch op.text {
+			case ":=", "=", "+=", "-=", "*=", "/=":
+				name := p.next().text
+				p.next()
+				value, err := p.parseAssignment()
+				if err != nil {
+					return nil, err
+				}
+				return &assignExpr{op: op.text, name: name, value: value}, nil
+			}
+		}
+	}
+	return p.parseTernary()
+}
+
+func (p *parser) parseTernary() (expr, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryExpr{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// binaryLevels lists binary operators from lowest to highest precedence
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-", ".."},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokenOperator || !contains(binaryLevels[level], tok.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if tok := p.peek(); tok.kind == tokenOperator && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: tok.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenInteger:
+		value, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer '%s' at offset %d", tok.text, tok.pos)
+		}
+		return &literalExpr{value: intValue(value)}, nil
+	case tokenReal:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at offset %d", tok.text, tok.pos)
+		}
+		return &literalExpr{value: floatValue(value)}, nil
+	case tokenString:
+		return &literalExpr{value: stringValue(tok.text)}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literalExpr{value: boolValue(true)}, nil
+		case "false":
+			return &literalExpr{value: boolValue(false)}, nil
+		}
+		return &identExpr{name: tok.text}, nil
+	case tokenOperator:
+		if tok.text == "(" {
+			inner, err := p.parseAssignment()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of script")
+	}
+	return nil, fmt.Errorf("unexpected '%s' at offset %d", tok.text, tok.pos)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if p.accept(op) {
+		return nil
+	}
+	tok := p.peek()
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("expected '%s' at end of script", op)
+	}
+	return fmt.Errorf("expected '%s' at offset %d, found '%s'", op, tok.pos, tok.text)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
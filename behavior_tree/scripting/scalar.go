@@ -0,0 +1,255 @@
+package scripting
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Scalar is a boolean or a number of a predeclared Go type, such as int32
+// or float64, held without boxing it in an interface{}
+type Scalar struct {
+	// Kind is reflect.Invalid for the zero Scalar, which holds no value
+	Kind reflect.Kind
+	// Bits is the int64 or uint64 value of integers, the math.Float64bits
+	// of floats and 1 for true
+	Bits uint64
+}
+
+// ScalarEnvironment is implemented by environments able to exchange
+// booleans and numbers without boxing them, such as *core.Blackboard.
+// Scripts executed in such an environment do not allocate.
+type ScalarEnvironment interface {
+	Environment
+	// GetScalar returns the variable key if it holds a Scalar
+	GetScalar(key string) (Scalar, bool)
+	SetScalar(key string, value Scalar) error
+}
+
+// scalarTypes are the types of the scalar kinds
+var scalarTypes = [...]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+}
+
+// ScalarType returns the predeclared type of kind, nil if kind is not a
+// scalar kind
+func ScalarType(kind reflect.Kind) reflect.Type {
+	if int(kind) >= len(scalarTypes) {
+		return nil
+	}
+	return scalarTypes[kind]
+}
+
+// ScalarOf returns value as a Scalar if its type is a predeclared boolean
+// or numeric type. Named types such as time.Duration are not scalars.
+func ScalarOf(value interface{}) (Scalar, bool) {
+	switch v := value.(type) {
+	case bool:
+		return BoolScalar(v), true
+	case int:
+		return Scalar{reflect.Int, uint64(v)}, true
+	case int8:
+		return Scalar{reflect.Int8, uint64(v)}, true
+	case int16:
+		return Scalar{reflect.Int16, uint64(v)}, true
+	case int32:
+		return Scalar{reflect.Int32, uint64(v)}, true
+	case int64:
+		return Scalar{reflect.Int64, uint64(v)}, true
+	case uint:
+		return Scalar{reflect.Uint, uint64(v)}, true
+	case uint8:
+		return Scalar{reflect.Uint8, uint64(v)}, true
+	case uint16:
+		return Scalar{reflect.Uint16, uint64(v)}, true
+	case uint32:
+		return Scalar{reflect.Uint32, uint64(v)}, true
+	case uint64:
+		return Scalar{reflect.Uint64, v}, true
+	case float32:
+		return Scalar{reflect.Float32, math.Float64bits(float64(v))}, true
+	case float64:
+		return Scalar{reflect.Float64, math.Float64bits(v)}, true
+	}
+	return Scalar{}, false
+}
+
+// BoolScalar returns b as a Scalar
+func BoolScalar(b bool) Scalar {
+	if b {
+		return Scalar{reflect.Bool, 1}
+	}
+	return Scalar{Kind: reflect.Bool}
+}
+
+// IsValid tells if s holds a value
+func (s Scalar) IsValid() bool {
+	return s.Kind != reflect.Invalid
+}
+
+// IsNumber tells if s holds an integer or a float
+func (s Scalar) IsNumber() bool {
+	return s.Kind >= reflect.Int && s.Kind <= reflect.Float64 && s.Kind != reflect.Uintptr
+}
+
+func (s Scalar) isFloat() bool {
+	return s.Kind == reflect.Float32 || s.Kind == reflect.Float64
+}
+
+func (s Scalar) isUnsigned() bool {
+	return s.Kind >= reflect.Uint && s.Kind <= reflect.Uint64
+}
+
+// Type returns the predeclared type of the value
+func (s Scalar) Type() reflect.Type {
+	return ScalarType(s.Kind)
+}
+
+// Bool returns the value of a boolean
+func (s Scalar) Bool() bool {
+	return s.Bits != 0
+}
+
+// Int returns a number as an int64, truncating floats
+func (s Scalar) Int() int64 {
+	if s.isFloat() {
+		return int64(s.Float())
+	}
+	return int64(s.Bits)
+}
+
+// Uint returns a number as an uint64, truncating floats
+func (s Scalar) Uint() uint64 {
+	if s.isFloat() {
+		return uint64(s.Float())
+	}
+	return s.Bits
+}
+
+// Float returns a number as a float64
+func (s Scalar) Float() float64 {
+	switch {
+	case s.isFloat():
+		return math.Float64frombits(s.Bits)
+	case s.isUnsigned():
+		return float64(s.Bits)
+	}
+	return float64(int64(s.Bits))
+}
+
+// Convert converts a number to another numeric kind with the rules of Go
+// conversions: integers are truncated to the size of kind, floats to
+// integers. It returns false if s or kind is not numeric, except that
+// converting a boolean to reflect.Bool returns it unchanged.
+func (s Scalar) Convert(kind reflect.Kind) (Scalar, bool) {
+	if s.Kind == kind {
+		return s, true
+	}
+	target := Scalar{Kind: kind}
+	if !s.IsNumber() || !target.IsNumber() {
+		return Scalar{}, false
+	}
+	switch kind {
+	case reflect.Int:
+		target.Bits = uint64(int(s.Int()))
+	case reflect.Int8:
+		target.Bits = uint64(int8(s.Int()))
+	case reflect.Int16:
+		target.Bits = uint64(int16(s.Int()))
+	case reflect.Int32:
+		target.Bits = uint64(int32(s.Int()))
+	case reflect.Int64:
+		target.Bits = uint64(s.Int())
+	case reflect.Uint:
+		target.Bits = uint64(uint(s.Uint()))
+	case reflect.Uint8:
+		target.Bits = uint64(uint8(s.Uint()))
+	case reflect.Uint16:
+		target.Bits = uint64(uint16(s.Uint()))
+	case reflect.Uint32:
+		target.Bits = uint64(uint32(s.Uint()))
+	case reflect.Uint64:
+		target.Bits = s.Uint()
+	case reflect.Float32:
+		target.Bits = math.Float64bits(float64(float32(s.Float())))
+	case reflect.Float64:
+		target.Bits = math.Float64bits(s.Float())
+	}
+	return target, true
+}
+
+// ConvertExact converts a number to another numeric kind like Convert, but
+// fails if kind can't represent the value exactly: a float with a fractional
+// part converted to an integer, a value out of the range of kind, such as a
+// negative number converted to an unsigned integer, or an integer too large
+// to be a float of kind.
+func (s Scalar) ConvertExact(kind reflect.Kind) (Scalar, error) {
+	converted, ok := s.Convert(kind)
+	if !ok {
+		return Scalar{}, fmt.Errorf("can't convert %s to %s", s.Kind, kind)
+	}
+	if s.Kind == kind {
+		return converted, nil
+	}
+	target := Scalar{Kind: kind}
+	switch {
+	case s.isFloat() && !target.isFloat() && s.Float() != math.Trunc(s.Float()):
+		return Scalar{}, fmt.Errorf("%v is not an integer, can't convert it to %s", s.Interface(), kind)
+	case target.isUnsigned() && s.Float() < 0,
+		s.isUnsigned() && !target.isUnsigned() && int64(s.Bits) < 0:
+		return Scalar{}, fmt.Errorf("%v is out of the range of %s", s.Interface(), kind)
+	}
+	if back, _ := converted.Convert(s.Kind); back.Bits != s.Bits {
+		if target.isFloat() {
+			return Scalar{}, fmt.Errorf("%v can't be represented exactly as %s", s.Interface(), kind)
+		}
+		return Scalar{}, fmt.Errorf("%v is out of the range of %s", s.Interface(), kind)
+	}
+	return converted, nil
+}
+
+// Interface returns the value boxed in an interface{}, nil for the zero
+// Scalar
+func (s Scalar) Interface() interface{} {
+	switch s.Kind {
+	case reflect.Bool:
+		return s.Bool()
+	case reflect.Int:
+		return int(s.Bits)
+	case reflect.Int8:
+		return int8(s.Bits)
+	case reflect.Int16:
+		return int16(s.Bits)
+	case reflect.Int32:
+		return int32(s.Bits)
+	case reflect.Int64:
+		return int64(s.Bits)
+	case reflect.Uint:
+		return uint(s.Bits)
+	case reflect.Uint8:
+		return uint8(s.Bits)
+	case reflect.Uint16:
+		return uint16(s.Bits)
+	case reflect.Uint32:
+		return uint32(s.Bits)
+	case reflect.Uint64:
+		return s.Bits
+	case reflect.Float32:
+		return float32(s.Float())
+	case reflect.Float64:
+		return s.Float()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package scripting implements the small expression language used by Script
+// nodes and node pre/post conditions.
+//
+// A script is a list of expressions separated by ';'. Supported syntax:
+//
+//	counter := 0                 create or overwrite a variable
+//	counter = 1                  assign an existing variable
+//	counter += 1                 also -=, *=, /=
+//	a + b * (c - d) % 2          arithmetic
+//	'Hello ' .. name             string concatenation ('+' also works on strings)
+//	a == b && !(c < d || e)      comparison and boolean logic
+//	ready ? 'go' : 'wait'        ternary
+//
+// Variables are read from and written to an Environment, normally the node's
+// blackboard. Identifiers found in the enum table resolve to integer constants.
+package scripting
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Environment is the variable storage a script reads from and writes to.
+// *core.Blackboard satisfies this interface.
+type Environment interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}) error
+}
+
+// Script is a parsed script, ready to be executed many times
+type Script struct {
+	source     string
+	statements []expr
+}
+
+// Parse parses source into a reusable Script
+func Parse(source string) (*Script, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("script '%s': %v", source, err)
+	}
+
+	p := &parser{tokens: tokens}
+	statements, err := p.parseStatements()
+	if err != nil {
+		return nil, fmt.Errorf("script '%s': %v", source, err)
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("script is empty")
+	}
+
+	return &Script{source: source, statements: statements}, nil
+}
+
+// MustParse is like Parse but panics if the script cannot be parsed
+func MustParse(source string) *Script {
+	script, err := Parse(source)
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// Source returns the original script text
+func (s *Script) Source() string {
+	return s.source
+}
+
+// Execute runs every statement and returns the value of the last one
+func (s *Script) Execute(env Environment, enums map[string]int) (interface{}, error) {
+	result, err := s.run(env, enums)
+	if err != nil {
+		return nil, err
+	}
+	return result.toInterface(), nil
+}
+
+// Run runs every statement, for scripts executed for their side effects.
+// Unlike Execute, it does not box the value of the last statement.
+func (s *Script) Run(env Environment, enums map[string]int) error {
+	_, err := s.run(env, enums)
+	return err
+}
+
+// run runs every statement and returns the value of the last one
+func (s *Script) run(env Environment, enums map[string]int) (value, error) {
+	// A typed nil such as (*core.Blackboard)(nil) means no environment
+	if rv := reflect.ValueOf(env); env != nil && rv.Kind() == reflect.Ptr && rv.IsNil() {
+		env = nil
+	}
+
+	ctx := evalContext{env: env, enums: enums}
+	var result value
+	for _, statement := range s.statements {
+		v, err := statement.eval(ctx)
+		if err != nil {
+			return value{}, fmt.Errorf("script '%s': %v", s.source, err)
+		}
+		result = v
+	}
+	return result, nil
+}
+
+// EvalBool runs the script and interprets its result as a boolean
+func (s *Script) EvalBool(env Environment, enums map[string]int) (bool, error) {
+	result, err := s.run(env, enums)
+	if err != nil {
+		return false, err
+	}
+	b, err := result.toBool()
+	if err != nil {
+		return false, fmt.Errorf("script '%s': %v", s.source, err)
+	}
+	return b, nil
+}
+
+// ToBool interprets a script value as a boolean. Numbers are true when not
+// zero, strings must spell a boolean.
+func ToBool(value interface{}) (bool, error) {
+	return normalize(value).toBool()
+}
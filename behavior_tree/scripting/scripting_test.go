@@ -0,0 +1,219 @@
+package scripting
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mapEnv is a minimal Environment backed by a map
+type mapEnv map[string]interface{}
+
+func (m mapEnv) Get(key string) (interface{}, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+func (m mapEnv) Set(key string, value interface{}) error {
+	m[key] = value
+	return nil
+}
+
+// scalarEnv is an Environment storing booleans and numbers as Scalars
+type scalarEnv struct {
+	scalars map[string]Scalar
+	values  mapEnv
+}
+
+func newScalarEnv() *scalarEnv {
+	return &scalarEnv{scalars: make(map[string]Scalar), values: mapEnv{}}
+}
+
+func (e *scalarEnv) Get(key string) (interface{}, bool) {
+	if s, ok := e.scalars[key]; ok {
+		return s.Interface(), true
+	}
+	return e.values.Get(key)
+}
+
+func (e *scalarEnv) Set(key string, value interface{}) error {
+	if s, ok := ScalarOf(value); ok {
+		return e.SetScalar(key, s)
+	}
+	return e.values.Set(key, value)
+}
+
+func (e *scalarEnv) GetScalar(key string) (Scalar, bool) {
+	s, ok := e.scalars[key]
+	return s, ok
+}
+
+func (e *scalarEnv) SetScalar(key string, value Scalar) error {
+	e.scalars[key] = value
+	return nil
+}
+
+func TestScript_Expressions(t *testing.T) {
+	env := mapEnv{"a": 3, "b": 2.5, "name": "orc", "alive": true}
+	enums := map[string]int{"RED": 1, "GREEN": 2}
+
+	cases := []struct {
+		source string
+		want   interface{}
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7.0 / 2", 3.5},
+		{"a / 2.0", 1.5},
+		{"8 / 2", 4},
+		{"7 % 3", 1},
+		{"-a + 1", -2},
+		{"a + b", 5.5},
+		{"a > 2 && b < 3", true},
+		{"!alive || a == 4", false},
+		{"a != 3", false},
+		{"'big ' .. name", "big orc"},
+		{"name + '!'", "orc!"},
+		{"a >= 3 ? 'high' : 'low'", "high"},
+		{"GREEN == 2", true},
+		{"RED + GREEN", 3},
+		{"a == '3'", true},
+	}
+
+	for _, c := range cases {
+		script, err := Parse(c.source)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.source, err)
+		}
+		got, err := script.Execute(env, enums)
+		if err != nil {
+			t.Fatalf("execute %q: %v", c.source, err)
+		}
+		if got != c.want {
+			t.Fatalf("%q: expected %v (%T), got %v (%T)", c.source, c.want, c.want, got, got)
+		}
+	}
+}
+
+func TestScript_Assignment(t *testing.T) {
+	env := mapEnv{"counter": int32(4), "speed": 1.5}
+
+	script := MustParse("counter += 1; speed *= 2; label := 'ok'; total := counter * 10")
+	if _, err := script.Execute(env, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if env["counter"] != int32(5) {
+		t.Fatalf("expected counter to keep its type, got %v (%T)", env["counter"], env["counter"])
+	}
+	if env["speed"] != 3.0 {
+		t.Fatalf("expected speed 3, got %v", env["speed"])
+	}
+	if env["label"] != "ok" {
+		t.Fatalf("expected label 'ok', got %v", env["label"])
+	}
+	if env["total"] != 50 {
+		t.Fatalf("expected total 50, got %v (%T)", env["total"], env["total"])
+	}
+
+	// Executing again reuses the parsed script
+	if _, err := script.Execute(env, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env["counter"] != int32(6) {
+		t.Fatalf("expected counter 6, got %v", env["counter"])
+	}
+}
+
+func TestScript_Errors(t *testing.T) {
+	for _, source := range []string{"", "1 +", "a = = 1", "(1", "'open", "a ? 1", "1 2"} {
+		if _, err := Parse(source); err == nil {
+			t.Fatalf("expected parse error for %q", source)
+		}
+	}
+
+	env := mapEnv{"n": 1}
+	enums := map[string]int{"RED": 1}
+	for _, source := range []string{"missing + 1", "missing = 1", "RED := 2", "n / 0", "n := 'text'", "!'maybe'"} {
+		if _, err := MustParse(source).Execute(env, enums); err == nil {
+			t.Fatalf("expected runtime error for %q", source)
+		}
+	}
+}
+
+func TestScript_EvalBool(t *testing.T) {
+	env := mapEnv{"hp": 10}
+	ok, err := MustParse("hp > 5").EvalBool(env, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected true, got %v (%v)", ok, err)
+	}
+	ok, err = MustParse("hp - 10").EvalBool(env, nil)
+	if err != nil || ok {
+		t.Fatalf("expected false, got %v (%v)", ok, err)
+	}
+}
+
+func TestScript_ScalarEnvironment(t *testing.T) {
+	env := newScalarEnv()
+	env.Set("counter", int32(4))
+	env.Set("speed", 1.5)
+	env.Set("name", "orc")
+
+	script := MustParse("counter += 1; speed *= 2; total := counter * 10; label := name .. '!'")
+	if err := script.Run(env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := env.scalars["counter"]; s.Kind != reflect.Int32 || s.Int() != 5 {
+		t.Fatalf("expected counter to keep its type, got %+v", s)
+	}
+	if s := env.scalars["speed"]; s.Float() != 3 {
+		t.Fatalf("expected speed 3, got %+v", s)
+	}
+	if s := env.scalars["total"]; s.Kind != reflect.Int || s.Int() != 50 {
+		t.Fatalf("expected total int 50, got %+v", s)
+	}
+	if label, _ := env.Get("label"); label != "orc!" {
+		t.Fatalf("expected label 'orc!', got %v", label)
+	}
+	if err := MustParse("counter = 1.5").Run(env, nil); err == nil {
+		t.Fatalf("expected an error storing a non-integer")
+	}
+	if err := MustParse("counter = 3000000000").Run(env, nil); err == nil {
+		t.Fatalf("expected an error storing a number out of the range of int32")
+	}
+	env.Set("ammo", uint8(2))
+	if err := MustParse("ammo -= 3").Run(env, nil); err == nil || !strings.Contains(err.Error(), "out of the range") {
+		t.Fatalf("expected an error storing a negative number in an uint8, got %v", err)
+	}
+	if s := env.scalars["ammo"]; s.Uint() != 2 {
+		t.Fatalf("expected ammo to be left unchanged, got %+v", s)
+	}
+	env.Set("precision", float32(0))
+	if err := MustParse("precision = 0.1").Run(env, nil); err != nil {
+		t.Fatalf("expected floats to be rounded to float32, got %v", err)
+	}
+
+	condition := MustParse("counter > 3 && speed * 2 >= 6 && name == 'orc'")
+	update := MustParse("counter += 1000")
+	if allocs := testing.AllocsPerRun(100, func() {
+		if ok, err := condition.EvalBool(env, nil); !ok || err != nil {
+			t.Fatalf("expected true, got %v (%v)", ok, err)
+		}
+		update.Run(env, nil)
+	}); allocs != 0 {
+		t.Fatalf("expected no allocation, got %v", allocs)
+	}
+}
+
+func BenchmarkScript(b *testing.B) {
+	env := newScalarEnv()
+	env.Set("hp", 100)
+	env.Set("armor", 0.5)
+	script := MustParse("hp > 30 && (armor * 2 < 1.5 ? hp - 10 : hp + 10) >= 90")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		script.EvalBool(env, nil)
+	}
+}
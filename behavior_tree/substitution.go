@@ -0,0 +1,238 @@
+package behavior_tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/actions"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
+)
+
+// SubstitutionRule replaces the nodes matching a filter when a tree is
+// instantiated. Exactly one of RegistrationID and TestConfig must be set.
+type SubstitutionRule struct {
+	// RegistrationID is the registered node created instead
+	RegistrationID string
+	// TestConfig creates an actions.TestNode instead
+	TestConfig *actions.TestNodeConfig
+}
+
+// substitution is a rule with its filter, in the order of registration
+type substitution struct {
+	filter string
+	rule   SubstitutionRule
+}
+
+// AddSubstitutionRule makes the trees instantiated afterwards replace the
+// nodes whose name or path matches the wildcard pattern filter with the
+// node described by rule. In patterns '*' matches any sequence of
+// characters, '/' included, and '?' any single character; "*/network/*"
+// matches the nodes of the subtrees named network.
+// The replacement keeps the ports and conditions of the node it replaces.
+// A TestNode has no children, so test node rules skip controls and
+// decorators.
+// Rules are tried in the order they were added and the first match wins;
+// adding a rule for an existing filter replaces it.
+func (f *BehaviorTreeFactory) AddSubstitutionRule(filter string, rule SubstitutionRule) error {
+	if filter == "" {
+		return fmt.Errorf("empty substitution filter")
+	}
+	if (rule.RegistrationID == "") == (rule.TestConfig == nil) {
+		return fmt.Errorf("substitution rule '%s' needs either a registration ID or a test node configuration", filter)
+	}
+	if rule.TestConfig != nil {
+		if rule.TestConfig.ReturnStatus == core.NodeStatusIdle {
+			return fmt.Errorf("substitution rule '%s': TestNode can not return IDLE", filter)
+		}
+		for _, code := range []string{rule.TestConfig.SuccessScript, rule.TestConfig.FailureScript, rule.TestConfig.PostScript} {
+			if code == "" {
+				continue
+			}
+			if _, err := scripting.Parse(code); err != nil {
+				return fmt.Errorf("substitution rule '%s': invalid script: %v", filter, err)
+			}
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, s := range f.substitutions {
+		if s.filter == filter {
+			f.substitutions[i].rule = rule
+			return nil
+		}
+	}
+	f.substitutions = append(f.substitutions, substitution{filter: filter, rule: rule})
+	return nil
+}
+
+// SubstitutionRules returns the rules by filter
+func (f *BehaviorTreeFactory) SubstitutionRules() map[string]SubstitutionRule {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	rules := make(map[string]SubstitutionRule, len(f.substitutions))
+	for _, s := range f.substitutions {
+		rules[s.filter] = s.rule
+	}
+	return rules
+}
+
+// ClearSubstitutionRules removes all substitution rules
+func (f *BehaviorTreeFactory) ClearSubstitutionRules() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.substitutions = nil
+}
+
+// testNodeConfigJSON is a TestNodeConfig in a substitution file
+type testNodeConfigJSON struct {
+	ReturnStatus  string `json:"return_status"`
+	AsyncDelay    int64  `json:"async_delay"`
+	SuccessScript string `json:"success_script"`
+	FailureScript string `json:"failure_script"`
+	PostScript    string `json:"post_script"`
+}
+
+// substitutionsJSON is the format of BehaviorTree.CPP substitution files
+type substitutionsJSON struct {
+	TestNodeConfigs   map[string]testNodeConfigJSON `json:"TestNodeConfigs"`
+	SubstitutionRules map[string]string             `json:"SubstitutionRules"`
+}
+
+// LoadSubstitutionRulesFromJSON adds the rules of a document in the
+// BehaviorTree.CPP format:
+//
+//	{
+//	  "TestNodeConfigs": {
+//	    "NetworkOK": {"return_status": "SUCCESS", "async_delay": 200, "post_script": "sent := true"}
+//	  },
+//	  "SubstitutionRules": {
+//	    "*/network/*": "NetworkOK",
+//	    "Jump": "AlwaysSuccess"
+//	  }
+//	}
+//
+// A rule naming a test node configuration creates a TestNode, any other
+// value is a registration ID. async_delay is in milliseconds and
+// return_status defaults to SUCCESS. The rules are added sorted by filter.
+func (f *BehaviorTreeFactory) LoadSubstitutionRulesFromJSON(data []byte) error {
+	var document substitutionsJSON
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("invalid substitution rules: %v", err)
+	}
+
+	testConfigs := make(map[string]*actions.TestNodeConfig, len(document.TestNodeConfigs))
+	for name, c := range document.TestNodeConfigs {
+		status := core.NodeStatusSuccess
+		if c.ReturnStatus != "" {
+			var err error
+			if status, err = core.ParseNodeStatus(c.ReturnStatus); err != nil {
+				return fmt.Errorf("test node configuration '%s': %v", name, err)
+			}
+		}
+		if c.AsyncDelay < 0 {
+			return fmt.Errorf("test node configuration '%s': negative async_delay", name)
+		}
+		testConfigs[name] = &actions.TestNodeConfig{
+			ReturnStatus:  status,
+			AsyncDelay:    time.Duration(c.AsyncDelay) * time.Millisecond,
+			SuccessScript: c.SuccessScript,
+			FailureScript: c.FailureScript,
+			PostScript:    c.PostScript,
+		}
+	}
+
+	filters := make([]string, 0, len(document.SubstitutionRules))
+	for filter := range document.SubstitutionRules {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	for _, filter := range filters {
+		target := document.SubstitutionRules[filter]
+		rule := SubstitutionRule{RegistrationID: target}
+		if testConfig, ok := testConfigs[target]; ok {
+			rule = SubstitutionRule{TestConfig: testConfig}
+		}
+		if err := f.AddSubstitutionRule(filter, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadSubstitutionRulesFromFile adds the rules of a JSON file, see
+// LoadSubstitutionRulesFromJSON
+func (f *BehaviorTreeFactory) LoadSubstitutionRulesFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := f.LoadSubstitutionRulesFromJSON(data); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// substitute returns the rule of the first filter matching the name or
+// the path of a node. Test nodes only replace leaves.
+func (f *BehaviorTreeFactory) substitute(name, path string, leaf bool) (SubstitutionRule, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for _, s := range f.substitutions {
+		if s.rule.TestConfig != nil && !leaf {
+			continue
+		}
+		if wildcardMatch(s.filter, name) || wildcardMatch(s.filter, path) {
+			return s.rule, true
+		}
+	}
+	return SubstitutionRule{}, false
+}
+
+// substituteCreator returns the constructor of the replacement described by rule
+func (f *BehaviorTreeFactory) substituteCreator(rule SubstitutionRule) (TreeNodeCreator, error) {
+	if rule.TestConfig != nil {
+		testConfig := rule.TestConfig
+		return func(name string, config core.NodeConfig) (core.Node, error) {
+			return actions.NewTestNode(name, config, testConfig), nil
+		}, nil
+	}
+	_, creator, ok := f.lookup(rule.RegistrationID)
+	if !ok {
+		return nil, fmt.Errorf("unknown substitute node '%s'", rule.RegistrationID)
+	}
+	return creator, nil
+}
+
+// wildcardMatch reports whether s matches pattern, where '*' matches any
+// sequence of characters and '?' any single character
+func wildcardMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			// Let the last star match one more character
+			mark++
+			p, i = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
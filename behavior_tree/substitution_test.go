@@ -0,0 +1,118 @@
+package behavior_tree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/actions"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+const substitutionXML = `<root BTCPP_format="4" main_tree_to_execute="Main">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <SubTree ID="Network" name="network" />
+      <Jump height="3" />
+      <Fallback>
+        <AlwaysFailure name="attack" />
+        <AlwaysFailure name="flee" />
+      </Fallback>
+    </Sequence>
+  </BehaviorTree>
+  <BehaviorTree ID="Network">
+    <Sequence>
+      <Connect host="server" />
+      <Send message="hello" />
+    </Sequence>
+  </BehaviorTree>
+</root>`
+
+func TestBehaviorTreeFactory_SubstitutionRules(t *testing.T) {
+	if !wildcardMatch("*/network/*", "Sequence::1/network/Sequence::3/Send::5") || wildcardMatch("net?", "network") {
+		t.Fatalf("unexpected wildcard matches")
+	}
+
+	factory := NewBehaviorTreeFactory()
+	if err := factory.RegisterBehaviorTreeFromText(substitutionXML); err != nil {
+		t.Fatal(err)
+	}
+	// Connect, Send and Jump are not registered: without rules the tree can't be created
+	if _, err := factory.CreateTree("Main", nil); err == nil {
+		t.Fatalf("expected an unknown node error")
+	}
+
+	filename := filepath.Join(t.TempDir(), "mocks.json")
+	err := os.WriteFile(filename, []byte(`{
+  "TestNodeConfigs": {
+    "Slow": {"async_delay": 100},
+    "Broken": {"return_status": "FAILURE"}
+  },
+  "SubstitutionRules": {
+    "*/network/*": "Slow",
+    "Jump": "AlwaysSuccess",
+    "attack": "Broken"
+  }
+}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.LoadSubstitutionRulesFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	err = factory.AddSubstitutionRule("flee", SubstitutionRule{TestConfig: &actions.TestNodeConfig{ReturnStatus: core.NodeStatusSuccess}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := factory.SubstitutionRules(); len(rules) != 4 || rules["Jump"].RegistrationID != "AlwaysSuccess" {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+
+	tree, err := factory.CreateTree("Main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 0)
+	clock := core.NewSimulatedClock(start)
+	tree.SetClock(clock)
+	status, err := tree.TickWhileRunning(context.Background(), time.Hour)
+	if err != nil || status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s, %v", status, err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed != 200*time.Millisecond {
+		t.Fatalf("expected two async test nodes of 100ms, got %s", elapsed)
+	}
+	if _, ok := findNode(tree.RootNode(), "attack").(*actions.TestNode); !ok {
+		t.Fatalf("attack was not substituted")
+	}
+
+	errorCases := []string{
+		`{"SubstitutionRules": {"Jump": "DoesNotExist"}}`,
+		`{"TestNodeConfigs": {"Bad": {"return_status": "MAYBE"}}}`,
+		`{"SubstitutionRules": {"Jump": 3}}`,
+	}
+	for _, c := range errorCases {
+		factory.ClearSubstitutionRules()
+		if err := factory.LoadSubstitutionRulesFromJSON([]byte(c)); err != nil {
+			continue
+		}
+		if _, err := factory.CreateTree("Main", nil); err == nil {
+			t.Errorf("expected an error for %s", c)
+		}
+	}
+}
+
+// findNode returns the first node named name under root
+func findNode(root core.Node, name string) core.Node {
+	if root.Name() == name {
+		return root
+	}
+	for _, child := range root.Children() {
+		if node := findNode(child, name); node != nil {
+			return node
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package behavior_tree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/actfuns/gamekit/behavior_tree/actions"
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+func TestTestNode_Scripts(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	err := factory.RegisterBehaviorTreeFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <Script code="sent := 0; log := ''" />
+      <Send name="send" />
+      <Fallback>
+        <Receive name="receive" />
+        <AlwaysSuccess />
+      </Fallback>
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = factory.LoadSubstitutionRulesFromJSON([]byte(`{
+  "TestNodeConfigs": {
+    "Send": {"async_delay": 50, "success_script": "sent += 1", "post_script": "log += 'send '"},
+    "Receive": {"return_status": "FAILURE", "success_script": "sent = -1", "failure_script": "log += 'timeout '", "post_script": "log += 'receive'"}
+  },
+  "SubstitutionRules": {"send": "Send", "receive": "Receive"}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = factory.AddSubstitutionRule("bad", SubstitutionRule{TestConfig: &actions.TestNodeConfig{ReturnStatus: core.NodeStatusSuccess, PostScript: "x +="}})
+	if err == nil {
+		t.Fatalf("expected an invalid script error")
+	}
+
+	// Trees sharing the test configurations run concurrently, each with its own clock
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		tree, err := factory.CreateTree("Main", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clock := core.NewManualClock(time.Unix(0, 0))
+			tree.SetClock(clock)
+			if status := tree.Tick(); status != core.NodeStatusRunning {
+				t.Errorf("expected RUNNING before the async delay, got %s", status)
+				return
+			}
+			if deadline, ok := tree.WakeUpSignal().Deadline(); !ok || !deadline.Equal(time.Unix(0, 0).Add(50*time.Millisecond)) {
+				t.Errorf("expected a wake up at the end of the delay, got %v %v", deadline, ok)
+			}
+			clock.Advance(50 * time.Millisecond)
+			if !tree.Sleep(time.Second) {
+				t.Errorf("the test node did not wake up the tree")
+			}
+			if status := tree.Tick(); status != core.NodeStatusSuccess {
+				t.Errorf("expected SUCCESS, got %s", status)
+			}
+			if sent, _ := tree.Blackboard().Get("sent"); sent != 1 {
+				t.Errorf("expected sent = 1, got %v", sent)
+			}
+			if log, _ := tree.Blackboard().Get("log"); log != "send timeout receive" {
+				t.Errorf("unexpected log %q", log)
+			}
+		}()
+	}
+	wg.Wait()
+}
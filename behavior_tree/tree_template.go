@@ -0,0 +1,201 @@
+package behavior_tree
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// TreeTemplate is a tree compiled once from its XML definition, to create
+// many instances cheaply. The instances share the immutable part of their
+// nodes, see core.NodeDefinition: structure, ports, attributes and parsed
+// scripts. Creating an instance only allocates the nodes' state and the
+// blackboards. A TreeTemplate can be used by several goroutines.
+type TreeTemplate struct {
+	id    string
+	root  *templateNode
+	world *core.Blackboard
+	// pool keeps the released instances
+	pool sync.Pool
+}
+
+// templateNode is a compiled node
+type templateNode struct {
+	// element locates the errors of the constructor
+	element    *xmlElement
+	id         string
+	creator    TreeNodeCreator
+	definition *core.NodeDefinition
+	children   []*templateNode
+	// subtree is set for <SubTree> nodes: their children use a new blackboard
+	subtree *subtreeScope
+}
+
+// subtreeScope describes the blackboard of a SubTree instance
+type subtreeScope struct {
+	autoRemap bool
+	// remapping maps the subtree keys to the keys of the parent blackboard
+	remapping map[string]string
+	// values are the literal values of the subtree ports
+	values map[string]string
+}
+
+// treeInstance is the state of one instance, kept while it is pooled
+type treeInstance struct {
+	template   *TreeTemplate
+	root       core.Node
+	blackboard *core.Blackboard
+	// owned tells if the instance created its blackboard, and can be pooled
+	owned bool
+	// blackboards are the blackboards created for the instance, with the
+	// subtree they belong to, nil for the root blackboard
+	blackboards []*core.Blackboard
+	scopes      []*subtreeScope
+}
+
+// CompileTree compiles a registered tree, see XMLParser.CompileTree
+func (f *BehaviorTreeFactory) CompileTree(treeID string) (*TreeTemplate, error) {
+	return f.trees.CompileTree(treeID)
+}
+
+// ID returns the ID of the compiled tree definition
+func (t *TreeTemplate) ID() string {
+	return t.id
+}
+
+// Instantiate creates a new instance of the tree. A nil blackboard creates
+// a new one, child of the world blackboard of the parser if it was set.
+func (t *TreeTemplate) Instantiate(blackboard *core.Blackboard) (*BehaviorTree, error) {
+	instance, err := t.newInstance(blackboard)
+	if err != nil {
+		return nil, err
+	}
+	return instance.tree(), nil
+}
+
+// Acquire returns an instance released before, or a new one with its own
+// blackboard. Give it back with Release when it is no longer used, e.g.
+// when the NPC despawns.
+func (t *TreeTemplate) Acquire() (*BehaviorTree, error) {
+	if instance, ok := t.pool.Get().(*treeInstance); ok {
+		return instance.tree(), nil
+	}
+	instance, err := t.newInstance(nil)
+	if err != nil {
+		return nil, err
+	}
+	return instance.tree(), nil
+}
+
+// Release halts tree and puts it back in the pool of t. Its nodes are
+// reset, their status subscriptions cancelled and its blackboards emptied.
+// Call Halt before to get the cleanup errors of the nodes.
+// The tree must not be used after Release. Trees of other templates, or
+// using a blackboard given to Instantiate, are ignored.
+func (t *TreeTemplate) Release(tree *BehaviorTree) {
+	tree.acquire()
+	defer tree.release()
+	instance := tree.instance
+	if instance == nil || instance.template != t {
+		return
+	}
+	tree.instance = nil
+
+	ApplyRecursiveVisitor(instance.root, func(node core.Node) {
+		if resetter, ok := node.(statusSubscribersResetter); ok {
+			resetter.ClearStatusSubscribers()
+		}
+	})
+	_ = tree.halt()
+	ApplyRecursiveVisitor(instance.root, func(node core.Node) {
+		node.SetStatus(core.NodeStatusIdle)
+	})
+	for i, blackboard := range instance.blackboards {
+		blackboard.Reset()
+		if scope := instance.scopes[i]; scope != nil {
+			// The same values were accepted when the instance was created
+			_ = scope.setValues(blackboard)
+		}
+	}
+	t.pool.Put(instance)
+}
+
+// statusSubscribersResetter is implemented by nodes embedding core.TreeNode
+type statusSubscribersResetter interface {
+	ClearStatusSubscribers()
+}
+
+// tree wraps the instance in a new BehaviorTree
+func (instance *treeInstance) tree() *BehaviorTree {
+	tree := NewBehaviorTree(instance.root, instance.blackboard)
+	tree.id = instance.template.id
+	if instance.owned {
+		tree.instance = instance
+	}
+	return tree
+}
+
+// newInstance creates the nodes and the blackboards of an instance
+func (t *TreeTemplate) newInstance(blackboard *core.Blackboard) (*treeInstance, error) {
+	instance := &treeInstance{template: t, blackboard: blackboard}
+	if blackboard == nil {
+		instance.blackboard = core.NewBlackboard()
+		if t.world != nil {
+			instance.blackboard = core.NewBlackboardWithParent(t.world)
+		}
+		instance.owned = true
+		instance.blackboards = append(instance.blackboards, instance.blackboard)
+		instance.scopes = append(instance.scopes, nil)
+	}
+
+	root, err := instance.newNode(t.root, instance.blackboard)
+	if err != nil {
+		return nil, err
+	}
+	instance.root = root
+	return instance, nil
+}
+
+// newNode creates a node of the instance and its children
+func (instance *treeInstance) newNode(tn *templateNode, blackboard *core.Blackboard) (core.Node, error) {
+	config := tn.definition.Config()
+	config.Blackboard = blackboard
+	config.Definition = tn.definition
+	node, err := createNode(tn.creator, tn.definition.Name(), config)
+	if err != nil {
+		return nil, tn.element.errorf("failed to create node '%s': %v", tn.id, err)
+	}
+
+	if scope := tn.subtree; scope != nil {
+		blackboard = core.NewSubtreeBlackboard(blackboard)
+		blackboard.EnableAutoRemapping(scope.autoRemap)
+		for internal, external := range scope.remapping {
+			blackboard.AddSubtreeRemapping(internal, external)
+		}
+		if err := scope.setValues(blackboard); err != nil {
+			return nil, tn.element.errorf("%v", err)
+		}
+		instance.blackboards = append(instance.blackboards, blackboard)
+		instance.scopes = append(instance.scopes, scope)
+	}
+
+	for _, childTemplate := range tn.children {
+		child, err := instance.newNode(childTemplate, blackboard)
+		if err != nil {
+			return nil, err
+		}
+		node.AddChild(child)
+	}
+	return node, nil
+}
+
+// setValues writes the literal port values to the subtree blackboard
+func (scope *subtreeScope) setValues(blackboard *core.Blackboard) error {
+	for name, value := range scope.values {
+		if err := blackboard.SetConverted(name, value); err != nil {
+			return fmt.Errorf("can't set subtree port '%s': %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package behavior_tree
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+const templateXML = `<root BTCPP_format="4" main_tree_to_execute="NPC">
+  <BehaviorTree ID="NPC">
+    <Sequence>
+      <Script code="hp := 10" />
+      <SubTree ID="Patrol" speed="3" hp="{hp}" />
+      <Repeat num_cycles="2"><Script code="hp -= 1" /></Repeat>
+    </Sequence>
+  </BehaviorTree>
+  <BehaviorTree ID="Patrol">
+    <ScriptCondition code="speed == '3' &amp;&amp; hp == 10" />
+  </BehaviorTree>
+</root>`
+
+func TestTreeTemplate(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	if err := factory.RegisterBehaviorTreeFromText(templateXML); err != nil {
+		t.Fatal(err)
+	}
+	template, err := factory.CompileTree("NPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.ID() != "NPC" {
+		t.Fatalf("unexpected ID %s", template.ID())
+	}
+
+	trees := make([]*BehaviorTree, 4)
+	var wg sync.WaitGroup
+	for i := range trees {
+		if trees[i], err = template.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(tree *BehaviorTree) {
+			defer wg.Done()
+			if status, _ := tree.TickOnce(context.Background()); status != core.NodeStatusSuccess {
+				t.Errorf("expected SUCCESS, got %s", status)
+			}
+		}(trees[i])
+	}
+	wg.Wait()
+
+	// The instances share the definitions of their nodes, not their state
+	definitions := func(tree *BehaviorTree) []*core.NodeDefinition {
+		var result []*core.NodeDefinition
+		tree.ApplyVisitor(func(node core.Node) {
+			result = append(result, node.(interface{ Definition() *core.NodeDefinition }).Definition())
+		})
+		return result
+	}
+	first, second := definitions(trees[0]), definitions(trees[1])
+	if len(first) != 6 || len(first) != len(second) {
+		t.Fatalf("expected 6 nodes, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("node %s has its own definition", first[i].Name())
+		}
+	}
+	if trees[0].Blackboard() == trees[1].Blackboard() || trees[0].RootNode() == trees[1].RootNode() {
+		t.Fatalf("instances share their state")
+	}
+	if hp, _ := trees[0].Blackboard().Get("hp"); hp != 8 {
+		t.Fatalf("expected hp 8, got %v", hp)
+	}
+
+	// Released instances are reset
+	tree := trees[0]
+	blackboard, root := tree.Blackboard(), tree.RootNode()
+	tree.SubscribeToStatusChange(func(core.StatusChange) {
+		t.Errorf("subscription not cancelled by Release")
+	})
+	template.Release(tree)
+	if len(blackboard.Keys()) != 0 || root.Status() != core.NodeStatusIdle {
+		t.Fatalf("released instance not reset: keys %v, status %s", blackboard.Keys(), root.Status())
+	}
+	subtreeBlackboard := root.Children()[1].Children()[0].Blackboard()
+	if speed, _ := subtreeBlackboard.Get("speed"); speed != "3" {
+		t.Fatalf("subtree port values not restored, speed %v", speed)
+	}
+	root.ExecuteTick(context.Background())
+	root.HaltAndReset()
+
+	tree, err = template.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tree.TickOnce(context.Background()); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+
+	// Trees with a blackboard of their own are not pooled
+	tree, err = template.Instantiate(core.NewBlackboard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.TickOnce(context.Background())
+	template.Release(tree)
+	if tree.RootNode().Status() != core.NodeStatusSuccess {
+		t.Fatalf("a tree with a given blackboard was released")
+	}
+}
+
+func BenchmarkTreeTemplate(b *testing.B) {
+	factory := NewBehaviorTreeFactory()
+	if err := factory.RegisterBehaviorTreeFromText(templateXML); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("CreateTree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := factory.CreateTree("NPC", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	template, err := factory.CompileTree("NPC")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Instantiate", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := template.Instantiate(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("AcquireRelease", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tree, err := template.Acquire()
+			if err != nil {
+				b.Fatal(err)
+			}
+			template.Release(tree)
+		}
+	})
+}
@@ -0,0 +1,452 @@
+package behavior_tree
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+// Severity tells whether a Diagnostic prevents a tree from working
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+// String returns the string representation of the Severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a problem found by the validator, located in the XML source
+type Diagnostic struct {
+	Severity Severity
+	File     string
+	Line     int
+	// TreeID is the tree definition containing the problem
+	TreeID  string
+	Message string
+}
+
+// String formats the diagnostic as "file:line: severity: message"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", sourceLocation(d.File, d.Line), d.Severity, d.Message)
+}
+
+// ValidationError is returned when a tree validated on load has errors
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasErrors reports whether diagnostics contain an error, not only warnings
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// SetValidateOnLoad makes InstantiateTree and CompileTree validate the tree
+// and its subtrees first, and fail with a *ValidationError if there are errors
+func (p *XMLParser) SetValidateOnLoad(enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.validateOnLoad = enabled
+}
+
+// Validate checks every registered tree definition and returns the problems
+// found, sorted by file and line. It reports:
+//   - unknown nodes and subtrees, and recursive subtrees
+//   - decorators without exactly one child, controls without children and
+//     leaves with children
+//   - undeclared ports, missing input ports marked as required, see
+//     core.PortInfo.AsRequired, and literals that do not convert to the
+//     port type
+//   - blackboard entries used by ports of incompatible types, or by a port
+//     whose type does not match the entry of the world blackboard
+//   - Switch values naming no child
+//   - as warnings, the definitions not reachable from roots, or from the main
+//     tree when no root is given. Without either, every tree is an entry point.
+func (p *XMLParser) Validate(roots ...string) []Diagnostic {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	v := &validator{parser: p}
+	ids := p.registeredTrees()
+	for _, id := range ids {
+		v.checkTree(p.trees[id])
+	}
+	v.checkRecursion(ids)
+
+	if len(roots) == 0 && p.mainTree != "" {
+		roots = []string{p.mainTree}
+	}
+	if len(roots) > 0 {
+		reachable := v.reachable(roots)
+		for _, id := range ids {
+			if !reachable[id] {
+				definition := p.trees[id]
+				v.diagnostics = append(v.diagnostics, Diagnostic{
+					Severity: SeverityWarning,
+					File:     definition.file,
+					Line:     definition.line,
+					TreeID:   id,
+					Message:  fmt.Sprintf("tree '%s' is never used", id),
+				})
+			}
+		}
+	}
+	return v.sorted()
+}
+
+// validateTree checks treeID and the subtrees it uses. The caller must hold
+// the mutex.
+func (p *XMLParser) validateTree(treeID string) []Diagnostic {
+	v := &validator{parser: p}
+	reachable := v.reachable([]string{treeID})
+	ids := make([]string, 0, len(reachable))
+	for id := range reachable {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		v.checkTree(p.trees[id])
+	}
+	v.checkRecursion(ids)
+	return v.sorted()
+}
+
+// validator collects the diagnostics of tree definitions
+type validator struct {
+	parser      *XMLParser
+	diagnostics []Diagnostic
+	treeID      string
+	// entries records the first port using each blackboard entry of the tree
+	entries map[string]entryUse
+}
+
+// entryUse is a port reading or writing a blackboard entry
+type entryUse struct {
+	t       reflect.Type
+	element *xmlElement
+	port    string
+}
+
+func (v *validator) report(severity Severity, element *xmlElement, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: severity,
+		File:     element.file,
+		Line:     element.line,
+		TreeID:   v.treeID,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) sorted() []Diagnostic {
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		a, b := v.diagnostics[i], v.diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return v.diagnostics
+}
+
+// checkTree checks the nodes of a definition
+func (v *validator) checkTree(definition *treeDefinition) {
+	v.treeID = definition.id
+	v.entries = make(map[string]entryUse)
+	v.checkElement(definition.root)
+}
+
+// elementID returns the registration ID of a node element
+func elementID(element *xmlElement) (string, bool) {
+	if element.name == "SubTree" || genericNodeTags[element.name] {
+		id, ok := element.attr("ID")
+		return id, ok && id != ""
+	}
+	return element.name, true
+}
+
+// elementName returns the name of the node created from element
+func elementName(element *xmlElement) string {
+	if name, ok := element.attr("name"); ok && name != "" {
+		return name
+	}
+	id, _ := elementID(element)
+	return id
+}
+
+func (v *validator) checkElement(element *xmlElement) {
+	defer func() {
+		for _, child := range element.children {
+			v.checkElement(child)
+		}
+	}()
+
+	id, ok := elementID(element)
+	if !ok {
+		v.report(SeverityError, element, "<%s> requires the attribute 'ID'", element.name)
+		return
+	}
+
+	if element.name == "SubTree" {
+		if _, exists := v.parser.trees[id]; !exists {
+			v.report(SeverityError, element, "subtree '%s' not found", id)
+		}
+		if len(element.children) > 0 {
+			v.report(SeverityError, element, "<SubTree> '%s' can't have children", id)
+		}
+		return
+	}
+
+	manifest, _, registered := v.parser.lookupNode(id)
+	if !registered {
+		v.report(SeverityError, element, "unknown node '%s'", id)
+		return
+	}
+
+	children := len(element.children)
+	switch manifest.Type {
+	case core.NodeTypeDecorator:
+		if children != 1 {
+			v.report(SeverityError, element, "decorator '%s' must have exactly one child, found %d", id, children)
+		}
+	case core.NodeTypeControl:
+		if children == 0 {
+			v.report(SeverityError, element, "control '%s' has no children", id)
+		}
+	case core.NodeTypeAction, core.NodeTypeCondition:
+		if children > 0 {
+			v.report(SeverityError, element, "%s '%s' can't have children", strings.ToLower(manifest.Type.String()), id)
+		}
+	}
+
+	v.checkPorts(element, id, manifest)
+	switch id {
+	case "Switch":
+		v.checkSwitch(element)
+	case "Precondition":
+		v.checkPrecondition(element)
+	}
+}
+
+// checkPorts checks the port attributes of a node
+func (v *validator) checkPorts(element *xmlElement, id string, manifest core.TreeNodeManifest) {
+	if len(manifest.Ports) == 0 {
+		// Nodes that declare no ports accept any attribute
+		return
+	}
+
+	for _, a := range element.attrs {
+		name := a.Name.Local
+		if isSpecialAttribute(name) || strings.HasPrefix(name, "_") {
+			continue
+		}
+		port, declared := manifest.Ports[name]
+		if !declared {
+			v.report(SeverityError, element, "port '%s' is not declared by node '%s'", name, id)
+			continue
+		}
+
+		key, isPointer := core.StripBlackboardPointer(a.Value)
+		if !isPointer {
+			if port.Direction != core.PortDirectionOutput {
+				if err := checkLiteral(port, a.Value); err != nil {
+					v.report(SeverityError, element, "port '%s' of node '%s': %v", name, id, err)
+				}
+			}
+			continue
+		}
+		if key == "=" {
+			key = name
+		}
+		v.checkEntryType(element, id, name, port, key)
+	}
+
+	names := make([]string, 0, len(manifest.Ports))
+	for name := range manifest.Ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		port := manifest.Ports[name]
+		if port.Direction != core.PortDirectionInput || !port.Required || port.DefaultValue != "" {
+			continue
+		}
+		if _, set := element.attr(name); !set {
+			v.report(SeverityError, element, "missing required input port '%s' of node '%s'", name, id)
+		}
+	}
+}
+
+// checkEntryType verifies that the ports using the entry key agree on its
+// type, and with the type of the entry in the world blackboard
+func (v *validator) checkEntryType(element *xmlElement, id, name string, port core.PortInfo, key string) {
+	t, known := core.ConverterType(port.TypeName)
+	if !known || t.Kind() == reflect.Interface {
+		return
+	}
+
+	if world := v.parser.world; world != nil {
+		worldKey := strings.TrimPrefix(key, core.RootKeyPrefix)
+		if entry := world.GetEntry(worldKey); entry != nil && entry.Info.Type != nil && !entry.Info.AnyTypeAllowed {
+			if !compatibleTypes(t, entry.Info.Type) {
+				v.report(SeverityError, element, "port '%s' of node '%s' uses entry '%s' as %s, but the world blackboard stores %s",
+					name, id, key, t, entry.Info.Type)
+			}
+		}
+	}
+
+	previous, used := v.entries[key]
+	if !used {
+		v.entries[key] = entryUse{t: t, element: element, port: name}
+		return
+	}
+	if !compatibleTypes(t, previous.t) {
+		v.report(SeverityError, element, "port '%s' of node '%s' uses entry '%s' as %s, but port '%s' at %s uses it as %s",
+			name, id, key, t, previous.port, sourceLocation(previous.element.file, previous.element.line), previous.t)
+	}
+}
+
+// compatibleTypes reports whether values can be passed between two types
+// through the blackboard: strings are parsed, numbers are converted
+func compatibleTypes(a, b reflect.Type) bool {
+	if a == b || a.Kind() == reflect.String || b.Kind() == reflect.String {
+		return true
+	}
+	return isNumericType(a) && isNumericType(b)
+}
+
+func isNumericType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// checkSwitch verifies that a literal switch value names a child
+func (v *validator) checkSwitch(element *xmlElement) {
+	value, ok := element.attr("switch")
+	if !ok {
+		return
+	}
+	if _, isPointer := core.StripBlackboardPointer(value); isPointer {
+		return
+	}
+	for _, child := range element.children {
+		if elementName(child) == value {
+			return
+		}
+	}
+	v.report(SeverityError, element, "Switch case '%s' matches no child", value)
+}
+
+// checkPrecondition checks that a Precondition has a script, given by the
+// port 'if' or by its alias 'code'
+func (v *validator) checkPrecondition(element *xmlElement) {
+	if _, ok := element.attr("if"); ok {
+		return
+	}
+	if _, ok := element.attr("code"); ok {
+		return
+	}
+	v.report(SeverityError, element, "missing required input port 'if' of node 'Precondition'")
+}
+
+// subtreeElements returns the <SubTree> elements under element
+func subtreeElements(element *xmlElement) []*xmlElement {
+	var result []*xmlElement
+	if element.name == "SubTree" {
+		result = append(result, element)
+	}
+	for _, child := range element.children {
+		result = append(result, subtreeElements(child)...)
+	}
+	return result
+}
+
+// reachable returns the registered trees used by roots, including roots
+func (v *validator) reachable(roots []string) map[string]bool {
+	result := make(map[string]bool)
+	pending := append([]string(nil), roots...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		definition, exists := v.parser.trees[id]
+		if !exists || result[id] {
+			continue
+		}
+		result[id] = true
+		for _, element := range subtreeElements(definition.root) {
+			if subtreeID, ok := element.attr("ID"); ok {
+				pending = append(pending, subtreeID)
+			}
+		}
+	}
+	return result
+}
+
+// checkRecursion reports the SubTree elements closing a cycle of subtrees
+func (v *validator) checkRecursion(ids []string) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+
+	var visit func(id string, stack []string)
+	visit = func(id string, stack []string) {
+		state[id] = visiting
+		stack = append(stack, id)
+		v.treeID = id
+		for _, element := range subtreeElements(v.parser.trees[id].root) {
+			subtreeID, _ := element.attr("ID")
+			if _, exists := v.parser.trees[subtreeID]; !exists {
+				continue
+			}
+			switch state[subtreeID] {
+			case visiting:
+				v.treeID = id
+				v.report(SeverityError, element, "recursive subtree '%s': %s", subtreeID, strings.Join(append(stack, subtreeID), " -> "))
+			case unvisited:
+				visit(subtreeID, stack)
+			}
+		}
+		state[id] = done
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id, nil)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package behavior_tree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+const lintXML = `<root BTCPP_format="4" main_tree_to_execute="Main">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <Inverter />
+      <Fallback />
+      <Patrol />
+      <Delay><AlwaysSuccess/></Delay>
+      <Script code="hp := 10" />
+      <Sleep msec="{hp}" />
+      <IsRaining raining="{flag}" />
+      <Repeat num_cycles="{flag}"><AlwaysSuccess/></Repeat>
+      <Switch switch="Run"><AlwaysSuccess name="Walk"/></Switch>
+      <SubTree ID="Loop" />
+      <Sleep msec="{@weather}" />
+    </Sequence>
+  </BehaviorTree>
+
+  <BehaviorTree ID="Loop">
+    <Sequence>
+      <AlwaysSuccess><AlwaysFailure/></AlwaysSuccess>
+      <SubTree ID="Loop" />
+    </Sequence>
+  </BehaviorTree>
+
+  <BehaviorTree ID="Orphan">
+    <AlwaysSuccess />
+  </BehaviorTree>
+</root>`
+
+func TestXMLParser_Validate(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	err := factory.RegisterSimpleCondition("IsRaining", func(node core.Node) core.NodeStatus {
+		return core.NodeStatusSuccess
+	}, core.PortsList{"raining": core.OutputPort("bool", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewXMLParser(factory)
+	world := core.NewBlackboard()
+	world.Set("weather", true)
+	parser.SetWorldBlackboard(world)
+	if err := parser.RegisterFromText(lintXML); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		severity Severity
+		line     int
+		want     string
+	}{
+		{SeverityError, 4, "decorator 'Inverter' must have exactly one child, found 0"},
+		{SeverityError, 5, "control 'Fallback' has no children"},
+		{SeverityError, 6, "unknown node 'Patrol'"},
+		{SeverityError, 7, "missing required input port 'delay_msec'"},
+		{SeverityError, 11, "uses entry 'flag' as int, but port 'raining' at <text>:10 uses it as bool"},
+		{SeverityError, 12, "Switch case 'Run' matches no child"},
+		{SeverityError, 14, "the world blackboard stores bool"},
+		{SeverityError, 20, "action 'AlwaysSuccess' can't have children"},
+		{SeverityError, 21, "recursive subtree 'Loop': Loop -> Loop"},
+		{SeverityWarning, 25, "tree 'Orphan' is never used"},
+	}
+	diagnostics := parser.Validate()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %d:\n%s", len(expected), len(diagnostics), (&ValidationError{diagnostics}).Error())
+	}
+	for i, e := range expected {
+		d := diagnostics[i]
+		if d.Severity != e.severity || d.Line != e.line || !strings.Contains(d.Message, e.want) {
+			t.Errorf("expected %s at line %d %q, got %s", e.severity, e.line, e.want, d)
+		}
+	}
+
+	// Every tree is used when it is a root
+	for _, d := range parser.Validate("Main", "Orphan") {
+		if d.Severity == SeverityWarning {
+			t.Errorf("unexpected warning %s", d)
+		}
+	}
+}
+
+func TestXMLParser_ValidateRequiredPorts(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	err := factory.RegisterSimpleAction("Attack", func(node core.Node) core.NodeStatus {
+		return core.NodeStatusSuccess
+	}, core.PortsList{
+		"target": core.InputPort("string", "").AsRequired(),
+		"weapon": core.InputPort("string", ""),
+		"hits":   core.InOutPort("int", ""),
+		"killed": core.OutputPort("bool", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewXMLParser(factory)
+	err = parser.RegisterFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <Attack target="orc" />
+      <Attack />
+      <Precondition code="true"><AlwaysSuccess/></Precondition>
+      <Precondition else="SUCCESS"><AlwaysSuccess/></Precondition>
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := parser.Validate()
+	if len(diagnostics) != 2 ||
+		diagnostics[0].Line != 5 || !strings.Contains(diagnostics[0].Message, "missing required input port 'target'") ||
+		diagnostics[1].Line != 7 || !strings.Contains(diagnostics[1].Message, "missing required input port 'if'") {
+		t.Fatalf("unexpected diagnostics:\n%s", (&ValidationError{diagnostics}).Error())
+	}
+}
+
+func TestXMLParser_ValidateOnLoad(t *testing.T) {
+	factory := NewBehaviorTreeFactory()
+	err := factory.RegisterBehaviorTreeFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Good">
+    <Sequence>
+      <Script code="index := 1" />
+      <Repeat num_cycles="{index}"><AlwaysSuccess/></Repeat>
+    </Sequence>
+  </BehaviorTree>
+  <BehaviorTree ID="Bad">
+    <Sequence>
+      <SubTree ID="Good" />
+      <Timeout><AlwaysSuccess/></Timeout>
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without validation the missing port panics when the tree is ticked
+	if _, err := factory.CreateTree("Bad", nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	factory.SetValidateOnLoad(true)
+	_, err = factory.CreateTree("Bad", nil)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Diagnostics) != 1 || validationErr.Diagnostics[0].Line != 11 {
+		t.Fatalf("expected one error at line 11, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "<text>:11: error: missing required input port 'msec'") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	tree, err := factory.CreateTree("Good", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+	if diagnostics := factory.ValidateBehaviorTrees("Bad"); len(diagnostics) != 1 {
+		t.Fatalf("expected one diagnostic, got %v", diagnostics)
+	}
+}
@@ -1,212 +1,892 @@
 package behavior_tree
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/decorators"
+	"github.com/actfuns/gamekit/behavior_tree/scripting"
 )
 
-// XMLParser is used to parse behavior tree XML files
+// XMLParser loads behavior trees written in the BehaviorTree.CPP v4 XML format.
+// Tree definitions from several files can be registered and instantiated by
+// ID; a subtree registered from one file can be used by the trees of another.
+// Trees can be instantiated concurrently.
 type XMLParser struct {
-	factory *BehaviorTreeFactory
+	factory  *BehaviorTreeFactory
+	mutex    sync.RWMutex
+	trees    map[string]*treeDefinition
+	models   map[string]core.TreeNodeManifest
+	mainTree string
+	// loaded tells the files registered, false while a file is being loaded
+	// so that include cycles end
+	loaded  map[string]bool
+	sources int
+	world   *core.Blackboard
+	// validateOnLoad makes InstantiateTree and CompileTree validate the tree first
+	validateOnLoad bool
 }
 
 // NewXMLParser creates a new XML parser
 func NewXMLParser(factory *BehaviorTreeFactory) *XMLParser {
 	return &XMLParser{
 		factory: factory,
+		trees:   make(map[string]*treeDefinition),
+		models:  make(map[string]core.TreeNodeManifest),
+		loaded:  make(map[string]bool),
 	}
 }
 
-// BehaviorTreeXML represents the root of a behavior tree XML
-type BehaviorTreeXML struct {
-	XMLName  xml.Name  `xml:"root"`
-	MainTree string    `xml:"main_tree_to_execute,attr"`
-	Trees    []TreeXML `xml:"BehaviorTree"`
+// ParseError is an error located in an XML file
+type ParseError struct {
+	File    string
+	Line    int
+	Message string
 }
 
-// TreeXML represents a single behavior tree in XML
-type TreeXML struct {
-	XMLName xml.Name `xml:"BehaviorTree"`
-	ID      string   `xml:"ID,attr"`
-	Root    NodeXML  `xml:",any"`
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", sourceLocation(e.File, e.Line), e.Message)
 }
 
-// NodeXML represents a node in XML
-type NodeXML struct {
-	XMLName  xml.Name
-	Attrs    []xml.Attr `xml:",any,attr"`
-	Children []NodeXML  `xml:",any"`
+// sourceLocation formats a position as "file:line", naming "<text>" the
+// documents registered from a string
+func sourceLocation(file string, line int) string {
+	if file == "" {
+		file = "<text>"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+// treeDefinition is a parsed <BehaviorTree> element
+type treeDefinition struct {
+	id   string
+	root *xmlElement
+	file string
+	line int
+}
+
+// xmlElement is a generic XML element with its position in the source
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlElement
+	text     string
+	file     string
+	line     int
 }
 
-// LoadFromFile loads a behavior tree from an XML file
+// attr returns the value of an attribute
+func (e *xmlElement) attr(name string) (string, bool) {
+	for _, a := range e.attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// errorf creates a ParseError located at the element
+func (e *xmlElement) errorf(format string, args ...interface{}) error {
+	return &ParseError{File: e.file, Line: e.line, Message: fmt.Sprintf(format, args...)}
+}
+
+// LoadFromFile registers the trees of an XML file and instantiates its main tree
 func (p *XMLParser) LoadFromFile(filename string) (*BehaviorTree, error) {
-	data, err := ioutil.ReadFile(filename)
+	if err := p.RegisterFromFile(filename); err != nil {
+		return nil, err
+	}
+	return p.InstantiateTree(p.MainTreeID(), nil)
+}
+
+// LoadFromText registers the trees of an XML string and instantiates its main tree
+func (p *XMLParser) LoadFromText(text string) (*BehaviorTree, error) {
+	if err := p.RegisterFromText(text); err != nil {
+		return nil, err
+	}
+	return p.InstantiateTree(p.MainTreeID(), nil)
+}
+
+// SetWorldBlackboard shares world between the trees instantiated afterwards.
+// Each tree gets its own blackboard whose parent is world, so that nodes
+// read world entries and write them with the '@' prefix, e.g. "{@weather}".
+func (p *XMLParser) SetWorldBlackboard(world *core.Blackboard) {
+	p.world = world
+}
+
+// WorldBlackboard returns the blackboard shared between trees, or nil
+func (p *XMLParser) WorldBlackboard() *core.Blackboard {
+	return p.world
+}
+
+// RegisterFromFile registers every tree definition found in an XML file and its includes
+func (p *XMLParser) RegisterFromFile(filename string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	state := p.snapshot()
+	if err := p.loadFile(osSource{}, filename, false); err != nil {
+		p.restore(state)
+		return err
+	}
+	return nil
+}
+
+// RegisterFromText registers every tree definition found in an XML string.
+// Relative include paths are resolved from the working directory.
+func (p *XMLParser) RegisterFromText(text string) error {
+	root, err := readXML(strings.NewReader(text), "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %v", filename, err)
+		return err
 	}
 
-	var btXML BehaviorTreeXML
-	if err := xml.Unmarshal(data, &btXML); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %v", err)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	state := p.snapshot()
+	if err := p.loadDocument(osSource{}, root, ".", false); err != nil {
+		p.restore(state)
+		return err
 	}
+	return nil
+}
 
-	// Find the main tree
-	var mainTree *TreeXML
-	for i := range btXML.Trees {
-		if btXML.Trees[i].ID == btXML.MainTree {
-			mainTree = &btXML.Trees[i]
-			break
+// RegisterFromFS registers every tree definition found in the files of fsys
+// matching the patterns, see fs.Glob, e.g. "trees/*.xml". Include paths are
+// resolved in fsys. It is meant for trees embedded with go:embed.
+func (p *XMLParser) RegisterFromFS(fsys fs.FS, patterns ...string) error {
+	var names []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no file matches %s", pattern)
 		}
+		names = append(names, matches...)
 	}
 
-	if mainTree == nil {
-		return nil, fmt.Errorf("main tree '%s' not found", btXML.MainTree)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.sources++
+	source := fsSource{fsys: fsys, id: p.sources}
+	state := p.snapshot()
+	for _, name := range names {
+		if err := p.loadFile(source, name, false); err != nil {
+			p.restore(state)
+			return err
+		}
+	}
+	return nil
+}
+
+// parserState is the registration state of a parser, restored when a
+// registration fails so that none of its trees or models remain
+type parserState struct {
+	trees    map[string]*treeDefinition
+	models   map[string]core.TreeNodeManifest
+	mainTree string
+	loaded   map[string]bool
+}
+
+// snapshot saves the registration state. The caller must hold the mutex.
+func (p *XMLParser) snapshot() parserState {
+	return parserState{
+		trees:    maps.Clone(p.trees),
+		models:   maps.Clone(p.models),
+		mainTree: p.mainTree,
+		loaded:   maps.Clone(p.loaded),
+	}
+}
+
+// restore rolls back to a saved registration state. The caller must hold
+// the mutex.
+func (p *XMLParser) restore(state parserState) {
+	p.trees = state.trees
+	p.models = state.models
+	p.mainTree = state.mainTree
+	p.loaded = state.loaded
+}
+
+// Clear removes the registered tree definitions and node models, so that
+// files can be registered again
+func (p *XMLParser) Clear() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.trees = make(map[string]*treeDefinition)
+	p.models = make(map[string]core.TreeNodeManifest)
+	p.mainTree = ""
+	p.loaded = make(map[string]bool)
+}
+
+// MainTreeID returns the main_tree_to_execute of the loaded files, or the
+// only registered tree when there is exactly one
+func (p *XMLParser) MainTreeID() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.mainTree != "" {
+		return p.mainTree
+	}
+	if len(p.trees) == 1 {
+		for id := range p.trees {
+			return id
+		}
+	}
+	return ""
+}
+
+// RegisteredTrees returns the sorted IDs of all registered tree definitions
+func (p *XMLParser) RegisteredTrees() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.registeredTrees()
+}
+
+// registeredTrees returns the sorted tree IDs. The caller must hold the mutex.
+func (p *XMLParser) registeredTrees() []string {
+	ids := make([]string, 0, len(p.trees))
+	for id := range p.trees {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// InstantiateTree creates a new instance of a registered tree. A nil
+// blackboard creates a new one, child of the world blackboard if set.
+// Every SubTree instance gets its own blackboard, child of its parent's.
+func (p *XMLParser) InstantiateTree(treeID string, blackboard *core.Blackboard) (*BehaviorTree, error) {
+	if treeID == "" {
+		return nil, fmt.Errorf("no main tree: set main_tree_to_execute or pass a tree ID")
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	definition, exists := p.trees[treeID]
+	if !exists {
+		return nil, fmt.Errorf("tree '%s' not found", treeID)
+	}
+	if p.validateOnLoad {
+		if diagnostics := p.validateTree(treeID); HasErrors(diagnostics) {
+			return nil, &ValidationError{Diagnostics: diagnostics}
+		}
+	}
+	template, err := p.compileTree(treeID, definition)
+	if err != nil {
+		return nil, err
 	}
+	return template.Instantiate(blackboard)
+}
 
-	// Create blackboard
-	blackboard := NewBlackboard()
+// CompileTree compiles a registered tree, and the subtrees it uses, into a
+// template whose instances share the immutable part of their nodes. It is
+// the fast way to create many instances of a tree; templates are not
+// affected by the definitions registered afterwards.
+func (p *XMLParser) CompileTree(treeID string) (*TreeTemplate, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	definition, exists := p.trees[treeID]
+	if !exists {
+		return nil, fmt.Errorf("tree '%s' not found", treeID)
+	}
+	if p.validateOnLoad {
+		if diagnostics := p.validateTree(treeID); HasErrors(diagnostics) {
+			return nil, &ValidationError{Diagnostics: diagnostics}
+		}
+	}
+	template, err := p.compileTree(treeID, definition)
+	if err != nil {
+		return nil, err
+	}
+	// Constructors check their ports: create a first instance to report
+	// the errors now, and keep it for Acquire
+	instance, err := template.newInstance(nil)
+	if err != nil {
+		return nil, err
+	}
+	template.pool.Put(instance)
+	return template, nil
+}
 
-	// Parse the root node
-	rootNode, err := p.parseNode(mainTree.Root, blackboard)
+// compileTree compiles a tree definition. The caller must hold the mutex.
+func (p *XMLParser) compileTree(treeID string, definition *treeDefinition) (*TreeTemplate, error) {
+	b := &treeBuilder{parser: p, enums: p.factory.ScriptingEnums(), subtreeStack: []string{treeID}}
+	root, err := b.compileNode(definition.root, "")
 	if err != nil {
 		return nil, err
 	}
+	return &TreeTemplate{id: treeID, root: root, world: p.world}, nil
+}
+
+// xmlSource reads the XML files and resolves the include paths
+type xmlSource interface {
+	// key identifies a file to load it once
+	key(name string) (string, error)
+	readFile(name string) ([]byte, error)
+	dir(name string) string
+	join(dir, name string) string
+}
+
+// osSource reads files from the operating system
+type osSource struct{}
+
+func (osSource) key(name string) (string, error) {
+	return filepath.Abs(name)
+}
+
+func (osSource) readFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osSource) dir(name string) string {
+	return filepath.Dir(name)
+}
+
+func (osSource) join(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// fsSource reads files from a fs.FS, id tells apart the registered file systems
+type fsSource struct {
+	fsys fs.FS
+	id   int
+}
+
+func (s fsSource) key(name string) (string, error) {
+	return fmt.Sprintf("fs%d:%s", s.id, path.Clean(name)), nil
+}
+
+func (s fsSource) readFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
 
-	return NewBehaviorTree(rootNode, blackboard, p.factory), nil
+func (fsSource) dir(name string) string {
+	return path.Dir(name)
 }
 
-// parseNode recursively parses a node from XML
-func (p *XMLParser) parseNode(nodeXML NodeXML, blackboard *core.Blackboard) (core.TreeNode, error) {
-	nodeName := nodeXML.XMLName.Local
+func (fsSource) join(dir, name string) string {
+	return path.Join(dir, name)
+}
 
-	// Extract attributes
-	attrs := make(map[string]string)
-	for _, attr := range nodeXML.Attrs {
-		attrs[attr.Name.Local] = attr.Value
+// loadFile reads, parses and registers an XML file once
+func (p *XMLParser) loadFile(source xmlSource, filename string, included bool) error {
+	key, err := source.key(filename)
+	if err != nil {
+		return err
 	}
+	if _, seen := p.loaded[key]; seen {
+		return nil
+	}
+	p.loaded[key] = false
 
-	// Create node config
-	config := NodeConfig{
-		Blackboard: blackboard,
+	data, err := source.readFile(filename)
+	if err != nil {
+		delete(p.loaded, key)
+		return fmt.Errorf("failed to read file %s: %v", filename, err)
 	}
+	root, err := readXML(bytes.NewReader(data), filename)
+	if err == nil {
+		err = p.loadDocument(source, root, source.dir(filename), included)
+	}
+	if err != nil {
+		delete(p.loaded, key)
+		return err
+	}
+	p.loaded[key] = true
+	return nil
+}
 
-	// Check if this is a registered node type
-	if _, exists := p.factory.GetManifest(nodeName); exists {
-		// Create node using factory
-		node, err := p.factory.CreateNode(nodeName, nodeName, config)
-		if err != nil {
-			return nil, err
+// loadDocument registers the content of a parsed <root> element
+func (p *XMLParser) loadDocument(source xmlSource, root *xmlElement, dir string, included bool) error {
+	if root.name != "root" {
+		return root.errorf("the XML must have a <root> element, found <%s>", root.name)
+	}
+	if format, ok := root.attr("BTCPP_format"); ok && format != "4" {
+		return root.errorf("unsupported BTCPP_format '%s', only version 4 is supported", format)
+	}
+	if mainTree, ok := root.attr("main_tree_to_execute"); ok && !included {
+		p.mainTree = mainTree
+	}
+
+	for _, element := range root.children {
+		switch element.name {
+		case "include":
+			includePath, ok := element.attr("path")
+			if !ok || includePath == "" {
+				return element.errorf("<include> requires the attribute 'path'")
+			}
+			if _, ok := element.attr("ros_pkg"); ok {
+				return element.errorf("<include ros_pkg> is not supported")
+			}
+			if err := p.loadFile(source, source.join(dir, includePath), true); err != nil {
+				return err
+			}
+
+		case "BehaviorTree":
+			id, ok := element.attr("ID")
+			if !ok || id == "" {
+				return element.errorf("<BehaviorTree> requires the attribute 'ID'")
+			}
+			if existing, exists := p.trees[id]; exists {
+				return element.errorf("tree '%s' already defined at %s:%d", id, existing.file, existing.line)
+			}
+			if len(element.children) != 1 {
+				return element.errorf("tree '%s' must have exactly one root node, found %d", id, len(element.children))
+			}
+			p.trees[id] = &treeDefinition{id: id, root: element.children[0], file: element.file, line: element.line}
+
+		case "TreeNodesModel":
+			if err := p.loadNodesModel(element); err != nil {
+				return err
+			}
+
+		default:
+			return element.errorf("unexpected element <%s> in <root>", element.name)
 		}
+	}
+	return nil
+}
 
-		// Parse children
-		for _, childXML := range nodeXML.Children {
-			childNode, err := p.parseNode(childXML, blackboard)
-			if err != nil {
-				return nil, err
-			}
-
-			// Add child to the node
-			node.AddChild(childNode)
-		}
-
-		return node, nil
-	}
-
-	// Handle built-in control nodes
-	var treeNode TreeNode
-
-	switch nodeName {
-	case "Sequence":
-		seqNode := NewSequenceNode(nodeName, config)
-		treeNode = seqNode
-	case "ReactiveSequence":
-		rseqNode := NewReactiveSequenceNode(nodeName, config)
-		treeNode = rseqNode
-	case "Fallback":
-		fbkNode := NewFallbackNode(nodeName, config)
-		treeNode = fbkNode
-	case "ReactiveFallback":
-		rfbkNode := NewReactiveFallbackNode(nodeName, config)
-		treeNode = rfbkNode
-	case "Inverter":
-		invNode := NewInverterNode(nodeName, config)
-		treeNode = invNode
-	case "RetryUntilSuccessful":
-		maxAttempts := 3
-		if attemptsStr, exists := attrs["num_attempts"]; exists {
-			// Parse num_attempts (simplified)
-			maxAttempts = parseInt(attemptsStr, 3)
-		}
-		retryNode := NewRetryNode(nodeName, config, maxAttempts)
-		treeNode = retryNode
-	case "Repeat":
-		maxRepetitions := 3
-		if repsStr, exists := attrs["num_cycles"]; exists {
-			maxRepetitions = parseInt(repsStr, 3)
-		}
-		repNode := NewRepeatNode(nodeName, config, maxRepetitions)
-		treeNode = repNode
-	case "Timeout":
-		timeoutMs := int64(1000)
-		if timeoutStr, exists := attrs["msec"]; exists {
-			timeoutMs = parseInt64(timeoutStr, 1000)
-		}
-		timeoutNode := NewTimeoutNode(nodeName, config, timeoutMs)
-		treeNode = timeoutNode
-	default:
-		// Try to create as action node
-		// This is a simplified approach - in real implementation you'd have more sophisticated logic
-		treeNode = NewActionNode(nodeName, config, func() NodeStatus { return NodeStatusSuccess })
-	}
-
-	// Parse children
-	for _, childXML := range nodeXML.Children {
-		childNode, err := p.parseNode(childXML, blackboard)
+// nodeModelTypes maps TreeNodesModel element names to node types
+var nodeModelTypes = map[string]core.NodeType{
+	"Action":    core.NodeTypeAction,
+	"Condition": core.NodeTypeCondition,
+	"Control":   core.NodeTypeControl,
+	"Decorator": core.NodeTypeDecorator,
+	"SubTree":   core.NodeTypeSubtree,
+}
+
+// portModelDirections maps TreeNodesModel port element names to directions
+var portModelDirections = map[string]core.PortDirection{
+	"input_port":  core.PortDirectionInput,
+	"output_port": core.PortDirectionOutput,
+	"inout_port":  core.PortDirectionInOut,
+}
+
+// loadNodesModel reads the port declarations of a <TreeNodesModel>
+func (p *XMLParser) loadNodesModel(model *xmlElement) error {
+	for _, element := range model.children {
+		nodeType, ok := nodeModelTypes[element.name]
+		if !ok {
+			return element.errorf("unexpected element <%s> in <TreeNodesModel>", element.name)
+		}
+		id, ok := element.attr("ID")
+		if !ok || id == "" {
+			return element.errorf("<%s> in <TreeNodesModel> requires the attribute 'ID'", element.name)
+		}
+
+		manifest := core.TreeNodeManifest{
+			Type:           nodeType,
+			RegistrationID: id,
+			Ports:          make(core.PortsList),
+		}
+		for _, portElement := range element.children {
+			if portElement.name == "MetaData" {
+				for _, entry := range portElement.children {
+					manifest.Metadata = append(manifest.Metadata, core.KeyValue{Key: entry.name, Value: strings.TrimSpace(entry.text)})
+				}
+				continue
+			}
+			direction, ok := portModelDirections[portElement.name]
+			if !ok {
+				continue
+			}
+			name, ok := portElement.attr("name")
+			if !ok || name == "" {
+				return portElement.errorf("<%s> requires the attribute 'name'", portElement.name)
+			}
+			port := core.PortInfo{Direction: direction, Description: strings.TrimSpace(portElement.text)}
+			port.TypeName, _ = portElement.attr("type")
+			port.DefaultValue, _ = portElement.attr("default")
+			manifest.Ports[name] = port
+		}
+		p.models[id] = manifest
+	}
+	return nil
+}
+
+// genericNodeTags are the element names that take the registration ID from the ID attribute
+var genericNodeTags = map[string]bool{
+	"Action":    true,
+	"Condition": true,
+	"Control":   true,
+	"Decorator": true,
+}
+
+// treeBuilder compiles one tree into template nodes
+type treeBuilder struct {
+	parser       *XMLParser
+	enums        map[string]int
+	nextUID      uint16
+	subtreeStack []string
+}
+
+// lookupNode finds the manifest and constructor of a registration ID, with
+// the ports of the TreeNodesModel when the registration declares none.
+// The caller must hold the mutex.
+func (p *XMLParser) lookupNode(id string) (core.TreeNodeManifest, TreeNodeCreator, bool) {
+	manifest, creator, registered := p.factory.lookup(id)
+	if !registered {
+		return core.TreeNodeManifest{}, nil, false
+	}
+	if manifest.RegistrationID == "" {
+		manifest.RegistrationID = id
+	}
+
+	if len(manifest.Ports) == 0 {
+		if model, ok := p.models[id]; ok {
+			manifest.Ports = model.Ports
+		}
+	}
+	return manifest, creator, true
+}
+
+// newConfig creates the common part of a node configuration
+func (b *treeBuilder) newConfig(element *xmlElement, name string, pathPrefix string) (core.NodeConfig, error) {
+	b.nextUID++
+	config := core.NodeConfig{
+		Enums:           b.enums,
+		InputPorts:      make(core.PortsRemapping),
+		OutputPorts:     make(core.PortsRemapping),
+		OtherAttributes: make(core.NonPortAttributes),
+		UID:             b.nextUID,
+		Path:            pathPrefix + name,
+	}
+	if value, ok := element.attr("name"); !ok || value == "" {
+		// Unnamed nodes are told apart by their UID
+		config.Path += "::" + strconv.Itoa(int(config.UID))
+	}
+
+	attrs := make(map[string]string, len(element.attrs))
+	for _, a := range element.attrs {
+		attrs[a.Name.Local] = a.Value
+	}
+	if err := parseConditionAttributes(name, attrs, &config); err != nil {
+		return config, element.errorf("%v", err)
+	}
+	return config, nil
+}
+
+// isSpecialAttribute reports attributes that are not ports
+func isSpecialAttribute(name string) bool {
+	if name == "ID" || name == "name" {
+		return true
+	}
+	_, isPre := preConditionAttributes[name]
+	_, isPost := postConditionAttributes[name]
+	return isPre || isPost
+}
+
+// compileNode recursively compiles an element and its children
+func (b *treeBuilder) compileNode(element *xmlElement, pathPrefix string) (*templateNode, error) {
+	if element.name == "SubTree" {
+		return b.compileSubtree(element, pathPrefix)
+	}
+
+	id := element.name
+	if genericNodeTags[id] {
+		var ok bool
+		if id, ok = element.attr("ID"); !ok || id == "" {
+			return nil, element.errorf("<%s> requires the attribute 'ID'", element.name)
+		}
+	}
+
+	name := id
+	if value, ok := element.attr("name"); ok && value != "" {
+		name = value
+	}
+
+	config, err := b.newConfig(element, name, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, creator, registered := b.parser.lookupNode(id)
+	rule, substituted := b.parser.factory.substitute(name, config.Path, len(element.children) == 0)
+	if !registered && !substituted {
+		return nil, element.errorf("unknown node '%s'", id)
+	}
+	if substituted {
+		// The replacement takes the ports of the node it replaces; unregistered
+		// nodes, e.g. unavailable in tests, accept any port
+		if creator, err = b.parser.factory.substituteCreator(rule); err != nil {
+			return nil, element.errorf("can't substitute node '%s': %v", name, err)
+		}
+		if !registered {
+			manifest = core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: id}
+		}
+	}
+	config.Manifest = manifest
+
+	for _, a := range element.attrs {
+		attrName := a.Name.Local
+		if isSpecialAttribute(attrName) {
+			continue
+		}
+
+		port, declared := manifest.Ports[attrName]
+		switch {
+		case declared:
+		case strings.HasPrefix(attrName, "_"):
+			config.OtherAttributes[attrName] = a.Value
+			continue
+		case len(manifest.Ports) == 0:
+			// Nodes that declare no ports accept any attribute as an input port
+			port = core.PortInfo{Direction: core.PortDirectionInput}
+		default:
+			return nil, element.errorf("port '%s' is not declared by node '%s'", attrName, id)
+		}
+
+		if port.Direction != core.PortDirectionInput {
+			config.OutputPorts[attrName] = a.Value
+		}
+		if port.Direction != core.PortDirectionOutput {
+			if err := checkLiteral(port, a.Value); err != nil {
+				return nil, element.errorf("port '%s' of node '%s': %v", attrName, id, err)
+			}
+			config.InputPorts[attrName] = a.Value
+		}
+	}
+
+	// Apply default values of unassigned ports
+	for portName, port := range manifest.Ports {
+		if port.DefaultValue == "" {
+			continue
+		}
+		if _, set := config.InputPorts[portName]; !set && port.Direction != core.PortDirectionOutput {
+			config.InputPorts[portName] = port.DefaultValue
+		}
+		if _, set := config.OutputPorts[portName]; !set && port.Direction != core.PortDirectionInput {
+			config.OutputPorts[portName] = port.DefaultValue
+		}
+	}
+
+	node := &templateNode{
+		element:    element,
+		id:         id,
+		creator:    creator,
+		definition: core.NewNodeDefinition(name, config),
+	}
+	for _, childElement := range element.children {
+		child, err := b.compileNode(childElement, config.Path+"/")
 		if err != nil {
 			return nil, err
 		}
-		treeNode.AddChild(childNode)
+		node.children = append(node.children, child)
 	}
+	return node, nil
+}
 
-	return treeNode, nil
+// checkLiteral verifies that a literal port value converts to the declared
+// port type, so that typos are reported when the tree is loaded
+func checkLiteral(port core.PortInfo, value string) error {
+	if _, isPointer := core.StripBlackboardPointer(value); isPointer {
+		return nil
+	}
+	t, known := core.ConverterType(port.TypeName)
+	if !known {
+		return nil
+	}
+	_, err := core.ConvertFromString(value, t)
+	return err
 }
 
-// parseInt parses a string to int with default fallback
-func parseInt(s string, defaultValue int) int {
-	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
-		// This is a port reference, use default
-		return defaultValue
+// compileSubtree compiles a <SubTree>, whose instances get their own blackboard
+func (b *treeBuilder) compileSubtree(element *xmlElement, pathPrefix string) (*templateNode, error) {
+	id, ok := element.attr("ID")
+	if !ok || id == "" {
+		return nil, element.errorf("<SubTree> requires the attribute 'ID'")
+	}
+	definition, exists := b.parser.trees[id]
+	if !exists {
+		return nil, element.errorf("subtree '%s' not found", id)
+	}
+	for _, ancestor := range b.subtreeStack {
+		if ancestor == id {
+			return nil, element.errorf("recursive subtree '%s': %s", id, strings.Join(append(b.subtreeStack, id), " -> "))
+		}
+	}
+
+	name := id
+	if value, ok := element.attr("name"); ok && value != "" {
+		name = value
+	}
+
+	config, err := b.newConfig(element, name, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	config.Manifest = core.TreeNodeManifest{
+		Type:           core.NodeTypeSubtree,
+		RegistrationID: id,
+		Ports:          new(decorators.SubtreeNode).ProvidedPorts(),
+	}
+
+	scope := &subtreeScope{remapping: make(map[string]string), values: make(map[string]string)}
+	for _, a := range element.attrs {
+		attrName := a.Name.Local
+		if isSpecialAttribute(attrName) {
+			continue
+		}
+		config.InputPorts[attrName] = a.Value
+
+		if attrName == "_autoremap" {
+			autoRemap, err := strconv.ParseBool(a.Value)
+			if err != nil {
+				return nil, element.errorf("invalid _autoremap value '%s'", a.Value)
+			}
+			scope.autoRemap = autoRemap
+			continue
+		}
+
+		if key, isPointer := core.StripBlackboardPointer(a.Value); isPointer {
+			if key == "=" {
+				key = attrName
+			}
+			scope.remapping[attrName] = key
+		} else {
+			scope.values[attrName] = a.Value
+		}
+	}
+
+	node := &templateNode{
+		element: element,
+		id:      id,
+		creator: func(name string, config core.NodeConfig) (core.Node, error) {
+			return decorators.NewSubtreeNode(name, config), nil
+		},
+		definition: core.NewNodeDefinition(name, config),
+		subtree:    scope,
+	}
+
+	b.subtreeStack = append(b.subtreeStack, id)
+	child, err := b.compileNode(definition.root, config.Path+"/")
+	b.subtreeStack = b.subtreeStack[:len(b.subtreeStack)-1]
+	if err != nil {
+		return nil, err
 	}
+	node.children = []*templateNode{child}
+	return node, nil
+}
 
-	// Simplified parsing - in real implementation you'd use strconv
-	switch s {
-	case "1":
-		return 1
-	case "2":
-		return 2
-	case "3":
-		return 3
+// createNode calls a constructor, converting panics into errors
+func createNode(creator TreeNodeCreator, name string, config core.NodeConfig) (node core.Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			node, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+
+	node, err = creator(name, config)
+	if err == nil && node == nil {
+		err = errors.New("constructor returned nil")
 	}
-	return defaultValue
+	return node, err
 }
 
-// parseInt64 parses a string to int64 with default fallback
-func parseInt64(s string, defaultValue int64) int64 {
-	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
-		// This is a port reference, use default
-		return defaultValue
+// readXML parses a document into an element tree, recording line numbers
+func readXML(r io.Reader, file string) (*xmlElement, error) {
+	decoder := xml.NewDecoder(r)
+	var root *xmlElement
+	var stack []*xmlElement
+
+	for {
+		line, _ := decoder.InputPos()
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, &ParseError{File: file, Line: syntaxErr.Line, Message: syntaxErr.Msg}
+			}
+			return nil, &ParseError{File: file, Line: line, Message: err.Error()}
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: t.Name.Local, attrs: t.Attr, file: file, line: line}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			} else if root == nil {
+				root = element
+			} else {
+				return nil, element.errorf("multiple root elements")
+			}
+			stack = append(stack, element)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, &ParseError{File: file, Line: 1, Message: "empty XML document"}
 	}
+	return root, nil
+}
+
+// preConditionAttributes maps XML attribute names to pre-conditions
+var preConditionAttributes = map[string]core.PreCond{
+	core.PreCondFailureIf.String(): core.PreCondFailureIf,
+	core.PreCondSuccessIf.String(): core.PreCondSuccessIf,
+	core.PreCondSkipIf.String():    core.PreCondSkipIf,
+	core.PreCondWhileTrue.String(): core.PreCondWhileTrue,
+}
+
+// postConditionAttributes maps XML attribute names to post-conditions
+var postConditionAttributes = map[string]core.PostCond{
+	core.PostCondOnHalted.String():  core.PostCondOnHalted,
+	core.PostCondOnFailure.String(): core.PostCondOnFailure,
+	core.PostCondOnSuccess.String(): core.PostCondOnSuccess,
+	core.PostCondAlways.String():    core.PostCondAlways,
+}
 
-	// Simplified parsing
-	switch s {
-	case "1000":
-		return 1000
-	case "2000":
-		return 2000
+// parseConditionAttributes moves the underscore prefixed condition attributes
+// into config, validating their scripts
+func parseConditionAttributes(nodeName string, attrs map[string]string, config *core.NodeConfig) error {
+	for attr, code := range attrs {
+		preCond, isPre := preConditionAttributes[attr]
+		postCond, isPost := postConditionAttributes[attr]
+		if !isPre && !isPost {
+			continue
+		}
+
+		if _, err := scripting.Parse(code); err != nil {
+			return fmt.Errorf("invalid %s in node '%s': %v", attr, nodeName, err)
+		}
+
+		if isPre {
+			if config.PreConditions == nil {
+				config.PreConditions = make(map[core.PreCond]string)
+			}
+			config.PreConditions[preCond] = code
+		} else {
+			if config.PostConditions == nil {
+				config.PostConditions = make(map[core.PostCond]string)
+			}
+			config.PostConditions[postCond] = code
+		}
 	}
-	return defaultValue
+	return nil
 }
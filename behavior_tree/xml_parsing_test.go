@@ -0,0 +1,317 @@
+package behavior_tree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+const subtreeXML = `<?xml version="1.0"?>
+<root BTCPP_format="4" main_tree_to_execute="MainTree">
+  <BehaviorTree ID="MainTree">
+    <Sequence>
+      <Script code="target := 'castle'; count := 0" />
+      <SubTree ID="Walk" destination="{target}" speed="3" />
+      <SubTree ID="Count" _autoremap="true" />
+      <SubTree ID="Count" _autoremap="true" />
+      <Repeat num_cycles="12">
+        <Script code="count += 1" />
+      </Repeat>
+    </Sequence>
+  </BehaviorTree>
+
+  <BehaviorTree ID="Walk">
+    <Sequence>
+      <ScriptCondition code="destination == 'castle' &amp;&amp; speed == '3'" />
+      <Script code="destination := 'town'; local := 1" />
+    </Sequence>
+  </BehaviorTree>
+
+  <BehaviorTree ID="Count">
+    <Script code="count += 100; _private := 1" />
+  </BehaviorTree>
+</root>`
+
+func TestXMLParser_SubtreeRemapping(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	tree, err := parser.LoadFromText(subtreeXML)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	// Repeat yields RUNNING between cycles and wakes up the tree
+	status := tree.Tick()
+	for status == core.NodeStatusRunning && tree.Sleep(0) {
+		status = tree.Tick()
+	}
+	if status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+
+	bb := tree.Blackboard()
+	if target, _ := bb.Get("target"); target != "town" {
+		t.Fatalf("expected remapped write to reach parent, got %v", target)
+	}
+	if count, _ := bb.Get("count"); count != 212 {
+		t.Fatalf("expected count 212, got %v", count)
+	}
+	for _, key := range []string{"local", "destination", "speed", "_private"} {
+		if bb.HasKey(key) {
+			t.Fatalf("subtree key '%s' leaked into the parent blackboard", key)
+		}
+	}
+
+	if got := parser.RegisteredTrees(); strings.Join(got, ",") != "Count,MainTree,Walk" {
+		t.Fatalf("unexpected registered trees %v", got)
+	}
+}
+
+func TestXMLParser_IncludeAndModel(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "sub", "shared.xml"), `<root BTCPP_format="4">
+  <BehaviorTree ID="Shared">
+    <Action ID="Attack" damage="5" result="{hit}" />
+  </BehaviorTree>
+</root>`)
+	writeFile(t, filepath.Join(dir, "main.xml"), `<root BTCPP_format="4" main_tree_to_execute="Main">
+  <include path="sub/shared.xml" />
+  <TreeNodesModel>
+    <Action ID="Attack">
+      <input_port name="damage" type="int">damage dealt</input_port>
+      <output_port name="result" type="bool" />
+    </Action>
+  </TreeNodesModel>
+  <BehaviorTree ID="Main">
+    <SubTree ID="Shared" hit="{attack_hit}" />
+  </BehaviorTree>
+</root>`)
+
+	factory := NewBehaviorTreeFactory()
+	var attackConfig core.NodeConfig
+	err := factory.RegisterBuilder("Attack", core.TreeNodeManifest{Type: core.NodeTypeAction, RegistrationID: "Attack"},
+		func(name string, config core.NodeConfig) (core.Node, error) {
+			attackConfig = config
+			node := core.NewActionNode(name, config, nil)
+			return &node, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewXMLParser(factory).LoadFromFile(filepath.Join(dir, "main.xml"))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if tree.Tick() != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS")
+	}
+	if attackConfig.InputPorts["damage"] != "5" || attackConfig.OutputPorts["result"] != "{hit}" {
+		t.Fatalf("ports not assigned from the model: in=%v out=%v", attackConfig.InputPorts, attackConfig.OutputPorts)
+	}
+	if _, isInput := attackConfig.InputPorts["result"]; isInput {
+		t.Fatalf("output port registered as input")
+	}
+}
+
+func TestXMLParser_FailedLoadRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.xml")
+	writeFile(t, shared, `<root BTCPP_format="4">
+  <BehaviorTree ID="Shared"><AlwaysSuccess /></BehaviorTree>
+</root>`)
+	main := filepath.Join(dir, "main.xml")
+	writeFile(t, main, `<root BTCPP_format="4" main_tree_to_execute="Main">
+  <include path="shared.xml" />
+  <BehaviorTree ID="Main"><SubTree ID="Shared" /></BehaviorTree>
+  <BehaviorTree ID="Broken" />
+</root>`)
+
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	if err := parser.RegisterFromFile(main); err == nil {
+		t.Fatalf("expected an error loading a tree without root node")
+	}
+	if trees := parser.RegisteredTrees(); len(trees) != 0 || parser.MainTreeID() != "" {
+		t.Fatalf("expected the registrations to be rolled back, got %v", trees)
+	}
+
+	// Once fixed, the file and its include are loaded again
+	writeFile(t, main, `<root BTCPP_format="4" main_tree_to_execute="Main">
+  <include path="shared.xml" />
+  <BehaviorTree ID="Main"><SubTree ID="Shared" /></BehaviorTree>
+</root>`)
+	tree, err := parser.LoadFromFile(main)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+}
+
+func TestXMLParser_Errors(t *testing.T) {
+	cases := []struct {
+		xml  string
+		line int
+		want string
+	}{
+		{`<root BTCPP_format="4">
+  <BehaviorTree ID="A">
+    <Sequence>
+      <DoesNotExist />
+    </Sequence>
+  </BehaviorTree>
+</root>`, 4, "unknown node 'DoesNotExist'"},
+		{`<root BTCPP_format="3"><BehaviorTree ID="A"><AlwaysSuccess/></BehaviorTree></root>`, 1, "unsupported BTCPP_format"},
+		{`<root main_tree_to_execute="A">
+  <BehaviorTree ID="A"><SubTree ID="B"/></BehaviorTree>
+  <BehaviorTree ID="B"><SubTree ID="A"/></BehaviorTree>
+</root>`, 3, "recursive subtree"},
+		{`<root>
+  <BehaviorTree ID="A">
+    <Sleep msec="10" duration="5" />
+  </BehaviorTree>
+</root>`, 3, "port 'duration' is not declared"},
+		{`<root>
+  <BehaviorTree ID="A">
+    <AlwaysSuccess _skipIf="a +" />
+  </BehaviorTree>
+</root>`, 3, "invalid _skipIf"},
+		{`<root>
+  <BehaviorTree ID="A">
+    <Sequence>
+  </BehaviorTree>
+</root>`, 4, "element <Sequence> closed by </BehaviorTree>"},
+		{`<root>
+  <BehaviorTree ID="A">
+    <Repeat num_cycles="three"><AlwaysSuccess/></Repeat>
+  </BehaviorTree>
+</root>`, 3, "port 'num_cycles' of node 'Repeat'"},
+	}
+
+	for _, c := range cases {
+		_, err := NewXMLParser(NewBehaviorTreeFactory()).LoadFromText(c.xml)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("expected ParseError containing %q, got %v", c.want, err)
+		}
+		if parseErr.Line != c.line || !strings.Contains(parseErr.Message, c.want) {
+			t.Fatalf("expected line %d %q, got %v", c.line, c.want, err)
+		}
+	}
+}
+
+func TestXMLParser_PreConditions(t *testing.T) {
+	tree, err := NewXMLParser(NewBehaviorTreeFactory()).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <Sequence>
+      <Script code="hp := 3; ran := false" />
+      <AlwaysFailure _skipIf="hp &lt; 5" />
+      <AlwaysSuccess _onSuccess="ran = true" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+	if ran, _ := tree.Blackboard().Get("ran"); ran != true {
+		t.Fatalf("expected _onSuccess to run")
+	}
+}
+
+func TestXMLParser_ReactiveFallbackPreConditions(t *testing.T) {
+	tree, err := NewXMLParser(NewBehaviorTreeFactory()).LoadFromText(`<root BTCPP_format="4">
+  <BehaviorTree ID="Main">
+    <ReactiveFallback>
+      <AlwaysFailure _skipIf="stunned" />
+      <AlwaysSuccess _skipIf="stunned" _onSuccess="fled = true" />
+    </ReactiveFallback>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	tree.Blackboard().Set("stunned", true)
+	tree.Blackboard().Set("fled", false)
+	if status := tree.Tick(); status != core.NodeStatusSkipped {
+		t.Fatalf("expected SKIPPED with every child skipped, got %s", status)
+	}
+	tree.Blackboard().Set("stunned", false)
+	if status := tree.Tick(); status != core.NodeStatusSuccess {
+		t.Fatalf("expected SUCCESS, got %s", status)
+	}
+	if fled, _ := tree.Blackboard().Get("fled"); fled != true {
+		t.Fatalf("expected _onSuccess to run")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXMLParser_WorldBlackboard(t *testing.T) {
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	world := core.NewBlackboard()
+	world.Set("spawned", 0)
+	parser.SetWorldBlackboard(world)
+
+	err := parser.RegisterFromText(`<root BTCPP_format="4" main_tree_to_execute="NPC">
+  <BehaviorTree ID="NPC">
+    <Sequence>
+      <Script code="@spawned += 1; id := @spawned" />
+      <SubTree ID="Think" name="first" />
+      <SubTree ID="Think" name="second" />
+      <SetBlackboard value="{id}" output_key="{@last}" />
+    </Sequence>
+  </BehaviorTree>
+  <BehaviorTree ID="Think">
+    <Sequence>
+      <ScriptCondition code="@spawned &gt; 0" />
+      <Script code="local := 'mine'; @thoughts := 1" />
+    </Sequence>
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trees []*BehaviorTree
+	for i := 0; i < 2; i++ {
+		tree, err := parser.InstantiateTree(parser.MainTreeID(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := tree.Tick(); status != core.NodeStatusSuccess {
+			t.Fatalf("expected SUCCESS, got %s", status)
+		}
+		trees = append(trees, tree)
+	}
+
+	if v, _ := world.Get("spawned"); v != 2 {
+		t.Fatalf("expected spawned=2, got %v", v)
+	}
+	if v, _ := world.Get("last"); v != 2 {
+		t.Fatalf("expected last=2, got %v", v)
+	}
+	if v, _ := trees[0].Blackboard().Get("id"); v != 1 {
+		t.Fatalf("expected the first tree id=1, got %v", v)
+	}
+	if world.HasKey("local") || trees[0].Blackboard().HasKey("local") {
+		t.Fatalf("subtree local leaked out of the subtree")
+	}
+	if !world.HasKey("thoughts") {
+		t.Fatalf("'@' key not written to the world blackboard")
+	}
+}
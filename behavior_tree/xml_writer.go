@@ -0,0 +1,299 @@
+package behavior_tree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+	"github.com/actfuns/gamekit/behavior_tree/decorators"
+)
+
+// DefaultTreeID is the ID written for trees that were not instantiated from
+// a registered definition, e.g. trees built in code
+const DefaultTreeID = "MainTree"
+
+// modelElementNames maps node types to their TreeNodesModel element names
+var modelElementNames = map[core.NodeType]string{
+	core.NodeTypeAction:    "Action",
+	core.NodeTypeCondition: "Condition",
+	core.NodeTypeControl:   "Control",
+	core.NodeTypeDecorator: "Decorator",
+	core.NodeTypeSubtree:   "SubTree",
+}
+
+// portModelElementNames maps port directions to their TreeNodesModel element names
+var portModelElementNames = map[core.PortDirection]string{
+	core.PortDirectionInput:  "input_port",
+	core.PortDirectionOutput: "output_port",
+	core.PortDirectionInOut:  "inout_port",
+}
+
+// WriteTreeToXML writes a tree, with its port remappings, attributes and
+// conditions, in the BehaviorTree.CPP v4 format. Every subtree is written
+// as its own <BehaviorTree>, and the nodes that are not builtin are
+// described in a <TreeNodesModel> so that editors such as Groot2 can open
+// the file. Nodes without a manifest, built in code, are written by name.
+func WriteTreeToXML(tree *BehaviorTree) (string, error) {
+	if tree.RootNode() == nil {
+		return "", fmt.Errorf("the tree has no root node")
+	}
+
+	w := &treeWriter{manifests: make(map[string]core.TreeNodeManifest)}
+	id := tree.ID()
+	if id == "" {
+		id = DefaultTreeID
+	}
+	w.addTree(id, tree.RootNode())
+
+	root := &xmlElement{name: "root", attrs: []xml.Attr{
+		{Name: xml.Name{Local: "BTCPP_format"}, Value: "4"},
+		{Name: xml.Name{Local: "main_tree_to_execute"}, Value: id},
+	}}
+	root.children = append(root.children, w.trees...)
+	if model := nodesModelElement(w.manifests); model != nil {
+		root.children = append(root.children, model)
+	}
+	return encodeXML(root)
+}
+
+// WriteTreesToXML writes every registered tree definition, as it was loaded,
+// in one BehaviorTree.CPP v4 document
+func (p *XMLParser) WriteTreesToXML() (string, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	root := &xmlElement{name: "root", attrs: []xml.Attr{
+		{Name: xml.Name{Local: "BTCPP_format"}, Value: "4"},
+	}}
+	if p.mainTree != "" {
+		root.attrs = append(root.attrs, xml.Attr{Name: xml.Name{Local: "main_tree_to_execute"}, Value: p.mainTree})
+	}
+	for _, id := range p.registeredTrees() {
+		root.children = append(root.children, &xmlElement{
+			name:     "BehaviorTree",
+			attrs:    []xml.Attr{{Name: xml.Name{Local: "ID"}, Value: id}},
+			children: []*xmlElement{p.trees[id].root},
+		})
+	}
+	return encodeXML(root)
+}
+
+// WriteTreeNodesModelXML writes the <TreeNodesModel> of the nodes registered
+// in factory, with their ports, descriptions and metadata. The builtin nodes
+// are only included when includeBuiltin is true.
+func WriteTreeNodesModelXML(factory *BehaviorTreeFactory, includeBuiltin bool) (string, error) {
+	manifests := make(map[string]core.TreeNodeManifest)
+	for _, id := range factory.RegisteredNodes() {
+		if _, builtin := builtinNodes[id]; builtin && !includeBuiltin {
+			continue
+		}
+		if manifest, ok := factory.GetManifest(id); ok {
+			if manifest.RegistrationID == "" {
+				manifest.RegistrationID = id
+			}
+			manifests[id] = manifest
+		}
+	}
+
+	root := &xmlElement{name: "root", attrs: []xml.Attr{
+		{Name: xml.Name{Local: "BTCPP_format"}, Value: "4"},
+	}}
+	model := nodesModelElement(manifests)
+	if model == nil {
+		model = &xmlElement{name: "TreeNodesModel"}
+	}
+	root.children = append(root.children, model)
+	return encodeXML(root)
+}
+
+// treeWriter converts live nodes back to XML elements
+type treeWriter struct {
+	trees     []*xmlElement
+	written   map[string]bool
+	manifests map[string]core.TreeNodeManifest
+}
+
+// addTree appends a <BehaviorTree> for root, once per ID
+func (w *treeWriter) addTree(id string, root core.Node) {
+	if w.written == nil {
+		w.written = make(map[string]bool)
+	}
+	if w.written[id] {
+		return
+	}
+	w.written[id] = true
+
+	element := &xmlElement{
+		name:  "BehaviorTree",
+		attrs: []xml.Attr{{Name: xml.Name{Local: "ID"}, Value: id}},
+	}
+	w.trees = append(w.trees, element)
+	element.children = []*xmlElement{w.nodeElement(root)}
+}
+
+// nodeElement converts a node and its children
+func (w *treeWriter) nodeElement(node core.Node) *xmlElement {
+	config := node.Config()
+	id := config.Manifest.RegistrationID
+	if id == "" {
+		id = node.Name()
+	}
+
+	if _, isSubtree := node.(*decorators.SubtreeNode); isSubtree {
+		element := &xmlElement{name: "SubTree", attrs: []xml.Attr{{Name: xml.Name{Local: "ID"}, Value: id}}}
+		if node.Name() != id {
+			element.attrs = append(element.attrs, xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name()})
+		}
+		attrs := make(map[string]string, len(config.InputPorts))
+		for name, value := range config.InputPorts {
+			attrs[name] = value
+		}
+		element.attrs = append(element.attrs, sortedAttrs(attrs, config)...)
+		if children := node.Children(); len(children) > 0 {
+			w.addTree(id, children[0])
+		}
+		return element
+	}
+
+	if _, builtin := builtinNodes[id]; !builtin && config.Manifest.RegistrationID != "" {
+		w.manifests[id] = config.Manifest
+	}
+
+	element := &xmlElement{name: id}
+	if node.Name() != id {
+		element.attrs = append(element.attrs, xml.Attr{Name: xml.Name{Local: "name"}, Value: node.Name()})
+	}
+	attrs := make(map[string]string, len(config.InputPorts)+len(config.OutputPorts)+len(config.OtherAttributes))
+	for _, ports := range []core.PortsRemapping{config.InputPorts, config.OutputPorts} {
+		for name, value := range ports {
+			// Defaults are applied again when the tree is loaded
+			if port, declared := config.Manifest.Ports[name]; declared && port.DefaultValue == value {
+				continue
+			}
+			attrs[name] = value
+		}
+	}
+	for name, value := range config.OtherAttributes {
+		attrs[name] = value
+	}
+	element.attrs = append(element.attrs, sortedAttrs(attrs, config)...)
+
+	for _, child := range node.Children() {
+		element.children = append(element.children, w.nodeElement(child))
+	}
+	return element
+}
+
+// sortedAttrs returns attrs and the conditions of config as XML attributes
+// sorted by name
+func sortedAttrs(attrs map[string]string, config core.NodeConfig) []xml.Attr {
+	for cond, code := range config.PreConditions {
+		attrs[cond.String()] = code
+	}
+	for cond, code := range config.PostConditions {
+		attrs[cond.String()] = code
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]xml.Attr, len(names))
+	for i, name := range names {
+		result[i] = xml.Attr{Name: xml.Name{Local: name}, Value: attrs[name]}
+	}
+	return result
+}
+
+// nodesModelElement creates a <TreeNodesModel> describing manifests sorted by
+// ID, or nil if there are none
+func nodesModelElement(manifests map[string]core.TreeNodeManifest) *xmlElement {
+	if len(manifests) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(manifests))
+	for id := range manifests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	model := &xmlElement{name: "TreeNodesModel"}
+	for _, id := range ids {
+		manifest := manifests[id]
+		name, ok := modelElementNames[manifest.Type]
+		if !ok {
+			name = "Action"
+		}
+		element := &xmlElement{name: name, attrs: []xml.Attr{{Name: xml.Name{Local: "ID"}, Value: id}}}
+
+		portNames := make([]string, 0, len(manifest.Ports))
+		for portName := range manifest.Ports {
+			portNames = append(portNames, portName)
+		}
+		sort.Strings(portNames)
+		for _, portName := range portNames {
+			port := manifest.Ports[portName]
+			portElement := &xmlElement{
+				name:  portModelElementNames[port.Direction],
+				attrs: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: portName}},
+				text:  port.Description,
+			}
+			if port.TypeName != "" {
+				portElement.attrs = append(portElement.attrs, xml.Attr{Name: xml.Name{Local: "type"}, Value: port.TypeName})
+			}
+			if port.DefaultValue != "" {
+				portElement.attrs = append(portElement.attrs, xml.Attr{Name: xml.Name{Local: "default"}, Value: port.DefaultValue})
+			}
+			element.children = append(element.children, portElement)
+		}
+
+		if len(manifest.Metadata) > 0 {
+			metadata := &xmlElement{name: "MetaData"}
+			for _, kv := range manifest.Metadata {
+				metadata.children = append(metadata.children, &xmlElement{name: kv.Key, text: kv.Value})
+			}
+			element.children = append(element.children, metadata)
+		}
+		model.children = append(model.children, element)
+	}
+	return model
+}
+
+// encodeXML writes an element tree as an indented document
+func encodeXML(root *xmlElement) (string, error) {
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := writeElement(encoder, root); err != nil {
+		return "", err
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// writeElement encodes an element, its text and its children
+func writeElement(encoder *xml.Encoder, element *xmlElement) error {
+	start := xml.StartElement{Name: xml.Name{Local: element.name}, Attr: element.attrs}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if text := strings.TrimSpace(element.text); text != "" {
+		if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	for _, child := range element.children {
+		if err := writeElement(encoder, child); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
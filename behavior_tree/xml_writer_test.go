@@ -0,0 +1,148 @@
+package behavior_tree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/actfuns/gamekit/behavior_tree/core"
+)
+
+func newAttackFactory(t *testing.T) *BehaviorTreeFactory {
+	factory := NewBehaviorTreeFactory()
+	manifest := core.TreeNodeManifest{
+		Type:           core.NodeTypeAction,
+		RegistrationID: "Attack",
+		Ports: core.PortsList{
+			"damage": core.InputPort("int", "damage dealt").WithDefault(1),
+			"result": core.OutputPort("bool", "whether it hit"),
+		},
+		Metadata: core.KeyValueVector{{Key: "description", Value: "hits the target"}},
+	}
+	err := factory.RegisterBuilder("Attack", manifest, func(name string, config core.NodeConfig) (core.Node, error) {
+		node := core.NewActionNode(name, config, func() core.NodeStatus { return core.NodeStatusSuccess })
+		return &node, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return factory
+}
+
+func TestWriteTreeToXML(t *testing.T) {
+	parser := NewXMLParser(newAttackFactory(t))
+	err := parser.RegisterFromText(`<root BTCPP_format="4" main_tree_to_execute="Main">
+  <BehaviorTree ID="Main">
+    <Sequence name="root">
+      <Attack name="strike" damage="{power}" result="{hit}" _skipIf="power == 0" />
+      <Attack />
+      <SubTree ID="Count" _autoremap="true" />
+    </Sequence>
+  </BehaviorTree>
+  <BehaviorTree ID="Count">
+    <Script code="count += 1" _description="a &lt;b&gt; counter" />
+  </BehaviorTree>
+</root>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := parser.InstantiateTree("Main", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := WriteTreeToXML(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<root BTCPP_format="4" main_tree_to_execute="Main">`,
+		`<Attack name="strike" _skipIf="power == 0" damage="{power}" result="{hit}"></Attack>`,
+		`<Attack></Attack>`,
+		`<SubTree ID="Count" _autoremap="true"></SubTree>`,
+		`<BehaviorTree ID="Count">`,
+		`_description="a &lt;b&gt; counter"`,
+		`<input_port name="damage" type="int" default="1">damage dealt</input_port>`,
+		`<description>hits the target</description>`,
+	} {
+		if !strings.Contains(text, expected) {
+			t.Fatalf("missing %s in\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, `<Sequence ID=`) || strings.Contains(text, `ID="Sequence"`) {
+		t.Fatalf("builtin nodes must not be described in the model\n%s", text)
+	}
+
+	// The written tree loads back to the same document
+	reloaded, err := NewXMLParser(newAttackFactory(t)).LoadFromText(text)
+	if err != nil {
+		t.Fatalf("reload failed: %v\n%s", err, text)
+	}
+	again, err := WriteTreeToXML(reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != text {
+		t.Fatalf("round trip changed the tree\n%s\n---\n%s", text, again)
+	}
+
+	definitions, err := parser.WriteTreesToXML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(definitions, `<BehaviorTree ID="Count">`) || !strings.Contains(definitions, `main_tree_to_execute="Main"`) {
+		t.Fatalf("unexpected definitions\n%s", definitions)
+	}
+}
+
+func TestWriteTreeToXML_BuiltInCode(t *testing.T) {
+	factory := newAttackFactory(t)
+	node, err := factory.CreateNode("Attack", "first", core.NodeConfig{InputPorts: core.PortsRemapping{"damage": "3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := Create(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := WriteTreeToXML(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, `<BehaviorTree ID="MainTree">`) || !strings.Contains(text, `<Attack name="first" damage="3">`) {
+		t.Fatalf("unexpected XML\n%s", text)
+	}
+}
+
+func TestWriteTreeNodesModelXML(t *testing.T) {
+	factory := newAttackFactory(t)
+	text, err := WriteTreeNodesModelXML(factory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, `ID="Sequence"`) {
+		t.Fatalf("builtin nodes included\n%s", text)
+	}
+
+	// The model is read back by the parser
+	parser := NewXMLParser(NewBehaviorTreeFactory())
+	if err := parser.RegisterFromText(text); err != nil {
+		t.Fatalf("%v\n%s", err, text)
+	}
+	model := parser.models["Attack"]
+	if model.Type != core.NodeTypeAction || model.Ports["damage"].Description != "damage dealt" ||
+		model.Ports["result"].Direction != core.PortDirectionOutput {
+		t.Fatalf("unexpected model %+v", model)
+	}
+	if len(model.Metadata) != 1 || model.Metadata[0].Value != "hits the target" {
+		t.Fatalf("unexpected metadata %v", model.Metadata)
+	}
+
+	text, err = WriteTreeNodesModelXML(factory, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, `<Decorator ID="Timeout">`) {
+		t.Fatalf("builtin nodes missing\n%s", text)
+	}
+}
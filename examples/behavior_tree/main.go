@@ -9,9 +9,6 @@ import (
 	"runtime"
 
 	"github.com/actfuns/gamekit/behavior_tree"
-	"github.com/actfuns/gamekit/behavior_tree/actions"
-	"github.com/actfuns/gamekit/behavior_tree/controls"
-	"github.com/actfuns/gamekit/behavior_tree/decorators"
 )
 
 func main() {
@@ -35,12 +32,9 @@ func main() {
 		log.Fatalf("Unknown test type: %s. Use 'simple', 'complex', or 'full'", *testType)
 	}
 
-	// 创建行为树工厂
+	// 创建行为树工厂，内置节点（Sequence、Fallback、Inverter等）已自动注册
 	behaviorTreeFactory := behavior_tree.NewBehaviorTreeFactory()
 
-	// 注册内置动作节点
-	registerNodes(behaviorTreeFactory)
-
 	// 创建XML解析器
 	parser := behavior_tree.NewXMLParser(behaviorTreeFactory)
 
@@ -84,77 +78,3 @@ func main() {
 	fmt.Println("\nDemo completed successfully!")
 	os.Exit(0)
 }
-
-func registerNodes(factory *behavior_tree.BehaviorTreeFactory) {
-	// 注册 AlwaysSuccess 节点
-	err := factory.RegisterSimpleNode("AlwaysSuccess", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return actions.NewAlwaysSuccessNode(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register AlwaysSuccess: %v", err)
-	}
-	
-	// 注册 AlwaysFailure 节点
-	err = factory.RegisterSimpleNode("AlwaysFailure", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return actions.NewAlwaysFailureNode(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register AlwaysFailure: %v", err)
-	}
-	
-	// 注册 Inverter 节点
-	err = factory.RegisterSimpleNode("Inverter", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return decorators.NewInverterNode(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register Inverter: %v", err)
-	}
-	
-	// 注册 Fallback 节点
-	err = factory.RegisterSimpleNode("Fallback", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return controls.NewFallbackNode(name, config, false), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register Fallback: %v", err)
-	}
-	
-	// 注册 ReactiveFallback 节点
-	err = factory.RegisterSimpleNode("ReactiveFallback", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return controls.NewReactiveFallbackNode(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register ReactiveFallback: %v", err)
-	}
-	
-	// 注册 Sequence 节点
-	err = factory.RegisterSimpleNode("Sequence", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return controls.NewSequenceNode(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register Sequence: %v", err)
-	}
-	
-	// 注册 ReactiveSequence 节点
-	err = factory.RegisterSimpleNode("ReactiveSequence", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return controls.NewReactiveSequence(name, config), nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register ReactiveSequence: %v", err)
-	}
-	
-	// 注册 Sleep 节点（如果需要）
-	err = factory.RegisterSimpleNode("Sleep", 
-		func(name string, config behavior_tree.NodeConfig) (behavior_tree.TreeNode, error) {
-			return &actions.SleepNode{}, nil
-		})
-	if err != nil {
-		log.Fatalf("Failed to register Sleep: %v", err)
-	}
-}